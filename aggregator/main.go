@@ -3,12 +3,18 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"net/http"
+	"sync/atomic"
 	"time"
 
 	"e-commerce/common/config"
+	"e-commerce/common/health"
+	"e-commerce/common/kafkaclient"
+	"e-commerce/common/lifecycle"
+	applog "e-commerce/common/logger"
+	"e-commerce/common/metrics"
 
 	"github.com/segmentio/kafka-go"
-	"go.uber.org/zap"
 )
 
 // OrderCreated is a superset of both V1 & V2.
@@ -21,7 +27,7 @@ type OrderCreated struct {
 	PromoCode *string  `json:"promoCode,omitempty"`
 }
 
-// Metric is emitted once per-minute.
+// Metric is emitted once per window (one minute by default).
 type Metric struct {
 	WindowStart time.Time `json:"window_start"`
 	Count       int       `json:"count"`
@@ -29,75 +35,124 @@ type Metric struct {
 
 func main() {
 	// 1. Load shared config (common/config)
-	cfg, err := config.Load()
+	cfg := config.MustLoad()
+
+	// 2. Init Zap logger, following log level changes in the config file
+	logger, level, err := applog.NewLeveled(cfg.Env, cfg.LogLevel)
 	if err != nil {
-		panic("failed to load config: " + err.Error())
+		panic("failed to initialize logger: " + err.Error())
 	}
-
-	// 2. Init Zap logger
-	logger, _ := zap.NewProduction()
 	defer logger.Sync()
+	rt := config.NewRuntime(cfg, logger)
+	applog.WatchLevel(rt, logger, level)
+	rt.Watch()
 	sugar := logger.Sugar()
-	sugar.Infow("Starting Aggregator", "env", cfg.Env, "brokers", cfg.KafkaBrokers)
+	sugar.Infow("Starting Aggregator", "env", cfg.Env, "brokers", cfg.Kafka.Brokers)
 
-	// 3. Kafka reader on orders.created
+	// 3. Kafka reader on orders.created, with the shared TLS/SASL settings
+	kconn, err := kafkaclient.New(cfg.Kafka)
+	if err != nil {
+		sugar.Fatalw("Kafka client config failed", "error", err)
+	}
+	clientID := config.ClientID(cfg.Aggregator.ClientID)
 	reader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers: cfg.KafkaBrokers,
-		Topic:   "orders.created",
-		GroupID: "aggregator-group",
+		Brokers: kconn.Brokers,
+		Topic:   cfg.Topics.OrdersCreated,
+		GroupID: cfg.Aggregator.GroupID,
+		Dialer:  kconn.Dialer(clientID),
 	})
-	defer reader.Close()
 
 	// 4. Kafka writer for metrics.order.rate
 	writer := kafka.NewWriter(kafka.WriterConfig{
-		Brokers:  cfg.KafkaBrokers,
-		Topic:    "metrics.order.rate",
+		Brokers:  kconn.Brokers,
+		Topic:    cfg.Topics.OrderRate,
+		Dialer:   kconn.Dialer(clientID),
 		Balancer: &kafka.LeastBytes{},
 	})
-	defer writer.Close()
 
-	// 5. Counting loop
-	ticker := time.NewTicker(time.Minute)
-	defer ticker.Stop()
+	// 5. Counting state shared by the consumer and the publisher
+	var count atomic.Int64
+	windowStart := time.Now().UTC().Truncate(cfg.Aggregator.Window)
 
-	count := 0
-	windowStart := time.Now().UTC().Truncate(time.Minute)
-	ctx := context.Background()
+	publish := func(ctx context.Context) {
+		n := count.Swap(0)
+		metric := Metric{WindowStart: windowStart, Count: int(n)}
+		data, _ := json.Marshal(metric)
+		metrics.PublishAttempts.WithLabelValues(writer.Topic).Inc()
+		err := writer.WriteMessages(ctx,
+			kafka.Message{
+				Key:   []byte(windowStart.Format(time.RFC3339)),
+				Value: data,
+			},
+		)
+		if err != nil {
+			metrics.PublishFailures.WithLabelValues(writer.Topic).Inc()
+			sugar.Errorw("failed to write metric", "error", err)
+		} else {
+			sugar.Infow("published metric", "window_start", windowStart, "count", n)
+		}
+		// reset
+		windowStart = time.Now().UTC().Truncate(cfg.Aggregator.Window)
+	}
 
-	// 5a. Consume in background
-	go func() {
+	// 5a. Consume until shutdown
+	consume := func(ctx context.Context) error {
 		for {
 			m, err := reader.ReadMessage(ctx)
 			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
 				sugar.Warnw("read order failed", "error", err)
 				continue
 			}
+			metrics.MessagesConsumed.WithLabelValues(m.Topic).Inc()
+			metrics.ObserveLag(m.Topic, m.Partition, m.Offset, m.HighWaterMark)
 			var oc OrderCreated
 			if err := json.Unmarshal(m.Value, &oc); err != nil {
 				sugar.Warnw("invalid order payload", "error", err)
+				metrics.MessagesDeadLettered.WithLabelValues(m.Topic).Inc()
 				continue
 			}
-			count++
+			count.Add(1)
 		}
-	}()
+	}
 
-	// 5b. Publish metrics each minute
-	for range ticker.C {
-		metric := Metric{WindowStart: windowStart, Count: count}
-		data, _ := json.Marshal(metric)
-		err := writer.WriteMessages(ctx,
-			kafka.Message{
-				Key:   []byte(windowStart.Format(time.RFC3339)),
-				Value: data,
-			},
-		)
-		if err != nil {
-			sugar.Errorw("failed to write metric", "error", err)
-		} else {
-			sugar.Infow("published metric", "window_start", windowStart, "count", count)
+	// 5b. Publish metrics each window; flush the partial window on stop
+	tick := func(ctx context.Context) error {
+		ticker := time.NewTicker(cfg.Aggregator.Window)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				publish(ctx)
+			case <-ctx.Done():
+				publish(context.WithoutCancel(ctx))
+				return nil
+			}
 		}
-		// reset
-		windowStart = time.Now().UTC().Truncate(time.Minute)
-		count = 0
 	}
+
+	// 6. Health probes and metrics on the admin port
+	hc := health.NewHandler(logger)
+	hc.AddReadiness("kafka", health.KafkaBrokers(kconn))
+	hc.AddReadiness("consumer-group", health.GroupMember(kconn, cfg.Aggregator.GroupID, clientID))
+	mux := http.NewServeMux()
+	hc.Register(mux)
+	metrics.Register(mux)
+
+	// 7. Writer is stopped after the publisher's final flush; the
+	//    consumer stops first so the final window is complete.
+	lc := lifecycle.New(logger, cfg.ShutdownTimeout)
+	lc.HTTPServer("admin", &http.Server{Addr: cfg.Aggregator.AdminAddr, Handler: mux})
+	lc.Closer("writer", writer.Close)
+	lc.Go("publisher", tick)
+	lc.Go("consumer", consume, reader.Close)
+	lc.Append(lifecycle.Hook{Name: "readiness", OnStop: hc.Drain})
+
+	if err := lc.Run(); err != nil {
+		sugar.Errorw("shutdown completed with errors", "error", err)
+		return
+	}
+	sugar.Infow("Aggregator exited cleanly")
 }
@@ -0,0 +1,33 @@
+// Package handler serves queries over the audit log.
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"e-commerce/audit/store"
+
+	"go.uber.org/zap"
+)
+
+// History serves GET /orders/{id}/events: every event recorded for the
+// order, oldest first. An order with no events is a 404.
+func History(s *store.Store, log *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		id := r.PathValue("id")
+		events, err := s.History(r.Context(), id)
+		if err != nil {
+			log.Error("Loading order history failed", zap.String("orderID", id), zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "loading history failed"})
+			return
+		}
+		if len(events) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "no events for order " + id})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"order_id": id, "events": events})
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"e-commerce/audit/handler"
+	"e-commerce/audit/store"
+	"e-commerce/common/config"
+	"e-commerce/common/health"
+	"e-commerce/common/kafkaclient"
+	"e-commerce/common/lifecycle"
+	"e-commerce/common/logger"
+	"e-commerce/common/metrics"
+	"e-commerce/common/models"
+	"e-commerce/common/sqldb"
+
+	"go.uber.org/zap"
+)
+
+func main() {
+	// 1. Load config + logger
+	cfg := config.MustLoad()
+	log, level, err := logger.NewLeveled(cfg.Env, cfg.LogLevel)
+	if err != nil {
+		panic("failed to init logger: " + err.Error())
+	}
+	defer log.Sync()
+	log.Info("Starting Audit Service", zap.String("env", cfg.Env), zap.String("database", cfg.Audit.Database.Driver))
+
+	rt := config.NewRuntime(cfg, log)
+	logger.WatchLevel(rt, log, level)
+	rt.Watch()
+
+	// 1b. Kafka connection settings (TLS/SASL) shared by every client
+	kconn, err := kafkaclient.New(cfg.Kafka)
+	if err != nil {
+		log.Fatal("kafka client config failed", zap.Error(err))
+	}
+	clientID := config.ClientID(cfg.Audit.ClientID)
+
+	// 2. Database and the append-only audit table
+	ctx := context.Background()
+	db, err := sqldb.Open(ctx, cfg.Audit.Database.Driver, cfg.Audit.Database.DSN)
+	if err != nil {
+		log.Fatal("database init failed", zap.Error(err))
+	}
+	types := map[string]string{
+		cfg.Topics.OrdersCreated:       models.TypeOrderCreated,
+		cfg.Topics.NotificationsResent: models.TypeNotificationResent,
+	}
+	st, err := store.New(ctx, db, types)
+	if err != nil {
+		log.Fatal("audit store init failed", zap.Error(err))
+	}
+
+	// 3. Consumer: events and offsets are written in one transaction
+	topics := cfg.Audit.Topics
+	if len(topics) == 0 {
+		topics = []string{cfg.Topics.OrdersCreated, cfg.Topics.InventoryEvents, cfg.Topics.NotificationsResent}
+	}
+	cons := sqldb.NewConsumer(kconn, db, cfg.Audit.GroupID, clientID, topics,
+		cfg.Audit.Batch.Size, cfg.Audit.Batch.FlushInterval, st.Append, log)
+
+	// 4. Health, metrics and the history endpoint on the admin port
+	hc := health.NewHandler(log)
+	hc.AddLiveness("consumer", cons.Watchdog().Check(cfg.Audit.StuckAfter))
+	hc.AddReadiness("kafka", health.KafkaBrokers(kconn))
+	hc.AddReadiness("database", health.Ping(st))
+	mux := http.NewServeMux()
+	hc.Register(mux)
+	metrics.Register(mux)
+	mux.Handle("GET /orders/{id}/events", handler.History(st, log))
+
+	// 5. Register components with the lifecycle manager
+	lc := lifecycle.New(log, cfg.ShutdownTimeout)
+	lc.HTTPServer("admin", &http.Server{Addr: cfg.Audit.AdminAddr, Handler: mux})
+	lc.Closer("database", db.Close)
+	lc.Go("consumer", cons.Run, cons.Close)
+	lc.Append(lifecycle.Hook{Name: "readiness", OnStop: hc.Drain})
+
+	// 6. Run until SIGINT/SIGTERM; the batch in progress is stored first
+	if err := lc.Run(); err != nil {
+		log.Error("Shutdown completed with errors", zap.Error(err))
+		return
+	}
+	log.Info("Audit Service shut down cleanly")
+}
@@ -0,0 +1,196 @@
+// Package store keeps the audit log: every domain event as it appeared
+// on Kafka, in an append-only table.
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"e-commerce/common/dedupe"
+	"e-commerce/common/sqldb"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// The table is keyed by the event's Kafka coordinates, so a message
+// can only be recorded once. Times are Unix milliseconds and headers
+// a JSON object, which keeps the DDL the same on SQLite and Postgres.
+var schema = []string{`
+CREATE TABLE IF NOT EXISTS audit_events (
+	topic           TEXT    NOT NULL,
+	kafka_partition INTEGER NOT NULL,
+	kafka_offset    BIGINT  NOT NULL,
+	event_type      TEXT    NOT NULL,
+	order_id        TEXT    NOT NULL,
+	msg_key         TEXT    NOT NULL,
+	headers         TEXT    NOT NULL,
+	payload         TEXT    NOT NULL,
+	payload_base64  BOOLEAN NOT NULL,
+	event_time_ms   BIGINT  NOT NULL,
+	recorded_at_ms  BIGINT  NOT NULL,
+	PRIMARY KEY (topic, kafka_partition, kafka_offset)
+)`,
+	`CREATE INDEX IF NOT EXISTS audit_events_order ON audit_events (order_id, event_time_ms)`,
+}
+
+// Append-only is enforced by the database, not just by this code.
+var appendOnly = map[string][]string{
+	sqldb.SQLite: {
+		`CREATE TRIGGER IF NOT EXISTS audit_events_no_update BEFORE UPDATE ON audit_events
+		 BEGIN SELECT RAISE(ABORT, 'audit_events is append-only'); END`,
+		`CREATE TRIGGER IF NOT EXISTS audit_events_no_delete BEFORE DELETE ON audit_events
+		 BEGIN SELECT RAISE(ABORT, 'audit_events is append-only'); END`,
+	},
+	sqldb.Postgres: {
+		`CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+		 BEGIN RAISE EXCEPTION 'audit_events is append-only'; END $$ LANGUAGE plpgsql`,
+		`DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events`,
+		`CREATE TRIGGER audit_events_append_only BEFORE UPDATE OR DELETE ON audit_events
+		 FOR EACH ROW EXECUTE FUNCTION audit_events_append_only()`,
+	},
+}
+
+// Event is one recorded message.
+type Event struct {
+	Topic      string            `json:"topic"`
+	Partition  int               `json:"partition"`
+	Offset     int64             `json:"offset"`
+	Type       string            `json:"type"`
+	OrderID    string            `json:"order_id"`
+	Key        string            `json:"key"`
+	Headers    map[string]string `json:"headers"`
+	Payload    json.RawMessage   `json:"payload,omitempty"`        // JSON events
+	PayloadB64 string            `json:"payload_base64,omitempty"` // anything else
+	Time       time.Time         `json:"time"`
+	RecordedAt time.Time         `json:"recorded_at"`
+}
+
+// Store reads and writes the audit table.
+type Store struct {
+	db    *sqldb.DB
+	types map[string]string // topic -> event type
+}
+
+// New creates the table if needed. A message's type is taken from its
+// event ID header; without one, types names the event carried by its
+// topic, and other topics are recorded with their topic as the type.
+func New(ctx context.Context, db *sqldb.DB, types map[string]string) (*Store, error) {
+	for _, stmt := range schema {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return nil, fmt.Errorf("creating audit table: %w", err)
+		}
+	}
+	for _, stmt := range appendOnly[db.Driver] {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return nil, fmt.Errorf("protecting audit table: %w", err)
+		}
+	}
+	return &Store{db: db, types: types}, nil
+}
+
+// Append records msgs inside tx. It satisfies sqldb.Handler. Messages
+// already recorded are skipped, so a replayed batch is harmless.
+func (s *Store) Append(ctx context.Context, tx *sql.Tx, msgs []kafka.Message) error {
+	stmt, err := tx.PrepareContext(ctx, s.db.Rebind(`
+		INSERT INTO audit_events (topic, kafka_partition, kafka_offset, event_type, order_id, msg_key,
+			headers, payload, payload_base64, event_time_ms, recorded_at_ms)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (topic, kafka_partition, kafka_offset) DO NOTHING`))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	now := time.Now().UnixMilli()
+	for _, m := range msgs {
+		headers := make(map[string]string, len(m.Headers))
+		for _, h := range m.Headers {
+			headers[h.Key] = string(h.Value)
+		}
+		hdr, _ := json.Marshal(headers)
+
+		payload, b64 := string(m.Value), false
+		if !json.Valid(m.Value) || !utf8.Valid(m.Value) {
+			payload, b64 = base64.StdEncoding.EncodeToString(m.Value), true
+		}
+		typ := dedupe.EventType(headers[dedupe.EventIDHeader])
+		if typ == "" {
+			var ok bool
+			if typ, ok = s.types[m.Topic]; !ok {
+				typ = m.Topic
+			}
+		}
+		if _, err := stmt.ExecContext(ctx, m.Topic, m.Partition, m.Offset, typ, orderID(m), string(m.Key),
+			string(hdr), payload, b64, m.Time.UnixMilli(), now); err != nil {
+			return fmt.Errorf("recording %s/%d@%d: %w", m.Topic, m.Partition, m.Offset, err)
+		}
+	}
+	return nil
+}
+
+// orderID takes the order ID from the payload, falling back to the key
+// (every domain event is keyed by order ID).
+func orderID(m kafka.Message) string {
+	var v struct {
+		OrderID  string `json:"order_id"`
+		OrderID2 string `json:"orderID"`
+	}
+	if json.Unmarshal(m.Value, &v) == nil {
+		if v.OrderID != "" {
+			return v.OrderID
+		}
+		if v.OrderID2 != "" {
+			return v.OrderID2
+		}
+	}
+	return string(m.Key)
+}
+
+// History returns every recorded event of an order, oldest first.
+func (s *Store) History(ctx context.Context, orderID string) ([]Event, error) {
+	rows, err := s.db.QueryContext(ctx, s.db.Rebind(`
+		SELECT topic, kafka_partition, kafka_offset, event_type, order_id, msg_key,
+			headers, payload, payload_base64, event_time_ms, recorded_at_ms
+		FROM audit_events WHERE order_id = ?
+		ORDER BY event_time_ms, topic, kafka_partition, kafka_offset`), orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		var (
+			e            Event
+			hdr, payload string
+			b64          bool
+			at, recorded int64
+		)
+		if err := rows.Scan(&e.Topic, &e.Partition, &e.Offset, &e.Type, &e.OrderID, &e.Key,
+			&hdr, &payload, &b64, &at, &recorded); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(hdr), &e.Headers); err != nil {
+			return nil, fmt.Errorf("decoding headers of %s/%d@%d: %w", e.Topic, e.Partition, e.Offset, err)
+		}
+		if b64 {
+			e.PayloadB64 = payload
+		} else {
+			e.Payload = json.RawMessage(payload)
+		}
+		e.Time = time.UnixMilli(at).UTC()
+		e.RecordedAt = time.UnixMilli(recorded).UTC()
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// Ping is a readiness check.
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.Ping(ctx)
+}
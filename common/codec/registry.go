@@ -0,0 +1,90 @@
+package codec
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"e-commerce/common/config"
+
+	"github.com/actgardner/gogen-avro/v7/generic"
+)
+
+// Registry fetches writer schemas from a Confluent-compatible Schema
+// Registry by ID and caches the compiled codecs.
+type Registry struct {
+	url      string
+	username string
+	password string
+	http     *http.Client
+
+	mu     sync.Mutex
+	codecs map[int]*generic.Codec
+}
+
+// NewRegistry creates a client for the registry in cfg.
+func NewRegistry(cfg config.SchemaRegistry) *Registry {
+	return &Registry{
+		url:      strings.TrimRight(cfg.URL, "/"),
+		username: cfg.Username,
+		password: cfg.Password,
+		http:     &http.Client{Timeout: 10 * time.Second},
+		codecs:   map[int]*generic.Codec{},
+	}
+}
+
+// Codec returns a decoder for the schema registered under id.
+func (r *Registry) Codec(ctx context.Context, id int) (*generic.Codec, error) {
+	r.mu.Lock()
+	c, ok := r.codecs[id]
+	r.mu.Unlock()
+	if ok {
+		return c, nil
+	}
+
+	schema, err := r.schema(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	c, err = generic.NewCodecFromSchema([]byte(schema), []byte(schema))
+	if err != nil {
+		return nil, fmt.Errorf("compiling schema %d: %w", id, err)
+	}
+	r.mu.Lock()
+	r.codecs[id] = c
+	r.mu.Unlock()
+	return c, nil
+}
+
+func (r *Registry) schema(ctx context.Context, id int) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url+"/schemas/ids/"+strconv.Itoa(id), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.schemaregistry.v1+json")
+	if r.username != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+	resp, err := r.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("fetching schema %d: %w", id, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("fetching schema %d: %s: %s", id, resp.Status, strings.TrimSpace(string(body)))
+	}
+	var out struct {
+		Schema string `json:"schema"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("decoding schema %d: %w", id, err)
+	}
+	return out.Schema, nil
+}
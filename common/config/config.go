@@ -1,42 +1,525 @@
 package config
 
 import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
-// Config holds application settings
+// Config holds application settings. Every field has a default, can be
+// set in config/<env>.yaml, and can be overridden by an APP_-prefixed
+// environment variable named after its path, e.g. kafka.brokers is
+// APP_KAFKA_BROKERS and inventory.group_id is APP_INVENTORY_GROUP_ID.
+// Keys listed in reloadable can change at runtime; see Runtime.
 type Config struct {
-	Env          string   // "dev" or "prod"
-	KafkaBrokers []string // e.g. ["kafka:9092"]
-	LogLevel     string   // "debug", "info", "error"
+	Env             string        `mapstructure:"env"`       // "dev" or "prod"
+	LogLevel        string        `mapstructure:"log_level"` // "debug", "info", "error"
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+
+	Kafka          Kafka          `mapstructure:"kafka"`
+	SchemaRegistry SchemaRegistry `mapstructure:"schema_registry"`
+	Topics         Topics         `mapstructure:"topics"`
+	Trace          Trace          `mapstructure:"trace"`
+
+	Features Features `mapstructure:"features"`
+
+	Order        Order        `mapstructure:"order"`
+	Inventory    Inventory    `mapstructure:"inventory"`
+	Notification Notification `mapstructure:"notification"`
+	Aggregator   Aggregator   `mapstructure:"aggregator"`
+	LagMonitor   LagMonitor   `mapstructure:"lag_monitor"`
+	Audit        Audit        `mapstructure:"audit"`
+	SinkRunner   SinkRunner   `mapstructure:"sink_runner"`
+
+	file string // config file that was read, "" if none
+}
+
+// Kafka holds cluster connection settings shared by every client.
+type Kafka struct {
+	Brokers []string  `mapstructure:"brokers"` // e.g. ["kafka:9092"]
+	TLS     KafkaTLS  `mapstructure:"tls"`
+	SASL    KafkaSASL `mapstructure:"sasl"`
+}
+
+// KafkaTLS encrypts broker connections. With no CA file the system
+// roots are used; a cert/key pair enables mutual TLS.
+type KafkaTLS struct {
+	Enabled            bool   `mapstructure:"enabled"`
+	CAFile             string `mapstructure:"ca_file"`              // PEM bundle
+	CertFile           string `mapstructure:"cert_file"`            // client certificate, PEM
+	KeyFile            string `mapstructure:"key_file"`             // client key, PEM
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"` // dev only; rejected with env prod
+}
+
+// KafkaSASL authenticates to the brokers.
+type KafkaSASL struct {
+	Mechanism string `mapstructure:"mechanism"` // "none", "PLAIN", "SCRAM-SHA-256" or "SCRAM-SHA-512"
+	Username  string `mapstructure:"username"`
+	Password  string `mapstructure:"password" secret:"true"`
+}
+
+// SchemaRegistry locates the Confluent-compatible Schema Registry used
+// to decode Avro payloads.
+type SchemaRegistry struct {
+	URL      string `mapstructure:"url"`      // e.g. "http://schema-registry:8081"
+	Username string `mapstructure:"username"` // basic auth, optional
+	Password string `mapstructure:"password" secret:"true"`
+}
+
+// Topics names every topic our services read or write.
+type Topics struct {
+	OrdersCreated       string `mapstructure:"orders_created"`
+	InventoryEvents     string `mapstructure:"inventory_events"` // reservations and failures, keyed by order ID
+	OrderRate           string `mapstructure:"order_rate"`
+	OpsAlerts           string `mapstructure:"ops_alerts"`
+	NotificationsResent string `mapstructure:"notifications_resent"`
+}
+
+// Trace selects the span exporter.
+type Trace struct {
+	Exporter    string  `mapstructure:"exporter"`     // "none", "stdout", "file" or "otlp"
+	Endpoint    string  `mapstructure:"endpoint"`     // OTLP/HTTP collector, e.g. "otel-collector:4318"
+	File        string  `mapstructure:"file"`         // output path for the "file" exporter
+	SampleRatio float64 `mapstructure:"sample_ratio"` // fraction of new traces to sample, 0..1
+}
+
+// Features are runtime toggles.
+type Features struct {
+	OrderDedupe   bool `mapstructure:"order_dedupe"`  // order service skips repeated OrderIDs
+	Notifications bool `mapstructure:"notifications"` // notification service delivers at all
+}
+
+// RateLimit is a token-bucket limit; RPS 0 disables limiting.
+type RateLimit struct {
+	RPS   float64 `mapstructure:"rps"`
+	Burst int     `mapstructure:"burst"`
+}
+
+// Retry is an exponential-backoff retry policy.
+type Retry struct {
+	MaxAttempts int           `mapstructure:"max_attempts"`
+	Backoff     time.Duration `mapstructure:"backoff"` // first delay, doubled after each attempt
+}
+
+// Database selects a SQL database.
+type Database struct {
+	Driver string `mapstructure:"driver"`            // "sqlite" or "postgres"
+	DSN    string `mapstructure:"dsn" secret:"true"` // file path for sqlite, postgres:// URL for postgres
+}
+
+// Batch bounds how much is written per database transaction.
+type Batch struct {
+	Size          int           `mapstructure:"size"`           // messages per batch
+	FlushInterval time.Duration `mapstructure:"flush_interval"` // max age of a partial batch
+}
+
+// Order configures the order service.
+type Order struct {
+	ListenAddr string    `mapstructure:"listen_addr"`
+	Publish    Retry     `mapstructure:"publish"`
+	RateLimit  RateLimit `mapstructure:"rate_limit"` // on POST /orders
+}
+
+// Inventory configures the inventory service.
+type Inventory struct {
+	GroupID    string         `mapstructure:"group_id"`
+	ClientID   string         `mapstructure:"client_id"` // hostname is appended per instance
+	AdminAddr  string         `mapstructure:"admin_addr"`
+	Publish    Retry          `mapstructure:"publish"`
+	StuckAfter time.Duration  `mapstructure:"stuck_after"` // liveness fails past this per message
+	SeedStock  map[string]int `mapstructure:"seed_stock"`
+}
+
+// Notification configures the notification service.
+type Notification struct {
+	GroupID     string        `mapstructure:"group_id"`
+	ClientID    string        `mapstructure:"client_id"`
+	AdminAddr   string        `mapstructure:"admin_addr"`
+	Delivery    Retry         `mapstructure:"delivery"` // per channel, by the bulkhead's workers
+	StuckAfter  time.Duration `mapstructure:"stuck_after"`
+	Sink        string        `mapstructure:"sink"` // "console" or "email"; also the default channel
+	Email       Email         `mapstructure:"email"`
+	Webhooks    Webhooks      `mapstructure:"webhooks"`
+	Preferences Preferences   `mapstructure:"preferences"`
+	Templates   Templates     `mapstructure:"templates"`
+	DeliveryLog DeliveryLog   `mapstructure:"delivery_log"`
+	Limits      Limits        `mapstructure:"limits"`
+	Breaker     Breaker       `mapstructure:"breaker"`  // per channel
+	Bulkhead    Bulkhead      `mapstructure:"bulkhead"` // per channel
+	OpsAlerts   OpsAlerts     `mapstructure:"ops_alerts"`
+	APIToken    string        `mapstructure:"api_token" secret:"true"` // bearer token for the admin APIs; required with env prod
+}
+
+// Preferences configures per-user notification preferences and the
+// routing of each notification to the user's channels.
+type Preferences struct {
+	Database        Database      `mapstructure:"database"`         // preferences, notifications held for quiet hours, rate limit windows and digests
+	DefaultChannels []string      `mapstructure:"default_channels"` // for users without preferences; default [sink]
+	DefaultLocale   string        `mapstructure:"default_locale"`
+	DeferredPoll    time.Duration `mapstructure:"deferred_poll"` // how often held notifications are checked
+}
+
+// DeliveryLog configures the record of every notification attempt,
+// served with resends on the admin API.
+type DeliveryLog struct {
+	Database Database `mapstructure:"database"`
+}
+
+// Limits caps how many notifications each user and each channel get
+// per window. Notifications over a limit are dropped or, with Digest,
+// collapsed into one digest per user and channel sent when the window
+// ends. Window counts and pending digests are kept in the preferences
+// database, so they survive restarts.
+type Limits struct {
+	Enabled    bool             `mapstructure:"enabled"`
+	PerUser    Limit            `mapstructure:"per_user"`    // per user, across all their channels
+	PerChannel map[string]Limit `mapstructure:"per_channel"` // across users, by channel name
+	Digest     bool             `mapstructure:"digest"`
+}
+
+// Limit allows Max notifications per fixed Window; Max 0 disables it.
+type Limit struct {
+	Max    int           `mapstructure:"max"`
+	Window time.Duration `mapstructure:"window"`
+}
+
+// Breaker stops sending to a channel that keeps failing. After Failures
+// consecutive failures the circuit opens and sends fail fast for
+// OpenFor; then one probe at a time is let through (half-open), and
+// Probes successes in a row close it again while any failure reopens
+// it. Notifications refused by an open circuit are held and retried.
+type Breaker struct {
+	Failures int           `mapstructure:"failures"`
+	OpenFor  time.Duration `mapstructure:"open_for"`
+	Probes   int           `mapstructure:"probes"`
+}
+
+// Bulkhead gives each channel its own queue and workers, so a slow or
+// failing channel holds up only its own notifications. MaxConcurrent
+// workers send; up to Queue notifications wait for one, for at most
+// MaxWait. The rest are turned away and their notifications held and
+// retried.
+type Bulkhead struct {
+	MaxConcurrent int           `mapstructure:"max_concurrent"`
+	Queue         int           `mapstructure:"queue"`
+	MaxWait       time.Duration `mapstructure:"max_wait"`
+}
+
+// OpsAlerts posts inventory failures to a chat incoming webhook
+// (Slack-compatible {"text": ...} JSON). Failures are counted per SKU
+// and reason over Window and posted once when it ends, or as soon as
+// they reach the critical threshold.
+type OpsAlerts struct {
+	Enabled    bool                   `mapstructure:"enabled"`
+	WebhookURL string                 `mapstructure:"webhook_url" secret:"true"` // the URL is the credential
+	Capture    bool                   `mapstructure:"capture"`                   // post to an in-process receiver instead (dev only); served at /ops-alerts
+	Timeout    time.Duration          `mapstructure:"timeout"`
+	Window     time.Duration          `mapstructure:"window"`
+	Reasons    map[string]AlertReason `mapstructure:"reasons"` // by name, tried in name order; one with an empty match is the fallback
+}
+
+// AlertReason classifies failure reasons and sets their severity
+// thresholds: distinct failed orders per SKU and window. Fewer than
+// Warning are not posted; 0 disables a level.
+type AlertReason struct {
+	Match    string `mapstructure:"match"` // case-insensitive substring of the failure reason; empty matches any
+	Warning  int    `mapstructure:"warning"`
+	Critical int    `mapstructure:"critical"`
+}
+
+// Templates configures the notification message templates.
+type Templates struct {
+	Dir string `mapstructure:"dir"` // <kind>/<channel>/<locale>/v<N>/ under it; the default locale is preferences.default_locale
 }
 
-// Load reads from env or config files, with profiles.
+// Webhooks configures outbound partner webhooks, delivered alongside
+// the sink. Subscriptions are managed through the admin API.
+type Webhooks struct {
+	Enabled      bool          `mapstructure:"enabled"`
+	Database     Database      `mapstructure:"database"`      // subscriptions and delivery attempts
+	Timeout      time.Duration `mapstructure:"timeout"`       // per attempt
+	Retry        Retry         `mapstructure:"retry"`         // per delivery; backoff doubles with jitter
+	MaxBackoff   time.Duration `mapstructure:"max_backoff"`   // cap on the delay between attempts
+	DisableAfter int           `mapstructure:"disable_after"` // consecutive failed deliveries before an endpoint is disabled
+}
+
+// Email configures the email notification sink.
+type Email struct {
+	From    string   `mapstructure:"from"`
+	To      []string `mapstructure:"to"` // recipients for users without an email preference
+	SMTP    SMTP     `mapstructure:"smtp"`
+	Capture bool     `mapstructure:"capture"` // send to an in-process capture server instead (dev only); served at /mail
+}
+
+// SMTP locates and authenticates to the mail relay.
+type SMTP struct {
+	Addr     string        `mapstructure:"addr"` // host:port
+	TLS      string        `mapstructure:"tls"`  // "starttls", "tls" (implicit, usually port 465) or "none"
+	Username string        `mapstructure:"username"`
+	Password string        `mapstructure:"password" secret:"true"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+}
+
+// Aggregator configures the order-rate aggregator.
+type Aggregator struct {
+	GroupID   string        `mapstructure:"group_id"`
+	ClientID  string        `mapstructure:"client_id"`
+	AdminAddr string        `mapstructure:"admin_addr"`
+	Window    time.Duration `mapstructure:"window"`
+}
+
+// LagMonitor configures the consumer lag monitor.
+type LagMonitor struct {
+	ClientID  string        `mapstructure:"client_id"`
+	AdminAddr string        `mapstructure:"admin_addr"`
+	Interval  time.Duration `mapstructure:"interval"` // between collections
+	Groups    []string      `mapstructure:"groups"`   // consumer groups to watch
+	Warn      LagThreshold  `mapstructure:"warn"`
+	Critical  LagThreshold  `mapstructure:"critical"`
+	Realert   time.Duration `mapstructure:"realert"` // repeat an unchanged alert this often
+}
+
+// Audit configures the audit log service.
+type Audit struct {
+	GroupID    string        `mapstructure:"group_id"`
+	ClientID   string        `mapstructure:"client_id"`
+	AdminAddr  string        `mapstructure:"admin_addr"` // also serves the history endpoint
+	Topics     []string      `mapstructure:"topics"`     // empty means every domain topic
+	Database   Database      `mapstructure:"database"`
+	Batch      Batch         `mapstructure:"batch"`
+	StuckAfter time.Duration `mapstructure:"stuck_after"` // liveness fails past this per batch
+}
+
+// SinkRunner configures the Kafka-to-database sink runner. The sinks
+// themselves are defined in the manifest.
+type SinkRunner struct {
+	ClientID   string        `mapstructure:"client_id"`
+	AdminAddr  string        `mapstructure:"admin_addr"`
+	Manifest   string        `mapstructure:"manifest"`    // YAML file listing the sinks
+	StuckAfter time.Duration `mapstructure:"stuck_after"` // liveness fails past this per batch
+}
+
+// LagThreshold is breached when either limit is exceeded; 0 disables a limit.
+type LagThreshold struct {
+	Messages int64         `mapstructure:"messages"` // total lag across the group's partitions
+	Behind   time.Duration `mapstructure:"behind"`   // age of the oldest unconsumed message
+}
+
+// defaults are applied before the config file and environment.
+var defaults = map[string]any{
+	"env":              "dev",
+	"log_level":        "info",
+	"shutdown_timeout": 15 * time.Second,
+
+	"kafka.brokers":                  []string{"localhost:9092"},
+	"kafka.tls.enabled":              false,
+	"kafka.tls.ca_file":              "",
+	"kafka.tls.cert_file":            "",
+	"kafka.tls.key_file":             "",
+	"kafka.tls.insecure_skip_verify": false,
+	"kafka.sasl.mechanism":           "none",
+	"kafka.sasl.username":            "",
+	"kafka.sasl.password":            "",
+
+	"schema_registry.url":      "http://localhost:8081",
+	"schema_registry.username": "",
+	"schema_registry.password": "",
+
+	"topics.orders_created":       "orders.created",
+	"topics.inventory_events":     "inventory.events",
+	"topics.order_rate":           "metrics.order.rate",
+	"topics.ops_alerts":           "ops.alerts",
+	"topics.notifications_resent": "notifications.resent",
+
+	"trace.exporter":     "none",
+	"trace.endpoint":     "localhost:4318",
+	"trace.file":         "traces.jsonl",
+	"trace.sample_ratio": 1.0,
+
+	"features.order_dedupe":  true,
+	"features.notifications": true,
+
+	"order.listen_addr":          ":8090",
+	"order.publish.max_attempts": 5,
+	"order.publish.backoff":      100 * time.Millisecond,
+	"order.rate_limit.rps":       0,
+	"order.rate_limit.burst":     100,
+
+	"inventory.group_id":             "inventory-group",
+	"inventory.client_id":            "inventory",
+	"inventory.admin_addr":           ":8080",
+	"inventory.publish.max_attempts": 5,
+	"inventory.publish.backoff":      100 * time.Millisecond,
+	"inventory.stuck_after":          time.Minute,
+	"inventory.seed_stock":           map[string]int{"foo": 10, "bar": 5},
+
+	"notification.group_id":                     "notification-group",
+	"notification.client_id":                    "notification",
+	"notification.admin_addr":                   ":8080",
+	"notification.delivery.max_attempts":        3,
+	"notification.delivery.backoff":             100 * time.Millisecond,
+	"notification.stuck_after":                  time.Minute,
+	"notification.sink":                         "console",
+	"notification.email.from":                   "E-Commerce <no-reply@example.com>",
+	"notification.email.to":                     []string{"orders@example.com"},
+	"notification.email.smtp.addr":              "localhost:587",
+	"notification.email.smtp.tls":               "starttls",
+	"notification.email.smtp.username":          "",
+	"notification.email.smtp.password":          "",
+	"notification.email.smtp.timeout":           10 * time.Second,
+	"notification.email.capture":                false,
+	"notification.webhooks.enabled":             false,
+	"notification.webhooks.database.driver":     "sqlite",
+	"notification.webhooks.database.dsn":        "webhooks.db",
+	"notification.webhooks.timeout":             5 * time.Second,
+	"notification.webhooks.retry.max_attempts":  5,
+	"notification.webhooks.retry.backoff":       500 * time.Millisecond,
+	"notification.webhooks.max_backoff":         30 * time.Second,
+	"notification.webhooks.disable_after":       5,
+	"notification.preferences.database.driver":  "sqlite",
+	"notification.preferences.database.dsn":     "preferences.db",
+	"notification.preferences.default_channels": []string{},
+	"notification.preferences.default_locale":   "en",
+	"notification.preferences.deferred_poll":    30 * time.Second,
+	"notification.templates.dir":                "config/templates",
+	"notification.delivery_log.database.driver": "sqlite",
+	"notification.delivery_log.database.dsn":    "notifications.db",
+	"notification.limits.enabled":               false,
+	"notification.limits.per_user.max":          5,
+	"notification.limits.per_user.window":       time.Minute,
+	"notification.limits.per_channel":           map[string]any{},
+	"notification.limits.digest":                true,
+	"notification.breaker.failures":             5,
+	"notification.breaker.open_for":             30 * time.Second,
+	"notification.breaker.probes":               1,
+	"notification.bulkhead.max_concurrent":      4,
+	"notification.bulkhead.queue":               16,
+	"notification.bulkhead.max_wait":            5 * time.Second,
+	"notification.ops_alerts.enabled":           false,
+	"notification.ops_alerts.webhook_url":       "",
+	"notification.ops_alerts.capture":           false,
+	"notification.ops_alerts.timeout":           5 * time.Second,
+	"notification.ops_alerts.window":            5 * time.Minute,
+	"notification.ops_alerts.reasons": map[string]any{
+		"out_of_stock": map[string]any{"match": "out of stock", "warning": 3, "critical": 10},
+		"unknown_sku":  map[string]any{"match": "not recognized", "warning": 1, "critical": 5},
+		"other":        map[string]any{"match": "", "warning": 5, "critical": 20},
+	},
+	"notification.api_token": "",
+
+	"aggregator.group_id":   "aggregator-group",
+	"aggregator.client_id":  "aggregator",
+	"aggregator.admin_addr": ":8080",
+	"aggregator.window":     time.Minute,
+
+	"lag_monitor.client_id":         "lagmonitor",
+	"lag_monitor.admin_addr":        ":8080",
+	"lag_monitor.interval":          15 * time.Second,
+	"lag_monitor.groups":            []string{"inventory-group", "notification-group", "aggregator-group", "audit-group", "sink-orders", "sink-inventory-archive"},
+	"lag_monitor.warn.messages":     1000,
+	"lag_monitor.warn.behind":       30 * time.Second,
+	"lag_monitor.critical.messages": 10000,
+	"lag_monitor.critical.behind":   5 * time.Minute,
+	"lag_monitor.realert":           10 * time.Minute,
+
+	"audit.group_id":             "audit-group",
+	"audit.client_id":            "audit",
+	"audit.admin_addr":           ":8080",
+	"audit.topics":               []string{},
+	"audit.database.driver":      "sqlite",
+	"audit.database.dsn":         "audit.db",
+	"audit.batch.size":           200,
+	"audit.batch.flush_interval": time.Second,
+	"audit.stuck_after":          time.Minute,
+
+	"sink_runner.client_id":   "sinkrunner",
+	"sink_runner.admin_addr":  ":8080",
+	"sink_runner.manifest":    "config/sinks.yaml",
+	"sink_runner.stuck_after": time.Minute,
+}
+
+// Load reads defaults, then config/<env>.yaml (or the file named by
+// APP_CONFIG_FILE), then APP_* environment variables, and validates the
+// result. A missing profile file is fine; an unreadable or malformed
+// one is an error. On validation failure the decoded config is still
+// returned alongside the error so it can be printed.
 func Load() (*Config, error) {
-	// Look for APP_ENV (dev/prod) and APP_LOG_LEVEL
-	viper.SetEnvPrefix("APP")
-	viper.AutomaticEnv()
-	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
-
-	// Default environment
-	env := viper.GetString("ENV")
-	if env == "" {
-		env = "dev"
-	}
-	// Try to read config/<env>.yaml if present
-	viper.SetConfigName(env)
-	viper.AddConfigPath("./config")
-	_ = viper.ReadInConfig()
-
-	// Defaults
-	viper.SetDefault("KAFKA_BROKERS", []string{"localhost:9092"})
-	viper.SetDefault("LOG_LEVEL", "info")
-
-	return &Config{
-		Env:          env,
-		KafkaBrokers: viper.GetStringSlice("KAFKA_BROKERS"),
-		LogLevel:     viper.GetString("LOG_LEVEL"),
-	}, nil
+	return LoadFile(os.Getenv("APP_CONFIG_FILE"))
+}
+
+// LoadFile is Load with an explicit config file instead of
+// APP_CONFIG_FILE; "" means the profile file. It is for tools that
+// parse their own flags; services use MustLoad.
+func LoadFile(file string) (*Config, error) {
+	return load(file)
+}
+
+func load(file string) (*Config, error) {
+	v := viper.New()
+	v.SetEnvPrefix("APP")
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+	for k, val := range defaults {
+		v.SetDefault(k, val)
+	}
+
+	if file != "" {
+		v.SetConfigFile(file)
+	} else {
+		// Profile file named after APP_ENV (dev/prod)
+		v.SetConfigName(v.GetString("env"))
+		v.SetConfigType("yaml")
+		v.AddConfigPath("./config")
+	}
+	if err := v.ReadInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if file != "" || !errors.As(err, &notFound) {
+			return nil, fmt.Errorf("reading config file: %w", err)
+		}
+	}
+
+	var cfg Config
+	if err := v.Unmarshal(&cfg); err != nil {
+		return nil, fmt.Errorf("decoding config: %w", err)
+	}
+	cfg.file = v.ConfigFileUsed()
+	return &cfg, cfg.Validate()
+}
+
+// MustLoad is the entry point for service binaries. It registers and
+// parses the --config and --print-config flags, loads the config, and
+// exits with a readable report if it is invalid. With --print-config
+// it prints the effective values (secrets redacted) and exits.
+func MustLoad() *Config {
+	file := flag.String("config", os.Getenv("APP_CONFIG_FILE"), "path to a YAML config file (default config/<env>.yaml)")
+	printConfig := flag.Bool("print-config", false, "print the effective configuration, secrets redacted, and exit")
+	flag.Parse()
+
+	cfg, err := load(*file)
+	if *printConfig && cfg != nil {
+		_ = cfg.Print(os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+	if *printConfig {
+		os.Exit(0)
+	}
+	return cfg
+}
+
+// ClientID returns a per-instance Kafka client ID ("<service>-<hostname>"),
+// so brokers and group coordinators can tell replicas apart.
+func ClientID(service string) string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return service
+	}
+	return service + "-" + host
 }
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// redacted replaces the value of any non-empty field tagged `secret:"true"`.
+const redacted = "********"
+
+// Print writes the effective configuration as YAML, using the same
+// keys the config file accepts. Fields tagged `secret:"true"` are
+// redacted.
+func (c *Config) Print(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	writeStruct(bw, reflect.ValueOf(*c), 0)
+	return bw.Flush()
+}
+
+func writeStruct(w *bufio.Writer, v reflect.Value, depth int) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		key := f.Tag.Get("mapstructure")
+		if key == "" || key == "-" {
+			continue
+		}
+		writeValue(w, key, v.Field(i), f.Tag.Get("secret") == "true", depth)
+	}
+}
+
+func writeValue(w *bufio.Writer, key string, v reflect.Value, secret bool, depth int) {
+	indent := strings.Repeat("  ", depth)
+	if secret {
+		if !v.IsZero() {
+			fmt.Fprintf(w, "%s%s: %q\n", indent, key, redacted)
+		} else {
+			fmt.Fprintf(w, "%s%s: \"\"\n", indent, key)
+		}
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		fmt.Fprintf(w, "%s%s:\n", indent, key)
+		writeStruct(w, v, depth+1)
+	case reflect.Map:
+		if v.Len() == 0 {
+			fmt.Fprintf(w, "%s%s: {}\n", indent, key)
+			return
+		}
+		fmt.Fprintf(w, "%s%s:\n", indent, key)
+		keys := make([]string, 0, v.Len())
+		vals := map[string]reflect.Value{}
+		for _, k := range v.MapKeys() {
+			ks := fmt.Sprint(k.Interface())
+			keys = append(keys, ks)
+			vals[ks] = v.MapIndex(k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			writeValue(w, k, vals[k], false, depth+1)
+		}
+	case reflect.Slice:
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = scalar(v.Index(i))
+		}
+		fmt.Fprintf(w, "%s%s: [%s]\n", indent, key, strings.Join(items, ", "))
+	default:
+		fmt.Fprintf(w, "%s%s: %s\n", indent, key, scalar(v))
+	}
+}
+
+// scalar renders a leaf value, quoting strings that YAML would misread.
+func scalar(v reflect.Value) string {
+	if d, ok := v.Interface().(time.Duration); ok {
+		return d.String()
+	}
+	if v.Kind() == reflect.String {
+		s := v.String()
+		if s == "" || strings.ContainsAny(s, ":#{}[],&*!|>'\"%@`") || strings.TrimSpace(s) != s {
+			return fmt.Sprintf("%q", s)
+		}
+		return s
+	}
+	return fmt.Sprint(v.Interface())
+}
@@ -0,0 +1,157 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// reloadable lists the key prefixes that may change while running.
+// Changes to any other key are logged and ignored until restart.
+var reloadable = []string{
+	"log_level",
+	"features",
+	"order.publish",
+	"order.rate_limit",
+	"inventory.publish",
+	"notification.delivery",
+	"notification.limits",
+	"notification.webhooks.retry",
+}
+
+// Runtime holds a service's live configuration. It watches the config
+// file and, on every valid change, notifies the subscribers whose
+// section changed. Invalid files are rejected and the previous config
+// stays in effect.
+type Runtime struct {
+	logger *zap.Logger
+
+	mu   sync.RWMutex
+	cur  *Config
+	subs []func(old, cur *Config)
+}
+
+// NewRuntime wraps the config loaded at startup.
+func NewRuntime(cfg *Config, log *zap.Logger) *Runtime {
+	return &Runtime{logger: log, cur: cfg}
+}
+
+// Current returns the config in effect. Treat it as read-only.
+func (r *Runtime) Current() *Config {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cur
+}
+
+// OnChange subscribes apply to one section of the config, selected by
+// pick. apply is called with the new value whenever a reload changes it.
+func OnChange[T any](r *Runtime, pick func(*Config) T, apply func(T)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subs = append(r.subs, func(old, cur *Config) {
+		if v := pick(cur); !reflect.DeepEqual(pick(old), v) {
+			apply(v)
+		}
+	})
+}
+
+// Watch starts watching the config file for changes. It is a no-op
+// when the service started without a config file.
+func (r *Runtime) Watch() {
+	file := r.Current().file
+	if file == "" {
+		r.logger.Info("No config file in use, runtime reload disabled")
+		return
+	}
+	v := viper.New()
+	v.SetConfigFile(file)
+	v.OnConfigChange(func(fsnotify.Event) { r.Reload() })
+	v.WatchConfig()
+	r.logger.Info("Watching config file for changes", zap.String("file", file))
+}
+
+// Reload re-reads the config file and environment. A config that fails
+// to load or validate is rejected. Otherwise the reloadable keys are
+// applied and subscribers notified; other changed keys are reported
+// as needing a restart.
+func (r *Runtime) Reload() {
+	r.mu.Lock()
+	old := r.cur
+	next, err := load(old.file)
+	if err != nil {
+		r.mu.Unlock()
+		r.logger.Error("Config reload rejected, keeping previous config", zap.Error(err))
+		return
+	}
+
+	changed := diff(reflect.ValueOf(*old), reflect.ValueOf(*next), "")
+	var applied, ignored []string
+	merged := *old
+	for _, key := range changed {
+		if isReloadable(key) {
+			applied = append(applied, key)
+		} else {
+			ignored = append(ignored, key)
+		}
+	}
+	if len(applied) > 0 {
+		merged.LogLevel = next.LogLevel
+		merged.Features = next.Features
+		merged.Order.Publish = next.Order.Publish
+		merged.Order.RateLimit = next.Order.RateLimit
+		merged.Inventory.Publish = next.Inventory.Publish
+		merged.Notification.Delivery = next.Notification.Delivery
+		merged.Notification.Limits = next.Notification.Limits
+		merged.Notification.Webhooks.Retry = next.Notification.Webhooks.Retry
+	}
+	r.cur = &merged
+	subs := append([]func(old, cur *Config){}, r.subs...)
+	r.mu.Unlock()
+
+	if len(ignored) > 0 {
+		r.logger.Warn("Config changes need a restart to take effect", zap.Strings("keys", ignored))
+	}
+	if len(applied) == 0 {
+		return
+	}
+	for _, s := range subs {
+		s(old, &merged)
+	}
+	r.logger.Info("Config reloaded", zap.Strings("keys", applied))
+}
+
+func isReloadable(key string) bool {
+	for _, p := range reloadable {
+		if key == p || strings.HasPrefix(key, p+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// diff returns the dotted config keys whose values differ.
+func diff(a, b reflect.Value, prefix string) []string {
+	if a.Kind() != reflect.Struct {
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			return []string{prefix}
+		}
+		return nil
+	}
+	var out []string
+	t := a.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key := t.Field(i).Tag.Get("mapstructure")
+		if key == "" || !t.Field(i).IsExported() {
+			continue
+		}
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		out = append(out, diff(a.Field(i), b.Field(i), key)...)
+	}
+	return out
+}
@@ -0,0 +1,290 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Validate checks every field and reports all problems at once, one
+// per line, each prefixed with the config key it concerns.
+func (c *Config) Validate() error {
+	var v validator
+
+	v.oneOf("env", c.Env, "dev", "prod")
+	var lvl zapcore.Level
+	if err := lvl.Set(c.LogLevel); err != nil {
+		v.add("log_level", "unknown level %q", c.LogLevel)
+	}
+	v.positive("shutdown_timeout", c.ShutdownTimeout)
+
+	if len(c.Kafka.Brokers) == 0 {
+		v.add("kafka.brokers", "must list at least one broker")
+	}
+	for i, b := range c.Kafka.Brokers {
+		v.hostPort(fmt.Sprintf("kafka.brokers[%d]", i), b)
+	}
+	if (c.Kafka.TLS.CertFile == "") != (c.Kafka.TLS.KeyFile == "") {
+		v.add("kafka.tls", "cert_file and key_file must be set together")
+	}
+	if c.Kafka.TLS.InsecureSkipVerify && c.Env == "prod" {
+		v.add("kafka.tls.insecure_skip_verify", "not allowed with env prod")
+	}
+	v.oneOf("kafka.sasl.mechanism", c.Kafka.SASL.Mechanism, "none", "PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512")
+	if c.Kafka.SASL.Mechanism != "none" {
+		v.required("kafka.sasl.username", c.Kafka.SASL.Username)
+		v.required("kafka.sasl.password", c.Kafka.SASL.Password)
+	}
+
+	if u, err := url.Parse(c.SchemaRegistry.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.add("schema_registry.url", "must be an http(s) URL, got %q", c.SchemaRegistry.URL)
+	}
+	if c.SchemaRegistry.Password != "" {
+		v.required("schema_registry.username", c.SchemaRegistry.Username)
+	}
+
+	v.required("topics.orders_created", c.Topics.OrdersCreated)
+	v.required("topics.inventory_events", c.Topics.InventoryEvents)
+	v.required("topics.order_rate", c.Topics.OrderRate)
+	v.required("topics.ops_alerts", c.Topics.OpsAlerts)
+	v.required("topics.notifications_resent", c.Topics.NotificationsResent)
+
+	v.oneOf("trace.exporter", c.Trace.Exporter, "none", "stdout", "file", "otlp")
+	if c.Trace.Exporter == "otlp" {
+		v.hostPort("trace.endpoint", c.Trace.Endpoint)
+	}
+	if c.Trace.Exporter == "file" {
+		v.required("trace.file", c.Trace.File)
+	}
+	if c.Trace.SampleRatio < 0 || c.Trace.SampleRatio > 1 {
+		v.add("trace.sample_ratio", "must be between 0 and 1, got %v", c.Trace.SampleRatio)
+	}
+
+	v.hostPort("order.listen_addr", c.Order.ListenAddr)
+	v.retry("order.publish", c.Order.Publish)
+	if c.Order.RateLimit.RPS < 0 {
+		v.add("order.rate_limit.rps", "must not be negative")
+	}
+	if c.Order.RateLimit.RPS > 0 && c.Order.RateLimit.Burst < 1 {
+		v.add("order.rate_limit.burst", "must be at least 1 when rps is set")
+	}
+
+	v.required("inventory.group_id", c.Inventory.GroupID)
+	v.required("inventory.client_id", c.Inventory.ClientID)
+	v.hostPort("inventory.admin_addr", c.Inventory.AdminAddr)
+	v.retry("inventory.publish", c.Inventory.Publish)
+	v.positive("inventory.stuck_after", c.Inventory.StuckAfter)
+	if len(c.Inventory.SeedStock) == 0 {
+		v.add("inventory.seed_stock", "must list at least one SKU")
+	}
+	for sku, qty := range c.Inventory.SeedStock {
+		if qty < 0 {
+			v.add("inventory.seed_stock."+sku, "must not be negative, got %d", qty)
+		}
+	}
+
+	v.required("notification.group_id", c.Notification.GroupID)
+	v.required("notification.client_id", c.Notification.ClientID)
+	v.hostPort("notification.admin_addr", c.Notification.AdminAddr)
+	v.retry("notification.delivery", c.Notification.Delivery)
+	v.positive("notification.stuck_after", c.Notification.StuckAfter)
+	v.oneOf("notification.sink", c.Notification.Sink, "console", "email")
+	if c.Notification.Sink == "email" {
+		v.address("notification.email.from", c.Notification.Email.From)
+		if len(c.Notification.Email.To) == 0 {
+			v.add("notification.email.to", "must list at least one recipient")
+		}
+		for i, to := range c.Notification.Email.To {
+			v.address(fmt.Sprintf("notification.email.to[%d]", i), to)
+		}
+		if !c.Notification.Email.Capture {
+			v.hostPort("notification.email.smtp.addr", c.Notification.Email.SMTP.Addr)
+			v.oneOf("notification.email.smtp.tls", c.Notification.Email.SMTP.TLS, "starttls", "tls", "none")
+			v.positive("notification.email.smtp.timeout", c.Notification.Email.SMTP.Timeout)
+			if c.Notification.Email.SMTP.Password != "" {
+				v.required("notification.email.smtp.username", c.Notification.Email.SMTP.Username)
+			}
+			if c.Notification.Email.SMTP.Username != "" && c.Notification.Email.SMTP.TLS == "none" {
+				v.add("notification.email.smtp.tls", "must not be none when authenticating")
+			}
+		}
+	}
+	if c.Notification.Email.Capture && c.Env == "prod" {
+		v.add("notification.email.capture", "not allowed with env prod")
+	}
+	if wh := c.Notification.Webhooks; wh.Enabled {
+		v.database("notification.webhooks.database", wh.Database)
+		v.positive("notification.webhooks.timeout", wh.Timeout)
+		v.retry("notification.webhooks.retry", wh.Retry)
+		v.positive("notification.webhooks.max_backoff", wh.MaxBackoff)
+		if wh.DisableAfter < 1 {
+			v.add("notification.webhooks.disable_after", "must be at least 1, got %d", wh.DisableAfter)
+		}
+	}
+	v.database("notification.preferences.database", c.Notification.Preferences.Database)
+	for i, ch := range c.Notification.Preferences.DefaultChannels {
+		v.oneOf(fmt.Sprintf("notification.preferences.default_channels[%d]", i), ch, "console", "email")
+		if ch == "email" && c.Notification.Sink != "email" {
+			v.add(fmt.Sprintf("notification.preferences.default_channels[%d]", i), "email needs notification.sink email")
+		}
+	}
+	v.required("notification.preferences.default_locale", c.Notification.Preferences.DefaultLocale)
+	v.positive("notification.preferences.deferred_poll", c.Notification.Preferences.DeferredPoll)
+	v.required("notification.templates.dir", c.Notification.Templates.Dir)
+	v.database("notification.delivery_log.database", c.Notification.DeliveryLog.Database)
+	if l := c.Notification.Limits; l.Enabled {
+		v.limit("notification.limits.per_user", l.PerUser)
+		for ch, lim := range l.PerChannel {
+			v.oneOf("notification.limits.per_channel", ch, "console", "email")
+			v.limit("notification.limits.per_channel."+ch, lim)
+		}
+	}
+	if b := c.Notification.Breaker; b.Failures < 1 || b.Probes < 1 {
+		v.add("notification.breaker", "failures and probes must be at least 1, got %d and %d", b.Failures, b.Probes)
+	}
+	v.positive("notification.breaker.open_for", c.Notification.Breaker.OpenFor)
+	if bh := c.Notification.Bulkhead; bh.MaxConcurrent < 1 || bh.Queue < 0 {
+		v.add("notification.bulkhead", "max_concurrent must be at least 1 and queue not negative, got %d and %d", bh.MaxConcurrent, bh.Queue)
+	}
+	v.positive("notification.bulkhead.max_wait", c.Notification.Bulkhead.MaxWait)
+	if oa := c.Notification.OpsAlerts; oa.Enabled {
+		if !oa.Capture {
+			if u, err := url.Parse(oa.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				v.add("notification.ops_alerts.webhook_url", "must be an http(s) URL")
+			}
+		}
+		v.positive("notification.ops_alerts.timeout", oa.Timeout)
+		v.positive("notification.ops_alerts.window", oa.Window)
+		if len(oa.Reasons) == 0 {
+			v.add("notification.ops_alerts.reasons", "must list at least one reason")
+		}
+		for name, r := range oa.Reasons {
+			key := "notification.ops_alerts.reasons." + name
+			if r.Warning < 0 || r.Critical < 0 {
+				v.add(key, "thresholds must not be negative")
+			}
+			if r.Warning > 0 && r.Critical > 0 && r.Critical < r.Warning {
+				v.add(key+".critical", "must not be below warning (%d), got %d", r.Warning, r.Critical)
+			}
+		}
+	}
+	if c.Notification.OpsAlerts.Capture && c.Env == "prod" {
+		v.add("notification.ops_alerts.capture", "not allowed with env prod")
+	}
+	if c.Notification.APIToken == "" && c.Env == "prod" {
+		v.add("notification.api_token", "is required with env prod")
+	}
+
+	v.required("aggregator.group_id", c.Aggregator.GroupID)
+	v.required("aggregator.client_id", c.Aggregator.ClientID)
+	v.hostPort("aggregator.admin_addr", c.Aggregator.AdminAddr)
+	v.positive("aggregator.window", c.Aggregator.Window)
+
+	v.required("lag_monitor.client_id", c.LagMonitor.ClientID)
+	v.hostPort("lag_monitor.admin_addr", c.LagMonitor.AdminAddr)
+	v.positive("lag_monitor.interval", c.LagMonitor.Interval)
+	if len(c.LagMonitor.Groups) == 0 {
+		v.add("lag_monitor.groups", "must list at least one consumer group")
+	}
+	for _, t := range []struct {
+		key string
+		th  LagThreshold
+	}{{"lag_monitor.warn", c.LagMonitor.Warn}, {"lag_monitor.critical", c.LagMonitor.Critical}} {
+		if t.th.Messages < 0 || t.th.Behind < 0 {
+			v.add(t.key, "limits must not be negative")
+		}
+	}
+	v.positive("lag_monitor.realert", c.LagMonitor.Realert)
+
+	v.required("audit.group_id", c.Audit.GroupID)
+	v.required("audit.client_id", c.Audit.ClientID)
+	v.hostPort("audit.admin_addr", c.Audit.AdminAddr)
+	v.database("audit.database", c.Audit.Database)
+	v.batch("audit.batch", c.Audit.Batch)
+	v.positive("audit.stuck_after", c.Audit.StuckAfter)
+
+	v.required("sink_runner.client_id", c.SinkRunner.ClientID)
+	v.hostPort("sink_runner.admin_addr", c.SinkRunner.AdminAddr)
+	v.required("sink_runner.manifest", c.SinkRunner.Manifest)
+	v.positive("sink_runner.stuck_after", c.SinkRunner.StuckAfter)
+
+	return v.err()
+}
+
+// validator accumulates field errors.
+type validator struct {
+	errs []error
+}
+
+func (v *validator) add(key, format string, args ...any) {
+	v.errs = append(v.errs, fmt.Errorf("%s: "+format, append([]any{key}, args...)...))
+}
+
+func (v *validator) err() error {
+	return errors.Join(v.errs...)
+}
+
+func (v *validator) required(key, val string) {
+	if val == "" {
+		v.add(key, "is required")
+	}
+}
+
+func (v *validator) oneOf(key, val string, allowed ...string) {
+	for _, a := range allowed {
+		if val == a {
+			return
+		}
+	}
+	v.add(key, "must be one of %q, got %q", allowed, val)
+}
+
+func (v *validator) address(key, val string) {
+	if _, err := mail.ParseAddress(val); err != nil {
+		v.add(key, "must be an email address, got %q", val)
+	}
+}
+
+func (v *validator) hostPort(key, val string) {
+	if _, _, err := net.SplitHostPort(val); err != nil {
+		v.add(key, "must be host:port, got %q", val)
+	}
+}
+
+func (v *validator) positive(key string, d interface{ Nanoseconds() int64 }) {
+	if d.Nanoseconds() <= 0 {
+		v.add(key, "must be positive")
+	}
+}
+
+func (v *validator) database(key string, d Database) {
+	v.oneOf(key+".driver", d.Driver, "sqlite", "postgres")
+	v.required(key+".dsn", d.DSN)
+}
+
+func (v *validator) batch(key string, b Batch) {
+	if b.Size < 1 {
+		v.add(key+".size", "must be at least 1, got %d", b.Size)
+	}
+	v.positive(key+".flush_interval", b.FlushInterval)
+}
+
+func (v *validator) limit(key string, l Limit) {
+	if l.Max < 0 {
+		v.add(key+".max", "must not be negative, got %d", l.Max)
+	}
+	if l.Max > 0 {
+		v.positive(key+".window", l.Window)
+	}
+}
+
+func (v *validator) retry(key string, r Retry) {
+	if r.MaxAttempts < 1 {
+		v.add(key+".max_attempts", "must be at least 1, got %d", r.MaxAttempts)
+	}
+	v.positive(key+".backoff", r.Backoff)
+}
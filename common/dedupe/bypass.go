@@ -0,0 +1,54 @@
+// Package dedupe carries the replay bypass flag. Events copied by
+// `ecomctl replay copy --dedupe bypass` carry BypassHeader; consumers
+// that find it reprocess the event even if they have seen its ID, and
+// pass the flag on to the events they emit so the whole chain reruns.
+package dedupe
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// BypassHeader marks a Kafka message whose idempotency checks should be
+// skipped. Its only meaningful value is "true".
+const BypassHeader = "X-Dedupe-Bypass"
+
+type bypassKey struct{}
+
+// WithBypass returns ctx marked to skip dedupe.
+func WithBypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassKey{}, true)
+}
+
+// Bypassed reports whether ctx is marked to skip dedupe.
+func Bypassed(ctx context.Context) bool {
+	b, _ := ctx.Value(bypassKey{}).(bool)
+	return b
+}
+
+// BypassPropagator carries the flag across Kafka hops alongside the
+// trace context and request ID.
+type BypassPropagator struct{}
+
+var _ propagation.TextMapPropagator = BypassPropagator{}
+
+// Inject sets BypassHeader when ctx is marked.
+func (BypassPropagator) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	if Bypassed(ctx) {
+		carrier.Set(BypassHeader, "true")
+	}
+}
+
+// Extract marks ctx when carrier has BypassHeader set to "true".
+func (BypassPropagator) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	if carrier.Get(BypassHeader) == "true" {
+		return WithBypass(ctx)
+	}
+	return ctx
+}
+
+// Fields lists the header keys this propagator uses.
+func (BypassPropagator) Fields() []string {
+	return []string{BypassHeader}
+}
@@ -0,0 +1,44 @@
+package dedupe
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// EventIDHeader carries an event's identity. Producers set it on every
+// domain event; consumers dedupe on it, so an event redelivered or
+// published twice is handled once while distinct events about the same
+// order (a reservation and a later failure, say) are each handled.
+const EventIDHeader = "X-Event-ID"
+
+// EventID is the identity of an event: its type (one of the
+// models.Type* names), the order it concerns and its version, which
+// tells apart repeated events of one type about one order. Producers
+// emit version 1 today.
+func EventID(typ, orderID string, version int) string {
+	return fmt.Sprintf("%s:%s:v%d", typ, orderID, version)
+}
+
+// EventType returns the type part of an event ID, or "" for an ID not
+// made by EventID.
+func EventType(id string) string {
+	typ, _, ok := strings.Cut(id, ":")
+	if !ok {
+		return ""
+	}
+	return typ
+}
+
+type eventIDKey struct{}
+
+// WithEventID returns ctx carrying the ID of the event being handled.
+func WithEventID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, eventIDKey{}, id)
+}
+
+// EventIDFrom returns the ID of the event being handled, if known.
+func EventIDFrom(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(eventIDKey{}).(string)
+	return id, ok && id != ""
+}
@@ -0,0 +1,337 @@
+// Package exactlyonce consumes Kafka into a store that keeps the
+// consumed offsets together with the data, so every message is stored
+// exactly once across restarts and rebalances.
+package exactlyonce
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"e-commerce/common/health"
+	"e-commerce/common/kafkaclient"
+	"e-commerce/common/metrics"
+
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+// Range is the offsets a batch covers on one partition: the stored
+// next offset before the batch (-1 if none was stored) and after it.
+type Range struct {
+	Topic     string
+	Partition int
+	From, To  int64
+}
+
+// ErrFenced means another group member stored offsets for a partition
+// after this one read them: the partition has moved and this member's
+// batch must be dropped.
+var ErrFenced = errors.New("offsets were advanced by another consumer")
+
+// Fenced wraps ErrFenced for one partition.
+func Fenced(topic string, partition int) error {
+	return fmt.Errorf("%s/%d: %w", topic, partition, ErrFenced)
+}
+
+// Store persists batches and their offsets atomically.
+type Store interface {
+	// Init prepares the store, e.g. creates tables or recovers files.
+	Init(ctx context.Context) error
+	// Offsets returns the next offset to read for every stored
+	// partition of topic.
+	Offsets(ctx context.Context, group, topic string) (map[int]int64, error)
+	// Write stores batch and advances every range, all or nothing. It
+	// returns an error wrapping ErrFenced if a stored offset is no
+	// longer a range's From.
+	Write(ctx context.Context, group string, batch []kafka.Message, ranges []Range) error
+}
+
+// Consumer is a consumer group member whose source of truth for
+// offsets is its Store. Kafka still assigns partitions, and offsets
+// are also committed to Kafka after each batch so lag monitoring keeps
+// working, but on every assignment the member resumes from the offsets
+// stored with the data. A member that loses a partition mid-batch is
+// fenced off by a compare-and-set on the stored offset, so no message
+// is written twice.
+type Consumer struct {
+	conn      *kafkaclient.Conn
+	store     Store
+	groupID   string
+	clientID  string
+	topics    []string
+	batchSize int
+	interval  time.Duration
+	logger    *zap.Logger
+	watchdog  health.Watchdog
+
+	mu sync.Mutex
+	cg *kafka.ConsumerGroup
+}
+
+// New creates a Consumer for topics. A batch is written when it
+// reaches batchSize messages or flushInterval after its first message.
+func New(conn *kafkaclient.Conn, store Store, groupID, clientID string, topics []string,
+	batchSize int, flushInterval time.Duration, log *zap.Logger) *Consumer {
+	return &Consumer{
+		conn:      conn,
+		store:     store,
+		groupID:   groupID,
+		clientID:  clientID,
+		topics:    topics,
+		batchSize: batchSize,
+		interval:  flushInterval,
+		logger:    log.With(zap.String("group", groupID)),
+	}
+}
+
+// Run joins the group and consumes until ctx is canceled. The batch in
+// progress is written before Run returns.
+func (c *Consumer) Run(ctx context.Context) error {
+	if err := c.store.Init(ctx); err != nil {
+		return err
+	}
+	cg, err := kafka.NewConsumerGroup(kafka.ConsumerGroupConfig{
+		ID:          c.groupID,
+		Brokers:     c.conn.Brokers,
+		Dialer:      c.conn.Dialer(c.clientID),
+		Topics:      c.topics,
+		StartOffset: kafka.FirstOffset,
+	})
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.cg = cg
+	c.mu.Unlock()
+	c.logger.Info("Exactly-once consumer started", zap.Strings("topics", c.topics))
+
+	for {
+		gen, err := cg.Next(ctx)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, kafka.ErrGroupClosed) {
+				return nil
+			}
+			c.logger.Warn("Joining consumer group failed, retrying", zap.Error(err))
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		done := make(chan struct{})
+		gen.Start(func(gctx context.Context) {
+			defer close(done)
+			c.generation(gctx, gen)
+		})
+		select {
+		case <-done:
+		case <-ctx.Done():
+			// Ends the generation; generation writes its last batch
+			_ = cg.Close()
+			<-done
+			return nil
+		}
+	}
+}
+
+type topicPartition struct {
+	topic     string
+	partition int
+}
+
+// generation consumes this member's assignment until the group
+// rebalances or the member leaves.
+func (c *Consumer) generation(ctx context.Context, gen *kafka.Generation) {
+	// 1. Resume from the store; fall back to Kafka's committed
+	//    offset, then the log start, for partitions never stored
+	stored := map[topicPartition]int64{}
+	var readers []*kafka.Reader
+	defer func() {
+		for _, r := range readers {
+			r.Close()
+		}
+	}()
+	for topic, parts := range gen.Assignments {
+		offs, err := c.store.Offsets(ctx, c.groupID, topic)
+		if err != nil {
+			c.logger.Error("Loading stored offsets failed", zap.Error(err))
+			return
+		}
+		for _, pa := range parts {
+			tp := topicPartition{topic, pa.ID}
+			start := pa.Offset
+			if off, ok := offs[pa.ID]; ok {
+				stored[tp], start = off, off
+			} else {
+				stored[tp] = -1
+			}
+			if start < 0 {
+				start = kafka.FirstOffset
+			}
+			r := kafka.NewReader(kafka.ReaderConfig{
+				Brokers:        c.conn.Brokers,
+				Topic:          topic,
+				Partition:      pa.ID,
+				Dialer:         c.conn.Dialer(c.clientID),
+				IsolationLevel: kafka.ReadCommitted,
+				MinBytes:       1,
+				MaxBytes:       10e6,
+				MaxWait:        500 * time.Millisecond,
+			})
+			if err := r.SetOffset(start); err != nil {
+				c.logger.Error("Positioning reader failed", zap.String("topic", topic), zap.Int("partition", pa.ID), zap.Error(err))
+				return
+			}
+			readers = append(readers, r)
+		}
+	}
+	c.logger.Info("Partitions assigned", zap.Int32("generation", gen.ID), zap.Int("partitions", len(readers)))
+
+	// 2. One fetcher per partition feeding a single batcher
+	msgs := make(chan kafka.Message, c.batchSize)
+	var wg sync.WaitGroup
+	for _, r := range readers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				m, err := r.FetchMessage(ctx)
+				if err != nil {
+					if ctx.Err() == nil {
+						c.logger.Warn("FetchMessage error", zap.Error(err))
+					}
+					return
+				}
+				select {
+				case msgs <- m:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	defer wg.Wait()
+
+	// 3. Write batches by size or age
+	batch := make([]kafka.Message, 0, c.batchSize)
+	timer := time.NewTimer(c.interval)
+	timer.Stop()
+	flush := func(ctx context.Context) error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := c.write(ctx, gen, stored, batch)
+		batch = batch[:0]
+		return err
+	}
+	for {
+		select {
+		case m := <-msgs:
+			metrics.MessagesConsumed.WithLabelValues(m.Topic).Inc()
+			metrics.ObserveLag(m.Topic, m.Partition, m.Offset, m.HighWaterMark)
+			if len(batch) == 0 {
+				timer.Reset(c.interval)
+			}
+			batch = append(batch, m)
+			if len(batch) < c.batchSize {
+				continue
+			}
+			timer.Stop()
+		case <-timer.C:
+		case <-ctx.Done():
+			// Fetched messages are ours until the stored offsets say
+			// otherwise; the fence catches a partition already moved.
+			for len(msgs) > 0 {
+				batch = append(batch, <-msgs)
+			}
+			fctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+			if err := flush(fctx); err != nil && !errors.Is(err, ErrFenced) {
+				c.logger.Warn("Final batch not written; it will be read again", zap.Error(err))
+			}
+			cancel()
+			return
+		}
+		if err := flush(ctx); err != nil {
+			// Fenced, or ctx ended while retrying: this generation is over
+			c.logger.Warn("Stopping consumption until the next assignment", zap.Error(err))
+			<-ctx.Done()
+			return
+		}
+	}
+}
+
+// write stores batch and its offsets in one transaction, retrying
+// transient failures until ctx ends. stored is updated on success.
+func (c *Consumer) write(ctx context.Context, gen *kafka.Generation, stored map[topicPartition]int64, batch []kafka.Message) error {
+	end := c.watchdog.Begin()
+	defer end()
+
+	next := map[topicPartition]int64{}
+	for _, m := range batch {
+		tp := topicPartition{m.Topic, m.Partition}
+		next[tp] = max(next[tp], m.Offset+1)
+	}
+
+	backoff := 100 * time.Millisecond
+	for {
+		err := c.writeOnce(ctx, stored, next, batch)
+		if err == nil {
+			break
+		}
+		if errors.Is(err, ErrFenced) {
+			return err
+		}
+		c.logger.Error("Writing batch failed, retrying", zap.Int("messages", len(batch)), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, 30*time.Second)
+	}
+
+	commits := map[string]map[int]int64{}
+	for tp, off := range next {
+		stored[tp] = off
+		if commits[tp.topic] == nil {
+			commits[tp.topic] = map[int]int64{}
+		}
+		commits[tp.topic][tp.partition] = off
+	}
+	for _, m := range batch {
+		metrics.MessagesCommitted.WithLabelValues(m.Topic).Inc()
+	}
+	// Only for lag monitoring; the database stays authoritative
+	if err := gen.CommitOffsets(commits); err != nil {
+		c.logger.Debug("Mirroring offsets to Kafka failed", zap.Error(err))
+	}
+	return nil
+}
+
+func (c *Consumer) writeOnce(ctx context.Context, stored, next map[topicPartition]int64, batch []kafka.Message) error {
+	ranges := make([]Range, 0, len(next))
+	for tp, off := range next {
+		ranges = append(ranges, Range{Topic: tp.topic, Partition: tp.partition, From: stored[tp], To: off})
+	}
+	return c.store.Write(ctx, c.groupID, batch, ranges)
+}
+
+// Watchdog exposes the batch-in-progress tracker for liveness checks.
+func (c *Consumer) Watchdog() *health.Watchdog {
+	return &c.watchdog
+}
+
+// Close leaves the group if Run has not already.
+func (c *Consumer) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cg == nil {
+		return nil
+	}
+	return c.cg.Close()
+}
@@ -0,0 +1,113 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"e-commerce/common/kafkaclient"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Pinger is implemented by stores that can report their availability.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Ping adapts a Pinger to a Check.
+func Ping(p Pinger) Check {
+	return p.Ping
+}
+
+// KafkaBrokers succeeds if at least one broker accepts a connection,
+// including the TLS and SASL handshakes.
+func KafkaBrokers(kc *kafkaclient.Conn) Check {
+	dialer := kc.Dialer("")
+	return func(ctx context.Context) error {
+		var errs []error
+		for _, b := range kc.Brokers {
+			conn, err := dialer.DialContext(ctx, "tcp", b)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			_ = conn.Close()
+			return nil
+		}
+		return fmt.Errorf("no broker reachable: %w", errors.Join(errs...))
+	}
+}
+
+// GroupMember succeeds if a client with clientID is an active member of
+// groupID. It asks the group coordinator, so it works for any client
+// library as long as each instance uses a distinct client ID.
+func GroupMember(kc *kafkaclient.Conn, groupID, clientID string) Check {
+	client := kc.Client("")
+	return func(ctx context.Context) error {
+		resp, err := client.DescribeGroups(ctx, &kafka.DescribeGroupsRequest{GroupIDs: []string{groupID}})
+		if err != nil {
+			return err
+		}
+		for _, g := range resp.Groups {
+			if g.Error != nil {
+				return g.Error
+			}
+			for _, m := range g.Members {
+				if m.ClientID == clientID {
+					return nil
+				}
+			}
+			return fmt.Errorf("client %q not a member of group %q (state %s)", clientID, groupID, g.GroupState)
+		}
+		return fmt.Errorf("group %q not found", groupID)
+	}
+}
+
+// Watchdog detects a worker stuck on a single unit of work.
+// Workers call Begin before each message and the returned func after
+// it; the liveness check fails if any message has been in progress too
+// long. It is safe for concurrent workers (e.g. one per partition).
+type Watchdog struct {
+	mu       sync.Mutex
+	next     uint64
+	inFlight map[uint64]time.Time
+}
+
+// Begin marks the start of a unit of work and returns its end func.
+func (w *Watchdog) Begin() (end func()) {
+	w.mu.Lock()
+	if w.inFlight == nil {
+		w.inFlight = map[uint64]time.Time{}
+	}
+	id := w.next
+	w.next++
+	w.inFlight[id] = time.Now()
+	w.mu.Unlock()
+
+	return func() {
+		w.mu.Lock()
+		delete(w.inFlight, id)
+		w.mu.Unlock()
+	}
+}
+
+// Check fails if the oldest unit of work has run longer than max.
+func (w *Watchdog) Check(max time.Duration) Check {
+	return func(context.Context) error {
+		w.mu.Lock()
+		var oldest time.Time
+		for _, t := range w.inFlight {
+			if oldest.IsZero() || t.Before(oldest) {
+				oldest = t
+			}
+		}
+		w.mu.Unlock()
+		if !oldest.IsZero() && time.Since(oldest) > max {
+			return fmt.Errorf("processing one message for %s", time.Since(oldest).Round(time.Second))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,167 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Check reports whether a dependency is usable. A nil error means healthy.
+type Check func(ctx context.Context) error
+
+// checkTimeout bounds each individual check so one slow dependency
+// can't hang the probe.
+const checkTimeout = 2 * time.Second
+
+// Handler serves /healthz (liveness) and /readyz (readiness).
+type Handler struct {
+	logger *zap.Logger
+
+	mu        sync.RWMutex
+	liveness  map[string]Check
+	readiness map[string]Check
+	info      map[string]func() string
+
+	draining atomic.Bool
+}
+
+// NewHandler creates a handler with no checks registered.
+func NewHandler(log *zap.Logger) *Handler {
+	return &Handler{
+		logger:    log,
+		liveness:  map[string]Check{},
+		readiness: map[string]Check{},
+		info:      map[string]func() string{},
+	}
+}
+
+// AddLiveness registers a check that, when failing, means the process
+// is stuck and should be restarted.
+func (h *Handler) AddLiveness(name string, c Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.liveness[name] = c
+}
+
+// AddReadiness registers a check that, when failing, means the process
+// should not receive traffic yet.
+func (h *Handler) AddReadiness(name string, c Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.readiness[name] = c
+}
+
+// AddInfo registers a state shown on both probes without affecting
+// their outcome, e.g. a circuit breaker that is open on purpose.
+func (h *Handler) AddInfo(name string, state func() string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.info[name] = state
+}
+
+// Drain marks the service as not ready, so the orchestrator stops
+// routing to it while shutdown is in progress. Its signature lets it be
+// used directly as a lifecycle stop hook.
+func (h *Handler) Drain(context.Context) error {
+	h.draining.Store(true)
+	return nil
+}
+
+// Register mounts /healthz and /readyz on mux.
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.Handle("/healthz", h.Liveness())
+	mux.Handle("/readyz", h.Readiness())
+}
+
+// Liveness returns the /healthz handler.
+func (h *Handler) Liveness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.mu.RLock()
+		checks, info := maps.Clone(h.liveness), maps.Clone(h.info)
+		h.mu.RUnlock()
+		h.serve(w, r, checks, info, false)
+	})
+}
+
+// Readiness returns the /readyz handler.
+func (h *Handler) Readiness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.mu.RLock()
+		checks, info := maps.Clone(h.readiness), maps.Clone(h.info)
+		h.mu.RUnlock()
+		h.serve(w, r, checks, info, h.draining.Load())
+	})
+}
+
+// report is the JSON body of both probes.
+type report struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+	Info   map[string]string `json:"info,omitempty"`
+}
+
+func (h *Handler) serve(w http.ResponseWriter, r *http.Request, checks map[string]Check, info map[string]func() string, draining bool) {
+	results := run(r.Context(), checks)
+
+	rep := report{Status: "ok", Checks: map[string]string{}}
+	code := http.StatusOK
+	names := make([]string, 0, len(results))
+	for name := range results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := results[name]; err != nil {
+			rep.Checks[name] = err.Error()
+			rep.Status = "unavailable"
+			code = http.StatusServiceUnavailable
+			h.logger.Debug("Health check failed", zap.String("check", name), zap.Error(err))
+			continue
+		}
+		rep.Checks[name] = "ok"
+	}
+	if len(info) > 0 {
+		rep.Info = make(map[string]string, len(info))
+		for name, state := range info {
+			rep.Info[name] = state()
+		}
+	}
+	if draining {
+		rep.Status = "draining"
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(rep)
+}
+
+// run executes all checks concurrently, each with its own timeout.
+func run(ctx context.Context, checks map[string]Check) map[string]error {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]error, len(checks))
+	)
+	for name, c := range checks {
+		wg.Add(1)
+		go func(name string, c Check) {
+			defer wg.Done()
+			cctx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+			err := c(cctx)
+			mu.Lock()
+			results[name] = err
+			mu.Unlock()
+		}(name, c)
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,139 @@
+// Package kafkaclient applies the cluster security settings (TLS and
+// SASL) to both Kafka client libraries, so every reader, writer, admin
+// client and Sarama client connects the same way.
+package kafkaclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"time"
+
+	"e-commerce/common/config"
+
+	"github.com/IBM/sarama"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// Conn is a cluster's brokers plus loaded TLS material and SASL
+// credentials. Build it once per process with New and pass it to every
+// client constructor.
+type Conn struct {
+	Brokers []string
+
+	tls       *tls.Config    // nil for plaintext
+	mechanism sasl.Mechanism // kafka-go SASL, nil if disabled
+	sasl      config.KafkaSASL
+}
+
+// New loads the certificates and SASL mechanism described by k.
+func New(k config.Kafka) (*Conn, error) {
+	c := &Conn{Brokers: k.Brokers, sasl: k.SASL}
+
+	if k.TLS.Enabled {
+		tc, err := tlsConfig(k.TLS)
+		if err != nil {
+			return nil, err
+		}
+		c.tls = tc
+	}
+
+	var err error
+	switch k.SASL.Mechanism {
+	case "", "none":
+	case sarama.SASLTypePlaintext:
+		c.mechanism = plain.Mechanism{Username: k.SASL.Username, Password: k.SASL.Password}
+	case sarama.SASLTypeSCRAMSHA256:
+		c.mechanism, err = scram.Mechanism(scram.SHA256, k.SASL.Username, k.SASL.Password)
+	case sarama.SASLTypeSCRAMSHA512:
+		c.mechanism, err = scram.Mechanism(scram.SHA512, k.SASL.Username, k.SASL.Password)
+	default:
+		return nil, fmt.Errorf("unknown SASL mechanism %q", k.SASL.Mechanism)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("sasl %s: %w", k.SASL.Mechanism, err)
+	}
+	return c, nil
+}
+
+func tlsConfig(t config.KafkaTLS) (*tls.Config, error) {
+	tc := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: t.InsecureSkipVerify, //nolint:gosec // dev clusters with self-signed certs
+	}
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading kafka CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", t.CAFile)
+		}
+		tc.RootCAs = pool
+	}
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading kafka client certificate: %w", err)
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	return tc, nil
+}
+
+// Dialer returns a kafka-go dialer for readers, writers and direct
+// connections. clientID may be empty to use the library default.
+func (c *Conn) Dialer(clientID string) *kafka.Dialer {
+	return &kafka.Dialer{
+		ClientID:      clientID,
+		Timeout:       10 * time.Second,
+		DualStack:     true,
+		TLS:           c.tls,
+		SASLMechanism: c.mechanism,
+	}
+}
+
+// Transport returns a kafka-go transport for kafka.Client (admin and
+// group APIs) and kafka.Writer.
+func (c *Conn) Transport(clientID string) *kafka.Transport {
+	return &kafka.Transport{
+		ClientID: clientID,
+		TLS:      c.tls,
+		SASL:     c.mechanism,
+	}
+}
+
+// Client returns a kafka-go client for the admin and group APIs.
+func (c *Conn) Client(clientID string) *kafka.Client {
+	return &kafka.Client{
+		Addr:      kafka.TCP(c.Brokers...),
+		Transport: c.Transport(clientID),
+	}
+}
+
+// Sarama applies TLS and SASL to cfg.Net.
+func (c *Conn) Sarama(cfg *sarama.Config) {
+	if c.tls != nil {
+		cfg.Net.TLS.Enable = true
+		cfg.Net.TLS.Config = c.tls
+	}
+	if c.mechanism == nil {
+		return
+	}
+	cfg.Net.SASL.Enable = true
+	cfg.Net.SASL.Handshake = true
+	cfg.Net.SASL.User = c.sasl.Username
+	cfg.Net.SASL.Password = c.sasl.Password
+	cfg.Net.SASL.Mechanism = sarama.SASLMechanism(c.sasl.Mechanism)
+	switch c.sasl.Mechanism {
+	case sarama.SASLTypeSCRAMSHA256:
+		cfg.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &scramClient{hash: sha256Gen} }
+	case sarama.SASLTypeSCRAMSHA512:
+		cfg.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &scramClient{hash: sha512Gen} }
+	}
+}
@@ -0,0 +1,37 @@
+package kafkaclient
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+
+	"github.com/xdg-go/scram"
+)
+
+var (
+	sha256Gen scram.HashGeneratorFcn = sha256.New
+	sha512Gen scram.HashGeneratorFcn = sha512.New
+)
+
+// scramClient implements sarama.SCRAMClient on top of xdg-go/scram,
+// the same library kafka-go uses for its SCRAM mechanism.
+type scramClient struct {
+	hash scram.HashGeneratorFcn
+	conv *scram.ClientConversation
+}
+
+func (s *scramClient) Begin(user, password, authzID string) error {
+	client, err := s.hash.NewClient(user, password, authzID)
+	if err != nil {
+		return err
+	}
+	s.conv = client.NewConversation()
+	return nil
+}
+
+func (s *scramClient) Step(challenge string) (string, error) {
+	return s.conv.Step(challenge)
+}
+
+func (s *scramClient) Done() bool {
+	return s.conv.Done()
+}
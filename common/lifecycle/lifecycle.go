@@ -0,0 +1,212 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DefaultTimeout bounds the whole shutdown sequence.
+const DefaultTimeout = 15 * time.Second
+
+// Hook is a component's start/stop pair.
+// OnStart hooks run in registration order and must not block;
+// OnStop hooks run in reverse order, so a component registered
+// after its dependencies is stopped before them.
+type Hook struct {
+	Name    string
+	OnStart func(ctx context.Context) error
+	OnStop  func(ctx context.Context) error
+}
+
+// Manager drives the start/stop lifecycle of a service.
+type Manager struct {
+	logger  *zap.Logger
+	timeout time.Duration
+
+	mu      sync.Mutex
+	hooks   []Hook
+	started int // number of hooks whose OnStart succeeded
+
+	failCh   chan error
+	failOnce sync.Once
+}
+
+// New creates a manager whose shutdown is bounded by timeout.
+func New(log *zap.Logger, timeout time.Duration) *Manager {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Manager{
+		logger:  log,
+		timeout: timeout,
+		failCh:  make(chan error, 1),
+	}
+}
+
+// Append registers a hook. Register dependencies first.
+func (m *Manager) Append(h Hook) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = append(m.hooks, h)
+}
+
+// Go registers a long-running worker such as a consumer loop.
+// On start, run is launched in its own goroutine with a context that is
+// canceled on stop. On stop, the manager cancels that context, waits for
+// run to return (so in-flight work can finish and commit), then calls
+// the closers in order. If run returns an error before shutdown begins,
+// the whole service is shut down.
+func (m *Manager) Go(name string, run func(ctx context.Context) error, closers ...func() error) {
+	var (
+		cancel context.CancelFunc
+		done   = make(chan struct{})
+	)
+	m.Append(Hook{
+		Name: name,
+		OnStart: func(_ context.Context) error {
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(context.Background())
+			go func() {
+				defer close(done)
+				if err := run(ctx); err != nil && ctx.Err() == nil {
+					m.Fail(fmt.Errorf("%s: %w", name, err))
+				}
+			}()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			cancel()
+			select {
+			case <-done:
+			case <-ctx.Done():
+				return fmt.Errorf("waiting for %s: %w", name, ctx.Err())
+			}
+			var errs []error
+			for _, c := range closers {
+				errs = append(errs, c())
+			}
+			return errors.Join(errs...)
+		},
+	})
+}
+
+// Closer registers a stop-only hook, e.g. a producer flush.
+func (m *Manager) Closer(name string, close func() error) {
+	m.Append(Hook{
+		Name:   name,
+		OnStop: func(context.Context) error { return close() },
+	})
+}
+
+// Fail triggers a shutdown from inside a component. Only the first
+// failure is reported.
+func (m *Manager) Fail(err error) {
+	m.failOnce.Do(func() { m.failCh <- err })
+}
+
+// Start runs every OnStart hook in order. If one fails, the hooks
+// already started are stopped and the error is returned.
+func (m *Manager) Start(ctx context.Context) error {
+	m.mu.Lock()
+	hooks := append([]Hook(nil), m.hooks...)
+	m.mu.Unlock()
+
+	for i, h := range hooks {
+		if h.OnStart != nil {
+			m.logger.Debug("Starting component", zap.String("component", h.Name))
+			if err := h.OnStart(ctx); err != nil {
+				m.setStarted(i)
+				return errors.Join(fmt.Errorf("starting %s: %w", h.Name, err), m.Stop())
+			}
+		}
+	}
+	m.setStarted(len(hooks))
+	return nil
+}
+
+func (m *Manager) setStarted(n int) {
+	m.mu.Lock()
+	m.started = n
+	m.mu.Unlock()
+}
+
+// Stop runs the OnStop hooks of started components in reverse order,
+// all sharing one deadline. A hook that overruns the deadline is
+// reported, and the remaining hooks still get a chance to run.
+func (m *Manager) Stop() error {
+	m.mu.Lock()
+	hooks := m.hooks[:m.started]
+	m.started = 0
+	m.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		h := hooks[i]
+		if h.OnStop == nil {
+			continue
+		}
+		start := time.Now()
+		if err := h.OnStop(ctx); err != nil {
+			m.logger.Error("Component stop failed", zap.String("component", h.Name), zap.Error(err))
+			errs = append(errs, fmt.Errorf("stopping %s: %w", h.Name, err))
+			continue
+		}
+		m.logger.Info("Component stopped",
+			zap.String("component", h.Name),
+			zap.Duration("took", time.Since(start)),
+		)
+	}
+	return errors.Join(errs...)
+}
+
+// Run starts all components, blocks until SIGINT/SIGTERM or a component
+// failure, then stops everything within the shutdown deadline.
+func (m *Manager) Run() error {
+	if err := m.Start(context.Background()); err != nil {
+		return err
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	var cause error
+	select {
+	case s := <-sig:
+		m.logger.Info("Shutdown signal received", zap.String("signal", s.String()))
+	case cause = <-m.failCh:
+		m.logger.Error("Component failed, shutting down", zap.Error(cause))
+	}
+
+	return errors.Join(cause, m.Stop())
+}
+
+// HTTPServer registers an http.Server: it starts listening on start and
+// drains open connections on stop.
+func (m *Manager) HTTPServer(name string, srv *http.Server) {
+	m.Append(Hook{
+		Name: name,
+		OnStart: func(context.Context) error {
+			go func() {
+				if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					m.Fail(fmt.Errorf("%s: %w", name, err))
+				}
+			}()
+			m.logger.Info("HTTP server started", zap.String("component", name), zap.String("addr", srv.Addr))
+			return nil
+		},
+		OnStop: srv.Shutdown,
+	})
+}
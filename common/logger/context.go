@@ -0,0 +1,44 @@
+package logger
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+type loggerKey struct{}
+
+// NewContext returns ctx carrying log, for handlers further down the chain.
+func NewContext(ctx context.Context, log *zap.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, log)
+}
+
+// FromContext returns the logger stored by NewContext, or fallback
+// annotated with whatever IDs ctx carries.
+func FromContext(ctx context.Context, fallback *zap.Logger) *zap.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*zap.Logger); ok {
+		return l
+	}
+	return WithContext(ctx, fallback)
+}
+
+// WithContext returns log annotated with the trace/span IDs and the
+// request ID carried by ctx, so log lines from every service handling
+// one order can be joined. Fields absent from ctx are omitted.
+func WithContext(ctx context.Context, log *zap.Logger) *zap.Logger {
+	var fields []zap.Field
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		fields = append(fields,
+			zap.String("trace_id", sc.TraceID().String()),
+			zap.String("span_id", sc.SpanID().String()),
+		)
+	}
+	if id := RequestIDFromContext(ctx); id != "" {
+		fields = append(fields, zap.String("request_id", id))
+	}
+	if len(fields) == 0 {
+		return log
+	}
+	return log.With(fields...)
+}
@@ -1,13 +1,17 @@
 package logger
 
 import (
+	"strconv"
 	"time"
 
+	"e-commerce/common/metrics"
+
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
-// GinZapMiddleware logs each HTTP request with zap.
+// GinZapMiddleware logs each HTTP request with zap and records its
+// latency in the HTTP request histogram.
 func GinZapMiddleware(logger *zap.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
@@ -20,7 +24,14 @@ func GinZapMiddleware(logger *zap.Logger) gin.HandlerFunc {
 		// After request
 		latency := time.Since(start)
 		status := c.Writer.Status()
-		logger.Info("HTTP request",
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched" // keep label cardinality bounded
+		}
+		metrics.HTTPRequestDuration.
+			WithLabelValues(method, route, strconv.Itoa(status)).
+			Observe(latency.Seconds())
+		WithContext(c.Request.Context(), logger).Info("HTTP request",
 			zap.String("method", method),
 			zap.String("path", path),
 			zap.Int("status", status),
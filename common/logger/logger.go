@@ -1,6 +1,8 @@
 package logger
 
 import (
+	"e-commerce/common/config"
+
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -8,6 +10,13 @@ import (
 // NewLogger creates a zap.Logger based on the desired level.
 // In "dev" we use Console encoder; in "prod", JSON.
 func NewLogger(env, level string) (*zap.Logger, error) {
+	log, _, err := NewLeveled(env, level)
+	return log, err
+}
+
+// NewLeveled is NewLogger that also returns the logger's AtomicLevel,
+// so the level can be changed while the service runs.
+func NewLeveled(env, level string) (*zap.Logger, zap.AtomicLevel, error) {
 	var cfg zap.Config
 	if env == "prod" {
 		cfg = zap.NewProductionConfig()
@@ -21,8 +30,20 @@ func NewLogger(env, level string) (*zap.Logger, error) {
 	// Parse and set level
 	lvl := zapcore.InfoLevel
 	if err := lvl.Set(level); err != nil {
-		return nil, err
+		return nil, zap.AtomicLevel{}, err
 	}
 	cfg.Level = zap.NewAtomicLevelAt(lvl)
-	return cfg.Build()
+	log, err := cfg.Build()
+	return log, cfg.Level, err
+}
+
+// WatchLevel keeps lvl in sync with log_level across config reloads.
+func WatchLevel(rt *config.Runtime, log *zap.Logger, lvl zap.AtomicLevel) {
+	config.OnChange(rt, func(c *config.Config) string { return c.LogLevel }, func(level string) {
+		if err := lvl.UnmarshalText([]byte(level)); err != nil {
+			log.Error("Invalid log level, keeping current", zap.String("level", level), zap.Error(err))
+			return
+		}
+		log.Info("Log level changed", zap.String("level", level))
+	})
 }
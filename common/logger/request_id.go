@@ -0,0 +1,96 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/propagation"
+	"go.uber.org/zap"
+)
+
+// RequestIDHeader is used both on HTTP requests/responses and as the
+// Kafka message header carrying the ID between services.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLen caps client-supplied IDs so they can't bloat logs.
+const maxRequestIDLen = 128
+
+type requestIDKey struct{}
+
+// WithRequestID returns ctx carrying the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID carried by ctx, if any.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// NewRequestID returns a random 128-bit hex ID.
+func NewRequestID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// validRequestID accepts short, printable ASCII IDs only.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestIDMiddleware accepts the caller's X-Request-ID or generates
+// one, echoes it on the response, and stores both the ID and a child
+// logger carrying it in the request context. Register it after the
+// tracing middleware so the child logger also carries the trace ID.
+func RequestIDMiddleware(log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = NewRequestID()
+		}
+		c.Header(RequestIDHeader, id)
+
+		ctx := WithRequestID(c.Request.Context(), id)
+		ctx = NewContext(ctx, WithContext(ctx, log))
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// RequestIDPropagator carries the request ID across process boundaries
+// (Kafka headers) alongside the W3C trace context.
+type RequestIDPropagator struct{}
+
+var _ propagation.TextMapPropagator = RequestIDPropagator{}
+
+// Inject writes the request ID of ctx into carrier.
+func (RequestIDPropagator) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	if id := RequestIDFromContext(ctx); id != "" {
+		carrier.Set(RequestIDHeader, id)
+	}
+}
+
+// Extract returns ctx carrying the request ID found in carrier.
+func (RequestIDPropagator) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	if id := carrier.Get(RequestIDHeader); validRequestID(id) {
+		return WithRequestID(ctx, id)
+	}
+	return ctx
+}
+
+// Fields lists the header keys this propagator uses.
+func (RequestIDPropagator) Fields() []string {
+	return []string{RequestIDHeader}
+}
@@ -0,0 +1,229 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Namespace prefixes every metric exported by our services.
+const Namespace = "ecommerce"
+
+var (
+	// HTTPRequestDuration observes request latency by route and status.
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method, route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// PublishAttempts counts every write attempt to Kafka, retries included.
+	PublishAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "publish_attempts_total",
+		Help:      "Kafka publish attempts, including retries.",
+	}, []string{"topic"})
+
+	// PublishRetries counts attempts that failed and were retried.
+	PublishRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "publish_retries_total",
+		Help:      "Kafka publish attempts that failed and were retried.",
+	}, []string{"topic"})
+
+	// PublishFailures counts publishes given up on.
+	PublishFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "publish_failures_total",
+		Help:      "Kafka publishes that failed after all retries.",
+	}, []string{"topic"})
+
+	// MessagesConsumed counts messages fetched by consumers.
+	MessagesConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "messages_consumed_total",
+		Help:      "Messages fetched from Kafka.",
+	}, []string{"topic"})
+
+	// MessagesCommitted counts messages whose offset was committed or marked.
+	MessagesCommitted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "messages_committed_total",
+		Help:      "Messages whose offset was committed.",
+	}, []string{"topic"})
+
+	// MessagesDeadLettered counts messages dropped as unprocessable.
+	MessagesDeadLettered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "messages_dead_lettered_total",
+		Help:      "Messages skipped as unprocessable (poison messages).",
+	}, []string{"topic"})
+
+	// MessagesFailed counts messages whose handler returned an error.
+	// They are not retried or dead-lettered: the offset is committed.
+	MessagesFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "messages_failed_total",
+		Help:      "Messages whose processing failed; their offsets are still committed.",
+	}, []string{"topic"})
+
+	// ProcessingDuration observes how long handling one message takes.
+	ProcessingDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "message_processing_seconds",
+		Help:      "Time spent handling one consumed message.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"topic"})
+
+	// DedupeHits counts events skipped because they were already seen.
+	DedupeHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "dedupe_hits_total",
+		Help:      "Events skipped as duplicates.",
+	}, []string{"component"})
+
+	// StockLevel reports the available quantity per SKU.
+	StockLevel = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "stock_level",
+		Help:      "Available stock per SKU.",
+	}, []string{"sku"})
+
+	// ConsumerLag reports, per partition, how many messages sit between
+	// the last consumed offset and the high-water mark.
+	ConsumerLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "consumer_lag_messages",
+		Help:      "In-process consumer lag per topic partition.",
+	}, []string{"topic", "partition"})
+
+	// GroupLag is the lag monitor's view of each group's partitions:
+	// committed offset to high-water mark.
+	GroupLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "consumer_group_lag_messages",
+		Help:      "Messages between a group's committed offset and the high-water mark.",
+	}, []string{"group", "topic", "partition"})
+
+	// GroupLagSeconds is the age of the oldest message a group has not
+	// yet consumed, per partition; 0 when caught up.
+	GroupLagSeconds = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "consumer_group_lag_seconds",
+		Help:      "Estimated seconds a group is behind, per partition.",
+	}, []string{"group", "topic", "partition"})
+
+	// LagAlerts counts alerts published by the lag monitor.
+	LagAlerts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "lag_alerts_total",
+		Help:      "Consumer lag alerts published, by group and severity.",
+	}, []string{"group", "severity"})
+
+	// SinkRows counts rows (or JSONL records) written by the sink runner.
+	SinkRows = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "sink_rows_written_total",
+		Help:      "Rows written by each sink of the sink runner.",
+	}, []string{"sink"})
+
+	// WebhookAttempts counts HTTP attempts to partner webhooks by
+	// outcome: "delivered", "retried" or "failed".
+	WebhookAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "webhook_attempts_total",
+		Help:      "Outbound webhook attempts, by outcome.",
+	}, []string{"outcome"})
+
+	// NotificationsRouted counts per-user notifications by channel and
+	// outcome: "queued" (handed to the channel's workers), "sent",
+	// "failed", "deferred" (quiet hours), "opted_out", "no_channel",
+	// "digested" (over a rate limit, queued for a digest), "rate_limited"
+	// (over a rate limit, dropped) or "unavailable" (the channel's circuit
+	// was open or its bulkhead full; held and retried).
+	NotificationsRouted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "notifications_routed_total",
+		Help:      "Notifications routed to user channels, by channel and outcome.",
+	}, []string{"channel", "outcome"})
+
+	// NotificationDigests counts digests by channel and outcome: "sent"
+	// or "failed".
+	NotificationDigests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "notification_digests_total",
+		Help:      "Digests of rate-limited notifications, by channel and outcome.",
+	}, []string{"channel", "outcome"})
+
+	// ChannelCircuitState is each notification channel's circuit
+	// breaker: 0 closed, 1 half-open, 2 open.
+	ChannelCircuitState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "notification_channel_circuit_state",
+		Help:      "Circuit breaker state per notification channel (0 closed, 1 half-open, 2 open).",
+	}, []string{"channel"})
+
+	// ChannelInFlight is the number of sends in progress per channel.
+	ChannelInFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "notification_channel_in_flight",
+		Help:      "Notification sends in progress, by channel.",
+	}, []string{"channel"})
+
+	// ChannelRejections counts sends a channel refused without trying,
+	// by reason: "circuit_open", "bulkhead_full" or "stopping".
+	ChannelRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "notification_channel_rejections_total",
+		Help:      "Notification sends refused by a channel's circuit breaker or bulkhead, by channel and reason.",
+	}, []string{"channel", "reason"})
+
+	// OpsAlertsPosted counts inventory failure alerts posted to chat, by
+	// severity and outcome: "sent" or "failed".
+	OpsAlertsPosted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "ops_alerts_posted_total",
+		Help:      "Inventory failure alerts posted to the ops chat webhook, by severity and outcome.",
+	}, []string{"severity", "outcome"})
+
+	// NotificationResends counts operator resends by outcome:
+	// "delivered", "failed", "unavailable" (the channel refused it) or
+	// "not_audited" (refused because the audit event could not be
+	// published).
+	NotificationResends = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "notification_resends_total",
+		Help:      "Operator resends of notifications, by outcome.",
+	}, []string{"outcome"})
+
+	// WebhooksDisabled counts endpoints disabled after repeated failures.
+	WebhooksDisabled = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "webhooks_disabled_total",
+		Help:      "Webhook subscriptions disabled after repeated failed deliveries.",
+	})
+)
+
+// Handler serves the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Register mounts /metrics on mux.
+func Register(mux *http.ServeMux) {
+	mux.Handle("/metrics", Handler())
+}
+
+// ObserveLag records consumer lag from a message's offset and its
+// partition's high-water mark (the offset of the next message to be written).
+func ObserveLag(topic string, partition int, offset, highWaterMark int64) {
+	lag := highWaterMark - offset - 1
+	if lag < 0 {
+		lag = 0
+	}
+	ConsumerLag.WithLabelValues(topic, strconv.Itoa(partition)).Set(float64(lag))
+}
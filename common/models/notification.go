@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// NotificationResent is published to notifications.resent when an
+// operator resends a notification, before it is sent, so the audit log
+// records every intentional duplicate.
+type NotificationResent struct {
+	NotificationID string    `json:"notification_id"` // the new delivery
+	ResendOf       string    `json:"resend_of"`       // the delivery being repeated
+	OrderID        string    `json:"order_id"`
+	UserID         string    `json:"user_id,omitempty"`
+	Kind           string    `json:"kind"`
+	Channel        string    `json:"channel"`
+	RequestedBy    string    `json:"requested_by"`
+	Reason         string    `json:"reason"`
+	Time           time.Time `json:"time"`
+}
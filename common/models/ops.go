@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Alert severities. Resolved is sent once when a condition clears.
+const (
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+	SeverityResolved = "resolved"
+)
+
+// OpsAlert is published to ops.alerts when an operational threshold is
+// crossed or clears. It is keyed by Subject so every alert about the
+// same thing lands on one partition, in order.
+type OpsAlert struct {
+	Source   string         `json:"source"`   // emitting component, e.g. "lagmonitor"
+	Kind     string         `json:"kind"`     // e.g. "consumer_lag"
+	Severity string         `json:"severity"` // SeverityWarning, SeverityCritical or SeverityResolved
+	Subject  string         `json:"subject"`  // what it concerns, e.g. a consumer group
+	Summary  string         `json:"summary"`
+	Details  map[string]any `json:"details,omitempty"`
+	Time     time.Time      `json:"time"`
+}
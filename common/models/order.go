@@ -1,5 +1,14 @@
 package models
 
+// Event type names, used in event IDs (see dedupe.EventID) and by the
+// audit log.
+const (
+	TypeOrderCreated       = "OrderCreated"
+	TypeInventoryReserved  = "InventoryReserved"
+	TypeInventoryFailed    = "InventoryFailed"
+	TypeNotificationResent = "NotificationResent"
+)
+
 // OrderCreated is emitted by the Order service.
 type OrderCreated struct {
 	OrderID string   `json:"order_id"`
@@ -11,12 +20,16 @@ type OrderCreated struct {
 // InventoryReserved is emitted when stock reservation succeeds.
 type InventoryReserved struct {
 	OrderID string   `json:"order_id"`
+	UserID  string   `json:"user_id"` // carried over from OrderCreated; empty for events produced before it was added
 	Items   []string `json:"items"`
+	Total   float64  `json:"total,omitempty"` // carried over from OrderCreated, like UserID
 }
 
 // InventoryFailed is emitted when any item is out of stock.
 type InventoryFailed struct {
 	OrderID string   `json:"order_id"`
+	UserID  string   `json:"user_id"` // carried over from OrderCreated; empty for events produced before it was added
 	Items   []string `json:"items"`
+	Total   float64  `json:"total,omitempty"` // carried over from OrderCreated, like UserID
 	Reason  string   `json:"reason"`
 }
@@ -0,0 +1,65 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"e-commerce/common/exactlyonce"
+	"e-commerce/common/kafkaclient"
+
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+// Handler writes one batch inside tx. The consumer stores the batch's
+// offsets in the same transaction and commits it; if Handler fails,
+// nothing is stored and the batch is retried.
+type Handler func(ctx context.Context, tx *sql.Tx, msgs []kafka.Message) error
+
+// NewConsumer creates an exactly-once consumer whose batches go through
+// handle, with offsets in the kafka_offsets table of db.
+func NewConsumer(conn *kafkaclient.Conn, db *DB, groupID, clientID string, topics []string,
+	batchSize int, flushInterval time.Duration, handle Handler, log *zap.Logger) *exactlyonce.Consumer {
+	return exactlyonce.New(conn, NewStore(db, handle), groupID, clientID, topics, batchSize, flushInterval, log)
+}
+
+// Store is an exactlyonce.Store on a SQL database: each batch and its
+// offsets are one transaction.
+type Store struct {
+	db     *DB
+	handle Handler
+}
+
+// NewStore creates a Store writing batches through handle.
+func NewStore(db *DB, handle Handler) *Store {
+	return &Store{db: db, handle: handle}
+}
+
+// Init creates the offsets table.
+func (s *Store) Init(ctx context.Context) error {
+	return EnsureOffsetsTable(ctx, s.db)
+}
+
+// Offsets loads the stored offsets of topic.
+func (s *Store) Offsets(ctx context.Context, group, topic string) (map[int]int64, error) {
+	return LoadOffsets(ctx, s.db, group, topic)
+}
+
+// Write runs the handler and advances the offsets in one transaction.
+func (s *Store) Write(ctx context.Context, group string, batch []kafka.Message, ranges []exactlyonce.Range) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := s.handle(ctx, tx, batch); err != nil {
+		return err
+	}
+	for _, r := range ranges {
+		if err := advanceOffset(ctx, s.db, tx, group, r.Topic, r.Partition, r.From, r.To); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,136 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"maps"
+	"testing"
+
+	"e-commerce/common/exactlyonce"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// newTestStore returns a Store on an in-memory SQLite database whose
+// handler inserts each message's value into table rows.
+func newTestStore(t *testing.T) (*Store, *DB) {
+	t.Helper()
+	ctx := context.Background()
+	db, err := Open(ctx, SQLite, ":memory:")
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.ExecContext(ctx, `CREATE TABLE rows (value TEXT NOT NULL)`); err != nil {
+		t.Fatalf("creating table: %v", err)
+	}
+	s := NewStore(db, func(ctx context.Context, tx *sql.Tx, msgs []kafka.Message) error {
+		for _, m := range msgs {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO rows (value) VALUES (?)`, string(m.Value)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err := s.Init(ctx); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	return s, db
+}
+
+func countRows(t *testing.T, db *DB) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRowContext(context.Background(), `SELECT COUNT(*) FROM rows`).Scan(&n); err != nil {
+		t.Fatalf("counting rows: %v", err)
+	}
+	return n
+}
+
+func batch(values ...string) []kafka.Message {
+	msgs := make([]kafka.Message, len(values))
+	for i, v := range values {
+		msgs[i] = kafka.Message{Topic: "orders", Value: []byte(v)}
+	}
+	return msgs
+}
+
+func TestStoreWriteFencesStaleOffsets(t *testing.T) {
+	s, db := newTestStore(t)
+	ctx := context.Background()
+	if err := s.Write(ctx, "g", batch("a", "b"), []exactlyonce.Range{{Topic: "orders", Partition: 0, From: -1, To: 2}}); err != nil {
+		t.Fatalf("first write: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		from, to int64
+		fenced   bool
+	}{
+		{"another member also read no offset", -1, 3, true},
+		{"another member read an older offset", 1, 3, true},
+		{"ahead of the stored offset", 3, 4, true},
+		{"from the stored offset", 2, 3, false},
+		{"from the offset just stored", 3, 5, false},
+	}
+	rows, next := 2, int64(2)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.Write(ctx, "g", batch("c"), []exactlyonce.Range{{Topic: "orders", Partition: 0, From: tt.from, To: tt.to}})
+			if tt.fenced {
+				if !errors.Is(err, exactlyonce.ErrFenced) {
+					t.Fatalf("Write = %v, want ErrFenced", err)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Write: %v", err)
+				}
+				rows, next = rows+1, tt.to
+			}
+			// A fenced batch leaves neither rows nor offsets behind
+			if got := countRows(t, db); got != rows {
+				t.Errorf("rows = %d, want %d", got, rows)
+			}
+			offs, err := s.Offsets(ctx, "g", "orders")
+			if err != nil {
+				t.Fatalf("Offsets: %v", err)
+			}
+			if want := map[int]int64{0: next}; !maps.Equal(offs, want) {
+				t.Errorf("offsets = %v, want %v", offs, want)
+			}
+		})
+	}
+}
+
+func TestStoreWriteIsAllOrNothing(t *testing.T) {
+	s, db := newTestStore(t)
+	ctx := context.Background()
+	if err := s.Write(ctx, "g", batch("a"), []exactlyonce.Range{{Topic: "orders", Partition: 0, From: -1, To: 1}}); err != nil {
+		t.Fatalf("first write: %v", err)
+	}
+	// The second range is fenced, so the first one's offset and the rows
+	// written for the batch must be rolled back too
+	err := s.Write(ctx, "g", batch("b", "c"), []exactlyonce.Range{
+		{Topic: "orders", Partition: 1, From: -1, To: 1},
+		{Topic: "orders", Partition: 0, From: 0, To: 2},
+	})
+	if !errors.Is(err, exactlyonce.ErrFenced) {
+		t.Fatalf("Write = %v, want ErrFenced", err)
+	}
+	if got := countRows(t, db); got != 1 {
+		t.Errorf("rows = %d, want 1", got)
+	}
+	offs, err := s.Offsets(ctx, "g", "orders")
+	if err != nil {
+		t.Fatalf("Offsets: %v", err)
+	}
+	if want := map[int]int64{0: 1}; !maps.Equal(offs, want) {
+		t.Errorf("offsets = %v, want %v", offs, want)
+	}
+
+	// Offsets are per group
+	if err := s.Write(ctx, "other", batch("d"), []exactlyonce.Range{{Topic: "orders", Partition: 0, From: -1, To: 1}}); err != nil {
+		t.Errorf("write of another group: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"e-commerce/common/exactlyonce"
+)
+
+const offsetsSchema = `
+CREATE TABLE IF NOT EXISTS kafka_offsets (
+	consumer    TEXT    NOT NULL,
+	topic       TEXT    NOT NULL,
+	partition   INTEGER NOT NULL,
+	next_offset BIGINT  NOT NULL,
+	PRIMARY KEY (consumer, topic, partition)
+)`
+
+// EnsureOffsetsTable creates the kafka_offsets table if it is missing.
+func EnsureOffsetsTable(ctx context.Context, db *DB) error {
+	_, err := db.ExecContext(ctx, offsetsSchema)
+	return err
+}
+
+// LoadOffsets returns the next offset to read for every stored
+// partition of topic.
+func LoadOffsets(ctx context.Context, db *DB, consumer, topic string) (map[int]int64, error) {
+	rows, err := db.QueryContext(ctx, db.Rebind(
+		`SELECT partition, next_offset FROM kafka_offsets WHERE consumer = ? AND topic = ?`), consumer, topic)
+	if err != nil {
+		return nil, fmt.Errorf("loading offsets for %s: %w", topic, err)
+	}
+	defer rows.Close()
+	out := map[int]int64{}
+	for rows.Next() {
+		var p int
+		var off int64
+		if err := rows.Scan(&p, &off); err != nil {
+			return nil, err
+		}
+		out[p] = off
+	}
+	return out, rows.Err()
+}
+
+// advanceOffset moves a partition from next offset from (-1 if nothing
+// was stored) to to, inside tx. It fails with exactlyonce.ErrFenced if
+// the stored value is no longer from.
+func advanceOffset(ctx context.Context, db *DB, tx *sql.Tx, consumer, topic string, partition int, from, to int64) error {
+	var (
+		res sql.Result
+		err error
+	)
+	if from < 0 {
+		res, err = tx.ExecContext(ctx, db.Rebind(
+			`INSERT INTO kafka_offsets (consumer, topic, partition, next_offset) VALUES (?, ?, ?, ?)
+			 ON CONFLICT (consumer, topic, partition) DO NOTHING`),
+			consumer, topic, partition, to)
+	} else {
+		res, err = tx.ExecContext(ctx, db.Rebind(
+			`UPDATE kafka_offsets SET next_offset = ? WHERE consumer = ? AND topic = ? AND partition = ? AND next_offset = ?`),
+			to, consumer, topic, partition, from)
+	}
+	if err != nil {
+		return fmt.Errorf("storing offset for %s/%d: %w", topic, partition, err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n != 1 {
+		return exactlyonce.Fenced(topic, partition)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+// Package sqldb opens the SQL databases services write to (SQLite for
+// local runs, Postgres in deployed environments) and consumes Kafka
+// into them with the consumed offsets stored in the same transaction
+// as the data, so a restart resumes exactly after the last stored
+// batch.
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	_ "github.com/jackc/pgx/v5/stdlib" // "pgx" driver
+	_ "modernc.org/sqlite"             // "sqlite" driver
+)
+
+// Drivers accepted by Open.
+const (
+	SQLite   = "sqlite"
+	Postgres = "postgres"
+)
+
+// DB is a database handle that knows its dialect. Queries are written
+// with ? placeholders and SQL both SQLite and Postgres accept; Rebind
+// adapts the placeholders.
+type DB struct {
+	*sql.DB
+	Driver string
+}
+
+// Open connects to dsn with driver "sqlite" (a file path, or ":memory:")
+// or "postgres" (a postgres:// URL) and checks the connection.
+func Open(ctx context.Context, driver, dsn string) (*DB, error) {
+	var (
+		db  *sql.DB
+		err error
+	)
+	switch driver {
+	case SQLite:
+		// WAL lets readers run alongside the writer; the busy timeout
+		// covers the short write lock instead of failing with SQLITE_BUSY.
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		db, err = sql.Open("sqlite", dsn+sep+"_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)")
+		if err == nil {
+			// SQLite allows one writer; queueing in database/sql beats
+			// retrying on lock errors.
+			db.SetMaxOpenConns(1)
+		}
+	case Postgres:
+		db, err = sql.Open("pgx", dsn)
+	default:
+		return nil, fmt.Errorf("unknown database driver %q (want %s or %s)", driver, SQLite, Postgres)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connecting to %s database: %w", driver, err)
+	}
+	return &DB{DB: db, Driver: driver}, nil
+}
+
+// Rebind rewrites ? placeholders as $1, $2, ... for Postgres. It does
+// not look inside string literals, so queries must not contain a
+// literal "?".
+func (db *DB) Rebind(query string) string {
+	if db.Driver != Postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Ping is a readiness check.
+func (db *DB) Ping(ctx context.Context) error {
+	return db.PingContext(ctx)
+}
@@ -0,0 +1,162 @@
+package tracing
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/IBM/sarama"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// kafkaGoCarrier adapts kafka-go message headers to a TextMapCarrier.
+type kafkaGoCarrier struct {
+	headers *[]kafka.Header
+}
+
+func (c kafkaGoCarrier) Get(key string) string {
+	for _, h := range *c.headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (c kafkaGoCarrier) Set(key, value string) {
+	for i, h := range *c.headers {
+		if h.Key == key {
+			(*c.headers)[i].Value = []byte(value)
+			return
+		}
+	}
+	*c.headers = append(*c.headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+func (c kafkaGoCarrier) Keys() []string {
+	keys := make([]string, 0, len(*c.headers))
+	for _, h := range *c.headers {
+		keys = append(keys, h.Key)
+	}
+	return keys
+}
+
+// saramaProducerCarrier adapts outgoing Sarama headers.
+type saramaProducerCarrier struct {
+	msg *sarama.ProducerMessage
+}
+
+func (c saramaProducerCarrier) Get(key string) string {
+	for _, h := range c.msg.Headers {
+		if string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (c saramaProducerCarrier) Set(key, value string) {
+	for i, h := range c.msg.Headers {
+		if string(h.Key) == key {
+			c.msg.Headers[i].Value = []byte(value)
+			return
+		}
+	}
+	c.msg.Headers = append(c.msg.Headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
+
+func (c saramaProducerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.msg.Headers))
+	for _, h := range c.msg.Headers {
+		keys = append(keys, string(h.Key))
+	}
+	return keys
+}
+
+// saramaConsumerCarrier adapts incoming Sarama headers (read-only).
+type saramaConsumerCarrier struct {
+	msg *sarama.ConsumerMessage
+}
+
+func (c saramaConsumerCarrier) Get(key string) string {
+	for _, h := range c.msg.Headers {
+		if h != nil && string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (c saramaConsumerCarrier) Set(string, string) {}
+
+func (c saramaConsumerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.msg.Headers))
+	for _, h := range c.msg.Headers {
+		if h != nil {
+			keys = append(keys, string(h.Key))
+		}
+	}
+	return keys
+}
+
+// InjectKafka writes the trace context of ctx into a kafka-go message.
+func InjectKafka(ctx context.Context, msg *kafka.Message) {
+	otel.GetTextMapPropagator().Inject(ctx, kafkaGoCarrier{headers: &msg.Headers})
+}
+
+// ExtractKafka returns ctx carrying the trace context of a kafka-go message.
+func ExtractKafka(ctx context.Context, msg *kafka.Message) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, kafkaGoCarrier{headers: &msg.Headers})
+}
+
+// InjectSarama writes the trace context of ctx into a Sarama message.
+func InjectSarama(ctx context.Context, msg *sarama.ProducerMessage) {
+	otel.GetTextMapPropagator().Inject(ctx, saramaProducerCarrier{msg: msg})
+}
+
+// ExtractSarama returns ctx carrying the trace context of a Sarama message.
+func ExtractSarama(ctx context.Context, msg *sarama.ConsumerMessage) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, saramaConsumerCarrier{msg: msg})
+}
+
+// StartPublish starts a producer span for a message about to be sent.
+// Inject the returned context into the message before sending.
+func StartPublish(ctx context.Context, tracer trace.Tracer, topic, key string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, topic+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			semconv.MessagingOperationTypePublish,
+			semconv.MessagingDestinationName(topic),
+			semconv.MessagingKafkaMessageKey(key),
+		),
+	)
+}
+
+// StartProcess starts a consumer span for a received message. ctx
+// should already carry the extracted upstream trace context.
+func StartProcess(ctx context.Context, tracer trace.Tracer, topic string, partition int, offset int64, key string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, topic+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			semconv.MessagingOperationTypeDeliver,
+			semconv.MessagingDestinationName(topic),
+			semconv.MessagingDestinationPartitionID(strconv.Itoa(partition)),
+			semconv.MessagingKafkaMessageOffset(int(offset)),
+			semconv.MessagingKafkaMessageKey(key),
+		),
+	)
+}
+
+// End records err (if any) on span and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
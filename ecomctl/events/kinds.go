@@ -0,0 +1,165 @@
+// Package events knows the platform's event types well enough to build
+// them from flags or files.
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"e-commerce/common/config"
+	"e-commerce/common/models"
+)
+
+// Kind is one typed event the services exchange.
+type Kind struct {
+	Name  string
+	Type  string // models.Type* name, used in the event ID
+	Topic func(config.Topics) string
+	New   func() any // pointer to a zero event
+}
+
+// Kinds lists the events ecomctl can produce, by CLI name.
+var Kinds = map[string]Kind{
+	"order-created": {
+		Name:  "order-created",
+		Type:  models.TypeOrderCreated,
+		Topic: func(t config.Topics) string { return t.OrdersCreated },
+		New:   func() any { return &models.OrderCreated{} },
+	},
+	"inventory-reserved": {
+		Name:  "inventory-reserved",
+		Type:  models.TypeInventoryReserved,
+		Topic: func(t config.Topics) string { return t.InventoryEvents },
+		New:   func() any { return &models.InventoryReserved{} },
+	},
+	"inventory-failed": {
+		Name:  "inventory-failed",
+		Type:  models.TypeInventoryFailed,
+		Topic: func(t config.Topics) string { return t.InventoryEvents },
+		New:   func() any { return &models.InventoryFailed{} },
+	},
+}
+
+// KindNames returns the sorted names of Kinds.
+func KindNames() []string {
+	names := make([]string, 0, len(Kinds))
+	for n := range Kinds {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Fields are the values that can be set from flags. Fields that do not
+// apply to the kind are ignored; Build reports the ones that are
+// required but missing.
+type Fields struct {
+	OrderID string
+	UserID  string
+	Items   []string
+	Total   float64
+	Reason  string
+}
+
+// Build returns the event of kind k populated from f.
+func (k Kind) Build(f Fields) (any, error) {
+	if f.OrderID == "" {
+		return nil, errors.New("order ID is required")
+	}
+	switch k.Name {
+	case "order-created":
+		if f.UserID == "" {
+			return nil, errors.New("user ID is required for order-created")
+		}
+		return &models.OrderCreated{OrderID: f.OrderID, UserID: f.UserID, Items: f.Items, Total: f.Total}, nil
+	case "inventory-reserved":
+		return &models.InventoryReserved{OrderID: f.OrderID, UserID: f.UserID, Items: f.Items, Total: f.Total}, nil
+	case "inventory-failed":
+		if f.Reason == "" {
+			return nil, errors.New("reason is required for inventory-failed")
+		}
+		return &models.InventoryFailed{OrderID: f.OrderID, UserID: f.UserID, Items: f.Items, Total: f.Total, Reason: f.Reason}, nil
+	}
+	return nil, fmt.Errorf("unknown event kind %q", k.Name)
+}
+
+// ReadAll parses events of kind k from r, which holds a JSON array, a
+// single object, or one object per line. Unknown fields are rejected
+// so typos do not silently produce empty values.
+func (k Kind) ReadAll(r io.Reader) ([]any, error) {
+	br := bufio.NewReader(r)
+	first, err := peekNonSpace(br)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(br)
+	dec.DisallowUnknownFields()
+
+	var raws []json.RawMessage
+	if first == '[' {
+		if err := dec.Decode(&raws); err != nil {
+			return nil, err
+		}
+	} else {
+		for {
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			raws = append(raws, raw)
+		}
+	}
+
+	out := make([]any, 0, len(raws))
+	for i, raw := range raws {
+		evt := k.New()
+		d := json.NewDecoder(bytes.NewReader(raw))
+		d.DisallowUnknownFields()
+		if err := d.Decode(evt); err != nil {
+			return nil, fmt.Errorf("event %d: %w", i+1, err)
+		}
+		if OrderID(evt) == "" {
+			return nil, fmt.Errorf("event %d: order_id is required", i+1)
+		}
+		out = append(out, evt)
+	}
+	return out, nil
+}
+
+func peekNonSpace(br *bufio.Reader) (byte, error) {
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return 0, errors.New("no events in input")
+			}
+			return 0, err
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return b, br.UnreadByte()
+	}
+}
+
+// OrderID returns the order ID of a typed event, which is also its
+// message key.
+func OrderID(evt any) string {
+	switch e := evt.(type) {
+	case *models.OrderCreated:
+		return e.OrderID
+	case *models.InventoryReserved:
+		return e.OrderID
+	case *models.InventoryFailed:
+		return e.OrderID
+	}
+	return ""
+}
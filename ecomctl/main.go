@@ -0,0 +1,126 @@
+// Command ecomctl is the operator CLI for the e-commerce platform. It
+// reads the same configuration as the services (config/<env>.yaml,
+// APP_CONFIG_FILE and APP_* variables), so it connects to Kafka with
+// the same brokers, TLS and SASL settings.
+//
+// Usage:
+//
+//	ecomctl [--config file] <command> [arguments]
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+
+	"e-commerce/common/config"
+	"e-commerce/common/kafkaclient"
+)
+
+// command is one ecomctl subcommand. run receives the arguments that
+// follow the command name.
+type command struct {
+	usage   string
+	summary string
+	run     func(ctx context.Context, e *env, args []string) error
+}
+
+var commands = map[string]command{
+	"topics": {
+		usage:   "topics apply [--manifest file] [--dry-run]",
+		summary: "create missing topics and reconcile existing ones with the manifest",
+		run:     runTopics,
+	},
+	"produce": {
+		usage:   "produce <kind> [--file f | --order-id id ...]",
+		summary: "write typed events, built from flags or read from a JSON file, keyed by order ID",
+		run:     runProduce,
+	},
+	"tail": {
+		usage:   "tail <topic> [--from end] [--order-id id] [--user-id id]",
+		summary: "print a topic's messages decoded (JSON or Avro), with key, headers, partition and offset",
+		run:     runTail,
+	},
+	"replay": {
+		usage:   "replay reset|copy [flags]",
+		summary: "move a group's offsets to a time or offset, or copy a time slice into a sandbox topic",
+		run:     runReplay,
+	},
+}
+
+// env is what every command gets: the loaded config and a Kafka
+// connection built from it.
+type env struct {
+	cfg      *config.Config
+	kafka    *kafkaclient.Conn
+	clientID string
+	out      io.Writer
+}
+
+// errUsage makes main print the command's usage and exit with code 2.
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	fs := flag.NewFlagSet("ecomctl", flag.ExitOnError)
+	file := fs.String("config", os.Getenv("APP_CONFIG_FILE"), "path to a YAML config file (default config/<env>.yaml)")
+	fs.Usage = func() { usage(fs) }
+	_ = fs.Parse(os.Args[1:])
+
+	args := fs.Args()
+	if len(args) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "ecomctl: unknown command %q\n", args[0])
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.LoadFile(*file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ecomctl: invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+	kconn, err := kafkaclient.New(cfg.Kafka)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ecomctl: %v\n", err)
+		os.Exit(1)
+	}
+	e := &env{cfg: cfg, kafka: kconn, clientID: config.ClientID("ecomctl"), out: os.Stdout}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := cmd.run(ctx, e, args[1:]); err != nil {
+		if errors.Is(err, errUsage) {
+			fmt.Fprintf(os.Stderr, "usage: ecomctl %s\n", cmd.usage)
+			os.Exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "ecomctl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage(fs *flag.FlagSet) {
+	w := fs.Output()
+	fmt.Fprintln(w, "usage: ecomctl [--config file] <command> [arguments]")
+	fmt.Fprintln(w, "\nCommands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-50s %s\n", commands[name].usage, commands[name].summary)
+	}
+	fmt.Fprintln(w, "\nFlags:")
+	fs.PrintDefaults()
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"e-commerce/ecomctl/replay"
+)
+
+// runReplay implements "replay reset" and "replay copy".
+func runReplay(ctx context.Context, e *env, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	switch args[0] {
+	case "reset":
+		return runReplayReset(ctx, e, args[1:])
+	case "copy":
+		return runReplayCopy(ctx, e, args[1:])
+	}
+	return errUsage
+}
+
+// runReplayReset moves a stopped consumer group back (or forward) on one
+// topic. The services keep their dedupe stores in memory, so events the
+// group re-reads after a restart are processed again.
+func runReplayReset(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("replay reset", flag.ContinueOnError)
+	group := fs.String("group", "", "consumer group to move (required)")
+	topic := fs.String("topic", "", "topic whose offsets to move (required)")
+	toTime := fs.String("to-time", "", "first message at or after this time: RFC 3339, or a duration meaning that long ago (e.g. 2h)")
+	toOffset := fs.String("to-offset", "", `offset for every partition: a number, "earliest" or "latest"`)
+	offsets := fs.String("offsets", "", "explicit offsets per partition, e.g. 0=120,3=88")
+	partitions := fs.String("partitions", "", "comma-separated partitions for --to-time/--to-offset (default all)")
+	dryRun := fs.Bool("dry-run", false, "print the plan without committing")
+	timeout := fs.Duration("timeout", 30*time.Second, "overall deadline for the admin requests")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if *group == "" || *topic == "" {
+		return errUsage
+	}
+
+	var target replay.Target
+	set := 0
+	if *toTime != "" {
+		t, err := parseTime(*toTime)
+		if err != nil {
+			return err
+		}
+		target.Time = t
+		set++
+	}
+	if *toOffset != "" {
+		var off int64
+		switch *toOffset {
+		case "earliest":
+			off = 0
+		case "latest":
+			off = 1<<63 - 1
+		default:
+			n, err := strconv.ParseInt(*toOffset, 10, 64)
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid --to-offset %q", *toOffset)
+			}
+			off = n
+		}
+		target.Offset = &off
+		set++
+	}
+	if *offsets != "" {
+		m, err := parseOffsets(*offsets)
+		if err != nil {
+			return err
+		}
+		target.Offsets = m
+		set++
+	}
+	if set != 1 {
+		return fmt.Errorf("set exactly one of --to-time, --to-offset and --offsets")
+	}
+	if *partitions != "" {
+		if target.Offsets != nil {
+			return fmt.Errorf("--partitions does not apply to --offsets")
+		}
+		for _, s := range strings.Split(*partitions, ",") {
+			p, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil {
+				return fmt.Errorf("invalid partition %q", s)
+			}
+			target.Partitions = append(target.Partitions, p)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+	client := e.kafka.Client(e.clientID)
+
+	plan, err := replay.PlanReset(ctx, client, *group, *topic, target)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(e.out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "PARTITION\tCOMMITTED\tTARGET\tLOG START\tEND\tRE-READ\t")
+	changes := 0
+	for _, r := range plan {
+		cur := "-"
+		if r.Current >= 0 {
+			cur = strconv.FormatInt(r.Current, 10)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%d\t%d\t%+d\t\n", r.Partition, cur, r.Target, r.Start, r.End, r.Delta())
+		if r.Current != r.Target {
+			changes++
+		}
+	}
+	_ = tw.Flush()
+
+	switch {
+	case changes == 0:
+		fmt.Fprintf(e.out, "Group %s is already at the target on %s.\n", *group, *topic)
+		return nil
+	case *dryRun:
+		fmt.Fprintf(e.out, "Dry run: %d partition(s) of %s not moved for group %s.\n", changes, *topic, *group)
+		if err := replay.RequireEmpty(ctx, client, *group); err != nil {
+			fmt.Fprintf(e.out, "warning: %v\n", err)
+		}
+		return nil
+	}
+	if err := replay.ApplyReset(ctx, client, *group, *topic, plan); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.out, "Moved %d partition(s) of %s for group %s.\n", changes, *topic, *group)
+	return nil
+}
+
+// runReplayCopy copies a time slice of a topic into a sandbox topic.
+func runReplayCopy(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("replay copy", flag.ContinueOnError)
+	topic := fs.String("topic", "", "source topic (required)")
+	sandbox := fs.String("sandbox", "", "destination topic, created if missing (default <topic>.replay)")
+	from := fs.String("from", "", "start of the slice: RFC 3339, or a duration meaning that long ago (required)")
+	to := fs.String("to", "", "end of the slice, exclusive (default: the current end)")
+	mode := fs.String("dedupe", "respect", `"bypass" marks copies so consumers reprocess events they have already seen; "respect" leaves their idempotency checks on`)
+	idle := fs.Duration("idle", 5*time.Second, "stop reading a partition after this long without a message")
+	dryRun := fs.Bool("dry-run", false, "print the offset ranges without copying")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if *topic == "" || *from == "" {
+		return errUsage
+	}
+	opts := replay.CopyOptions{Topic: *topic, Sandbox: *sandbox, Idle: *idle, DryRun: *dryRun}
+	if opts.Sandbox == "" {
+		opts.Sandbox = *topic + ".replay"
+	}
+	switch *mode {
+	case "bypass":
+		opts.Bypass = true
+	case "respect":
+	default:
+		return fmt.Errorf("invalid --dedupe %q (want bypass or respect)", *mode)
+	}
+	var err error
+	if opts.From, err = parseTime(*from); err != nil {
+		return err
+	}
+	if *to != "" {
+		if opts.To, err = parseTime(*to); err != nil {
+			return err
+		}
+		if !opts.To.After(opts.From) {
+			return fmt.Errorf("--to must be after --from")
+		}
+	}
+
+	slices, err := replay.Copy(ctx, e.kafka, e.clientID, opts)
+	tw := tabwriter.NewWriter(e.out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "PARTITION\tFROM OFFSET\tTO OFFSET\tCOPIED\t")
+	total, copied := int64(0), 0
+	for _, s := range slices {
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%d\t\n", s.Partition, s.Start, s.Stop, s.Copied)
+		total += s.Stop - s.Start
+		copied += s.Copied
+	}
+	_ = tw.Flush()
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		fmt.Fprintf(e.out, "Dry run: up to %d message(s) of %s would be copied to %s (dedupe %s).\n", total, *topic, opts.Sandbox, *mode)
+		return nil
+	}
+	fmt.Fprintf(e.out, "Copied %d message(s) from %s to %s (dedupe %s).\n", copied, *topic, opts.Sandbox, *mode)
+	return nil
+}
+
+// parseTime accepts an RFC 3339 timestamp or a duration meaning that
+// long before now.
+func parseTime(s string) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: want RFC 3339 or a duration such as 2h", s)
+	}
+	return t, nil
+}
+
+// parseOffsets parses "0=120,3=88".
+func parseOffsets(s string) (map[int]int64, error) {
+	out := map[int]int64{}
+	for _, pair := range strings.Split(s, ",") {
+		p, o, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		part, err1 := strconv.Atoi(p)
+		off, err2 := strconv.ParseInt(o, 10, 64)
+		if !ok || err1 != nil || err2 != nil || part < 0 || off < 0 {
+			return nil, fmt.Errorf("invalid --offsets entry %q: want partition=offset", pair)
+		}
+		out[part] = off
+	}
+	return out, nil
+}
@@ -0,0 +1,276 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"e-commerce/common/dedupe"
+	"e-commerce/common/kafkaclient"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// SourceHeader records where a copied message came from, as
+// "topic/partition/offset".
+const SourceHeader = "X-Replay-Source"
+
+// CopyOptions selects the slice of Topic to copy into Sandbox.
+type CopyOptions struct {
+	Topic   string
+	Sandbox string
+	From    time.Time // first message at or after From
+	To      time.Time // stop before the first message at or after To; zero means the current end
+	Bypass  bool      // mark copies with dedupe.BypassHeader; otherwise strip it
+	DryRun  bool      // only compute the offset ranges
+
+	// Idle ends a partition early when nothing arrives for this long.
+	// The last offsets of a transactional topic are commit markers,
+	// which are never delivered.
+	Idle time.Duration
+}
+
+// PartitionCopy is one partition's slice and how much of it was copied.
+type PartitionCopy struct {
+	Partition int
+	Start     int64 // first offset copied
+	Stop      int64 // first offset not copied
+	Copied    int
+}
+
+// Copy copies a time slice of opts.Topic into opts.Sandbox, partition
+// for partition, keeping keys, values, headers and timestamps. The
+// sandbox topic is created with the source's partition count if it
+// does not exist. Consumers pointed at the sandbox see the events in
+// their original per-partition order.
+func Copy(ctx context.Context, conn *kafkaclient.Conn, clientID string, opts CopyOptions) ([]PartitionCopy, error) {
+	if opts.Topic == opts.Sandbox {
+		return nil, errors.New("sandbox topic must differ from the source topic")
+	}
+	if opts.Idle <= 0 {
+		opts.Idle = 5 * time.Second
+	}
+	client := conn.Client(clientID)
+
+	slices, err := planCopy(ctx, client, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.DryRun {
+		return slices, nil
+	}
+	if err := ensureTopic(ctx, client, opts.Sandbox, len(slices)); err != nil {
+		return slices, err
+	}
+
+	w := kafka.NewWriter(kafka.WriterConfig{
+		Brokers:      conn.Brokers,
+		Topic:        opts.Sandbox,
+		Dialer:       conn.Dialer(clientID),
+		Balancer:     samePartition{},
+		RequiredAcks: int(kafka.RequireAll),
+	})
+	defer w.Close()
+
+	for i := range slices {
+		if err := copyPartition(ctx, conn, clientID, w, opts, &slices[i]); err != nil {
+			return slices, fmt.Errorf("partition %d: %w", slices[i].Partition, err)
+		}
+	}
+	return slices, nil
+}
+
+// planCopy resolves From and To to an offset range per partition.
+func planCopy(ctx context.Context, client *kafka.Client, opts CopyOptions) ([]PartitionCopy, error) {
+	meta, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{opts.Topic}})
+	if err != nil {
+		return nil, fmt.Errorf("metadata for %s: %w", opts.Topic, err)
+	}
+	if len(meta.Topics) != 1 || meta.Topics[0].Error != nil {
+		return nil, fmt.Errorf("topic %s not found", opts.Topic)
+	}
+	n := len(meta.Topics[0].Partitions)
+
+	// One request per bound: the response keys offsets by partition only
+	bound := func(t time.Time) (map[int]int64, error) {
+		req := make([]kafka.OffsetRequest, 0, n)
+		for p := 0; p < n; p++ {
+			if t.IsZero() {
+				req = append(req, kafka.LastOffsetOf(p))
+			} else {
+				req = append(req, kafka.TimeOffsetOf(p, t))
+			}
+		}
+		resp, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{
+			Topics:         map[string][]kafka.OffsetRequest{opts.Topic: req},
+			IsolationLevel: kafka.ReadCommitted,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("listing offsets: %w", err)
+		}
+		out := map[int]int64{}
+		for _, po := range resp.Topics[opts.Topic] {
+			if po.Error != nil {
+				return nil, fmt.Errorf("offsets for %s/%d: %w", opts.Topic, po.Partition, po.Error)
+			}
+			// -1 means no message at or after t: the slice ends at the end
+			out[po.Partition] = po.LastOffset
+			for off := range po.Offsets {
+				out[po.Partition] = off
+			}
+		}
+		return out, nil
+	}
+	ends, err := bound(time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	starts, err := bound(opts.From)
+	if err != nil {
+		return nil, err
+	}
+	stops := ends
+	if !opts.To.IsZero() {
+		if stops, err = bound(opts.To); err != nil {
+			return nil, err
+		}
+	}
+
+	slices := make([]PartitionCopy, n)
+	for p := 0; p < n; p++ {
+		s := PartitionCopy{Partition: p, Start: starts[p], Stop: stops[p]}
+		if s.Start < 0 {
+			s.Start = ends[p]
+		}
+		if s.Stop < 0 {
+			s.Stop = ends[p]
+		}
+		s.Stop = max(s.Stop, s.Start)
+		slices[p] = s
+	}
+	return slices, nil
+}
+
+func copyPartition(ctx context.Context, conn *kafkaclient.Conn, clientID string, w *kafka.Writer, opts CopyOptions, s *PartitionCopy) error {
+	if s.Start >= s.Stop {
+		return nil
+	}
+	r := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:        conn.Brokers,
+		Topic:          opts.Topic,
+		Partition:      s.Partition,
+		Dialer:         conn.Dialer(clientID),
+		IsolationLevel: kafka.ReadCommitted,
+		MaxBytes:       10e6,
+	})
+	defer r.Close()
+	if err := r.SetOffset(s.Start); err != nil {
+		return err
+	}
+
+	const batchSize = 500
+	batch := make([]kafka.Message, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := w.WriteMessages(ctx, batch...); err != nil {
+			return err
+		}
+		s.Copied += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		readCtx, cancel := context.WithTimeout(ctx, opts.Idle)
+		m, err := r.ReadMessage(readCtx)
+		cancel()
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+				break
+			}
+			return err
+		}
+		if m.Offset >= s.Stop {
+			break
+		}
+		batch = append(batch, sandboxCopy(m, opts.Bypass))
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if m.Offset+1 >= s.Stop {
+			break
+		}
+	}
+	return flush()
+}
+
+// sandboxCopy rewrites m for the sandbox topic.
+func sandboxCopy(m kafka.Message, bypass bool) kafka.Message {
+	headers := make([]kafka.Header, 0, len(m.Headers)+2)
+	for _, h := range m.Headers {
+		if h.Key == dedupe.BypassHeader || h.Key == SourceHeader {
+			continue
+		}
+		headers = append(headers, h)
+	}
+	headers = append(headers, kafka.Header{
+		Key:   SourceHeader,
+		Value: []byte(m.Topic + "/" + strconv.Itoa(m.Partition) + "/" + strconv.FormatInt(m.Offset, 10)),
+	})
+	if bypass {
+		headers = append(headers, kafka.Header{Key: dedupe.BypassHeader, Value: []byte("true")})
+	}
+	return kafka.Message{
+		Partition: m.Partition,
+		Key:       m.Key,
+		Value:     m.Value,
+		Headers:   headers,
+		Time:      m.Time,
+	}
+}
+
+// samePartition writes each message to the partition number it was read
+// from. ensureTopic guarantees the sandbox has at least as many.
+type samePartition struct{}
+
+func (samePartition) Balance(msg kafka.Message, partitions ...int) int {
+	for _, p := range partitions {
+		if p == msg.Partition {
+			return p
+		}
+	}
+	return partitions[msg.Partition%len(partitions)]
+}
+
+// ensureTopic creates topic with the given partition count and the
+// broker's default replication factor, unless it already exists.
+func ensureTopic(ctx context.Context, client *kafka.Client, topic string, partitions int) error {
+	meta, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return fmt.Errorf("metadata for %s: %w", topic, err)
+	}
+	if len(meta.Topics) == 1 && meta.Topics[0].Error == nil {
+		if n := len(meta.Topics[0].Partitions); n < partitions {
+			return fmt.Errorf("sandbox topic %s has %d partition(s), fewer than the source's %d", topic, n, partitions)
+		}
+		return nil
+	}
+	resp, err := client.CreateTopics(ctx, &kafka.CreateTopicsRequest{Topics: []kafka.TopicConfig{{
+		Topic:             topic,
+		NumPartitions:     partitions,
+		ReplicationFactor: -1,
+	}}})
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", topic, err)
+	}
+	if err := resp.Errors[topic]; err != nil && !errors.Is(err, kafka.TopicAlreadyExists) {
+		return fmt.Errorf("creating %s: %w", topic, err)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+// Package replay moves consumer groups back in time and copies slices
+// of a topic for reprocessing.
+package replay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Target says where to move a group's offsets. Set exactly one of Time,
+// Offset or Offsets.
+type Target struct {
+	Time    time.Time     // first message at or after Time
+	Offset  *int64        // the same offset on every partition, clamped to the retained range
+	Offsets map[int]int64 // explicit offset per partition; other partitions are left alone
+
+	Partitions []int // limit Time/Offset to these partitions; empty means all
+}
+
+// PartitionReset is one partition's step in a reset plan.
+type PartitionReset struct {
+	Partition int
+	Current   int64 // committed offset, -1 if none
+	Target    int64
+	Start     int64 // log start
+	End       int64 // high-water mark
+}
+
+// Delta is the number of messages the group will re-read (positive) or
+// skip (negative) after the reset.
+func (p PartitionReset) Delta() int64 {
+	cur := p.Current
+	if cur < 0 {
+		cur = p.Start
+	}
+	return cur - p.Target
+}
+
+// PlanReset computes where each partition of topic would move for group.
+func PlanReset(ctx context.Context, client *kafka.Client, group, topic string, target Target) ([]PartitionReset, error) {
+	meta, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return nil, fmt.Errorf("metadata for %s: %w", topic, err)
+	}
+	if len(meta.Topics) != 1 || meta.Topics[0].Error != nil {
+		return nil, fmt.Errorf("topic %s not found", topic)
+	}
+
+	only := map[int]bool{}
+	for _, p := range target.Partitions {
+		only[p] = true
+	}
+	var partitions []int
+	for _, p := range meta.Topics[0].Partitions {
+		switch {
+		case target.Offsets != nil:
+			if _, ok := target.Offsets[p.ID]; !ok {
+				continue
+			}
+		case len(only) > 0 && !only[p.ID]:
+			continue
+		}
+		partitions = append(partitions, p.ID)
+	}
+	for p := range target.Offsets {
+		if !contains(partitions, p) {
+			return nil, fmt.Errorf("topic %s has no partition %d", topic, p)
+		}
+	}
+	sort.Ints(partitions)
+
+	// Retained range of each partition, plus the time lookup if asked
+	req := map[string][]kafka.OffsetRequest{}
+	for _, p := range partitions {
+		req[topic] = append(req[topic], kafka.FirstOffsetOf(p), kafka.LastOffsetOf(p))
+		if !target.Time.IsZero() {
+			req[topic] = append(req[topic], kafka.TimeOffsetOf(p, target.Time))
+		}
+	}
+	offsets, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: req})
+	if err != nil {
+		return nil, fmt.Errorf("listing offsets: %w", err)
+	}
+	byPartition := map[int]kafka.PartitionOffsets{}
+	for _, po := range offsets.Topics[topic] {
+		if po.Error != nil {
+			return nil, fmt.Errorf("offsets for %s/%d: %w", topic, po.Partition, po.Error)
+		}
+		byPartition[po.Partition] = po
+	}
+
+	committed, err := committedOffsets(ctx, client, group, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := make([]PartitionReset, 0, len(partitions))
+	for _, p := range partitions {
+		po := byPartition[p]
+		r := PartitionReset{Partition: p, Current: -1, Start: po.FirstOffset, End: po.LastOffset}
+		if c, ok := committed[p]; ok {
+			r.Current = c
+		}
+		switch {
+		case target.Offsets != nil:
+			r.Target = target.Offsets[p]
+			if r.Target < r.Start || r.Target > r.End {
+				return nil, fmt.Errorf("offset %d for partition %d is outside the retained range [%d, %d]", r.Target, p, r.Start, r.End)
+			}
+		case target.Offset != nil:
+			r.Target = min(max(*target.Offset, r.Start), r.End)
+		default:
+			// The broker answers with the first offset whose timestamp
+			// is at or after Time, or -1 if there is none: the end.
+			r.Target = r.End
+			for off := range po.Offsets {
+				if off >= 0 {
+					r.Target = off
+				}
+			}
+		}
+		plan = append(plan, r)
+	}
+	return plan, nil
+}
+
+// ApplyReset commits the plan's target offsets for group. The group
+// must have no active members: Kafka only accepts offsets from outside
+// the group while it is empty, and a running consumer would overwrite
+// them with its next commit anyway.
+func ApplyReset(ctx context.Context, client *kafka.Client, group, topic string, plan []PartitionReset) error {
+	if err := RequireEmpty(ctx, client, group); err != nil {
+		return err
+	}
+	commits := make([]kafka.OffsetCommit, 0, len(plan))
+	for _, r := range plan {
+		commits = append(commits, kafka.OffsetCommit{Partition: r.Partition, Offset: r.Target, Metadata: "ecomctl replay reset"})
+	}
+	resp, err := client.OffsetCommit(ctx, &kafka.OffsetCommitRequest{
+		GroupID:      group,
+		GenerationID: -1,
+		Topics:       map[string][]kafka.OffsetCommit{topic: commits},
+	})
+	if err != nil {
+		return fmt.Errorf("committing offsets: %w", err)
+	}
+	var errs []error
+	for _, p := range resp.Topics[topic] {
+		if p.Error != nil {
+			errs = append(errs, fmt.Errorf("partition %d: %w", p.Partition, p.Error))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RequireEmpty fails unless group has no active members.
+func RequireEmpty(ctx context.Context, client *kafka.Client, group string) error {
+	resp, err := client.DescribeGroups(ctx, &kafka.DescribeGroupsRequest{GroupIDs: []string{group}})
+	if err != nil {
+		return fmt.Errorf("describing group %s: %w", group, err)
+	}
+	for _, g := range resp.Groups {
+		if g.Error != nil {
+			return fmt.Errorf("describing group %s: %w", group, g.Error)
+		}
+		if len(g.Members) > 0 {
+			return fmt.Errorf("group %s has %d active member(s) (state %s); stop its consumers before resetting offsets",
+				group, len(g.Members), g.GroupState)
+		}
+	}
+	return nil
+}
+
+func committedOffsets(ctx context.Context, client *kafka.Client, group, topic string) (map[int]int64, error) {
+	resp, err := client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{GroupID: group, Topics: map[string][]int{topic: nil}})
+	if err != nil {
+		return nil, fmt.Errorf("fetching committed offsets: %w", err)
+	}
+	if resp.Error != nil {
+		return nil, fmt.Errorf("fetching committed offsets: %w", resp.Error)
+	}
+	out := map[int]int64{}
+	for _, p := range resp.Topics[topic] {
+		if p.Error == nil && p.CommittedOffset >= 0 {
+			out[p.Partition] = p.CommittedOffset
+		}
+	}
+	return out, nil
+}
+
+func contains(s []int, v int) bool {
+	for _, x := range s {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
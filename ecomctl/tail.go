@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"e-commerce/common/codec"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// tailed is one message read by tail, decoded.
+type tailed struct {
+	Topic     string            `json:"topic"`
+	Partition int               `json:"partition"`
+	Offset    int64             `json:"offset"`
+	Time      time.Time         `json:"time"`
+	Key       string            `json:"key"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Format    string            `json:"format"`
+	SchemaID  int               `json:"schema_id,omitempty"`
+	Value     any               `json:"value"`
+}
+
+// runTail implements "tail <topic>": it reads every partition (or one)
+// without a consumer group, so it never moves the services' offsets,
+// decodes each value and prints the matching ones.
+func runTail(ctx context.Context, e *env, args []string) error {
+	if len(args) == 0 || args[0] == "" || args[0][0] == '-' {
+		return errUsage
+	}
+	topic := args[0]
+
+	fs := flag.NewFlagSet("tail", flag.ContinueOnError)
+	from := fs.String("from", "end", `where to start: "beginning", "end", an RFC 3339 time, or a duration meaning that long ago`)
+	partition := fs.Int("partition", -1, "read only this partition")
+	follow := fs.Bool("follow", true, "keep waiting for new messages; false stops at the end as of startup")
+	limit := fs.Int("max", 0, "stop after printing this many messages (0: no limit)")
+	format := fs.String("format", codec.FormatAuto, "value format: auto, json, avro (Schema Registry wire format) or raw")
+	output := fs.String("output", "pretty", `"pretty", or "json" for one object per line`)
+	orderID := fs.String("order-id", "", "only messages for this order (key or order ID field)")
+	userID := fs.String("user-id", "", "only messages for this user (user ID field)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return errUsage
+	}
+	if *output != "pretty" && *output != "json" {
+		return fmt.Errorf("invalid --output %q (want pretty or json)", *output)
+	}
+	dec, err := codec.NewDecoder(*format, codec.NewRegistry(e.cfg.SchemaRegistry))
+	if err != nil {
+		return err
+	}
+
+	starts, ends, err := tailPositions(ctx, e, topic, *partition, *from)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	msgs := make(chan kafka.Message, 64)
+	errc := make(chan error, len(starts))
+	var wg sync.WaitGroup
+	for p, start := range starts {
+		end := int64(-1)
+		if !*follow {
+			if end = ends[p]; start >= end {
+				continue
+			}
+		}
+		r := kafka.NewReader(kafka.ReaderConfig{
+			Brokers:        e.kafka.Brokers,
+			Topic:          topic,
+			Partition:      p,
+			Dialer:         e.kafka.Dialer(e.clientID),
+			IsolationLevel: kafka.ReadCommitted,
+			MinBytes:       1,
+			MaxBytes:       10e6,
+			MaxWait:        250 * time.Millisecond,
+		})
+		if err := r.SetOffset(start); err != nil {
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer r.Close()
+			errc <- readPartition(ctx, r, end, msgs)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(msgs)
+	}()
+
+	printed := 0
+	for m := range msgs {
+		d, err := dec.Decode(ctx, m.Value)
+		if err != nil {
+			fmt.Fprintf(e.out, "warning: %s/%d@%d: %v\n", m.Topic, m.Partition, m.Offset, err)
+		}
+		if *orderID != "" && string(m.Key) != *orderID && d.Field("order_id", "orderID") != *orderID {
+			continue
+		}
+		if *userID != "" && d.Field("user_id", "userID") != *userID {
+			continue
+		}
+		t := tailed{
+			Topic:     m.Topic,
+			Partition: m.Partition,
+			Offset:    m.Offset,
+			Time:      m.Time,
+			Key:       string(m.Key),
+			Format:    d.Format,
+			SchemaID:  d.SchemaID,
+			Value:     d.Value,
+		}
+		if len(m.Headers) > 0 {
+			t.Headers = make(map[string]string, len(m.Headers))
+			for _, h := range m.Headers {
+				t.Headers[h.Key] = string(h.Value)
+			}
+		}
+		if *output == "json" {
+			_ = json.NewEncoder(e.out).Encode(t)
+		} else {
+			printTailed(e.out, t)
+		}
+		if printed++; *limit > 0 && printed >= *limit {
+			cancel()
+			break
+		}
+	}
+	cancel()
+	wg.Wait()
+	close(errc)
+	for err := range errc {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return err
+		}
+	}
+	return nil
+}
+
+// readPartition sends r's messages to out until ctx is canceled or, if
+// end >= 0, the reader reaches end. Trailing transaction markers are
+// never delivered, so a bounded read also stops after a quiet spell.
+func readPartition(ctx context.Context, r *kafka.Reader, end int64, out chan<- kafka.Message) error {
+	for {
+		readCtx := ctx
+		cancel := context.CancelFunc(func() {})
+		if end >= 0 {
+			readCtx, cancel = context.WithTimeout(ctx, 3*time.Second)
+		}
+		m, err := r.ReadMessage(readCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if end >= 0 && errors.Is(err, context.DeadlineExceeded) {
+				return nil
+			}
+			return err
+		}
+		if end >= 0 && m.Offset >= end {
+			return nil
+		}
+		select {
+		case out <- m:
+		case <-ctx.Done():
+			return nil
+		}
+		if end >= 0 && m.Offset+1 >= end {
+			return nil
+		}
+	}
+}
+
+// tailPositions returns the start offset of every selected partition
+// and the current end of each.
+func tailPositions(ctx context.Context, e *env, topic string, partition int, from string) (starts, ends map[int]int64, err error) {
+	client := e.kafka.Client(e.clientID)
+	client.Timeout = 30 * time.Second
+	meta, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return nil, nil, fmt.Errorf("metadata for %s: %w", topic, err)
+	}
+	if len(meta.Topics) != 1 || meta.Topics[0].Error != nil {
+		return nil, nil, fmt.Errorf("topic %s not found", topic)
+	}
+	var at time.Time
+	switch from {
+	case "beginning", "end":
+	default:
+		if at, err = parseTime(from); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var req []kafka.OffsetRequest
+	for _, p := range meta.Topics[0].Partitions {
+		if partition >= 0 && p.ID != partition {
+			continue
+		}
+		req = append(req, kafka.FirstOffsetOf(p.ID), kafka.LastOffsetOf(p.ID))
+	}
+	if len(req) == 0 {
+		return nil, nil, fmt.Errorf("topic %s has no partition %d", topic, partition)
+	}
+	resp, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{
+		Topics:         map[string][]kafka.OffsetRequest{topic: req},
+		IsolationLevel: kafka.ReadCommitted,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("listing offsets: %w", err)
+	}
+	starts, ends = map[int]int64{}, map[int]int64{}
+	for _, po := range resp.Topics[topic] {
+		if po.Error != nil {
+			return nil, nil, fmt.Errorf("offsets for %s/%d: %w", topic, po.Partition, po.Error)
+		}
+		ends[po.Partition] = po.LastOffset
+		if from == "end" {
+			starts[po.Partition] = po.LastOffset
+		} else {
+			starts[po.Partition] = po.FirstOffset
+		}
+	}
+	if at.IsZero() {
+		return starts, ends, nil
+	}
+
+	// Separate request: offsets come back keyed by partition only
+	req = req[:0]
+	for p := range starts {
+		req = append(req, kafka.TimeOffsetOf(p, at))
+	}
+	resp, err = client.ListOffsets(ctx, &kafka.ListOffsetsRequest{
+		Topics:         map[string][]kafka.OffsetRequest{topic: req},
+		IsolationLevel: kafka.ReadCommitted,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("listing offsets: %w", err)
+	}
+	for _, po := range resp.Topics[topic] {
+		if po.Error != nil {
+			return nil, nil, fmt.Errorf("offsets for %s/%d: %w", topic, po.Partition, po.Error)
+		}
+		// No message at or after the time: start at the end
+		starts[po.Partition] = ends[po.Partition]
+		for off := range po.Offsets {
+			if off >= 0 {
+				starts[po.Partition] = off
+			}
+		}
+	}
+	return starts, ends, nil
+}
+
+func printTailed(w io.Writer, t tailed) {
+	kind := t.Format
+	if t.SchemaID != 0 {
+		kind = fmt.Sprintf("%s, schema %d", t.Format, t.SchemaID)
+	}
+	fmt.Fprintf(w, "%s [%d] @%d  %s  (%s)\n", t.Topic, t.Partition, t.Offset, t.Time.UTC().Format(time.RFC3339Nano), kind)
+	fmt.Fprintf(w, "  key:     %s\n", t.Key)
+	if len(t.Headers) > 0 {
+		keys := make([]string, 0, len(t.Headers))
+		for k := range t.Headers {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for i, k := range keys {
+			label := "  headers:"
+			if i > 0 {
+				label = "          "
+			}
+			fmt.Fprintf(w, "%s %s=%s\n", label, k, t.Headers[k])
+		}
+	}
+	if s, ok := t.Value.(string); ok {
+		fmt.Fprintf(w, "  value:   %s\n\n", s)
+		return
+	}
+	body, err := json.MarshalIndent(t.Value, "  ", "  ")
+	if err != nil {
+		fmt.Fprintf(w, "  value:   %v\n\n", t.Value)
+		return
+	}
+	fmt.Fprintf(w, "  %s\n\n", body)
+}
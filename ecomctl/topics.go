@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"e-commerce/ecomctl/topics"
+)
+
+// runTopics implements "topics apply": it prints the plan and, unless
+// --dry-run is set, applies it.
+func runTopics(ctx context.Context, e *env, args []string) error {
+	if len(args) == 0 || args[0] != "apply" {
+		return errUsage
+	}
+	fs := flag.NewFlagSet("topics apply", flag.ContinueOnError)
+	manifest := fs.String("manifest", "config/topics.yaml", "topic manifest to apply")
+	dryRun := fs.Bool("dry-run", false, "print the plan without changing anything")
+	timeout := fs.Duration("timeout", 30*time.Second, "overall deadline for the admin requests")
+	if err := fs.Parse(args[1:]); err != nil {
+		return errUsage
+	}
+
+	m, err := topics.Load(*manifest)
+	if err != nil {
+		return err
+	}
+	// Topics the services are configured to use should be managed here
+	for _, name := range []string{
+		e.cfg.Topics.OrdersCreated,
+		e.cfg.Topics.InventoryEvents,
+		e.cfg.Topics.OrderRate,
+		e.cfg.Topics.OpsAlerts,
+		e.cfg.Topics.NotificationsResent,
+	} {
+		if _, ok := m.Find(name); !ok {
+			fmt.Fprintf(e.out, "warning: topic %q is used by the services but missing from %s\n", name, *manifest)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+	client := e.kafka.Client(e.clientID)
+
+	plan, err := topics.Plan(ctx, client, m)
+	if err != nil {
+		return err
+	}
+	pending := 0
+	for _, c := range plan {
+		fmt.Fprintln(e.out, c)
+		if c.Action != topics.Drift {
+			pending++
+		}
+	}
+	switch {
+	case pending == 0:
+		fmt.Fprintln(e.out, "Topics match the manifest.")
+		return nil
+	case *dryRun:
+		fmt.Fprintf(e.out, "Dry run: %d change(s) not applied.\n", pending)
+		return nil
+	}
+
+	if err := topics.Apply(ctx, client, plan); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.out, "Applied %d change(s).\n", pending)
+	return nil
+}
@@ -0,0 +1,127 @@
+// Package topics reconciles the cluster's topics with a declarative
+// manifest. Apply only ever creates topics, adds partitions and sets
+// the configs the manifest names; it never deletes a topic or shrinks
+// one, so it is safe to run against a cluster holding data.
+package topics
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Manifest is the desired state of every topic we own.
+type Manifest struct {
+	Topics []Topic `yaml:"topics"`
+}
+
+// Topic describes one topic. Zero-valued settings are left at the
+// broker default.
+type Topic struct {
+	Name              string            `yaml:"name"`
+	Partitions        int               `yaml:"partitions"`
+	ReplicationFactor int               `yaml:"replication_factor"`
+	Retention         time.Duration     `yaml:"retention"`      // retention.ms
+	CleanupPolicy     string            `yaml:"cleanup_policy"` // "delete", "compact" or "compact,delete"
+	Compaction        Compaction        `yaml:"compaction"`
+	Configs           map[string]string `yaml:"configs"` // any other topic-level config, verbatim
+}
+
+// Compaction tunes log compaction for topics with a compact policy.
+type Compaction struct {
+	MinLag            time.Duration `yaml:"min_lag"`             // min.compaction.lag.ms
+	DeleteRetention   time.Duration `yaml:"delete_retention"`    // how long tombstones survive, delete.retention.ms
+	MinCleanableRatio float64       `yaml:"min_cleanable_ratio"` // min.cleanable.dirty.ratio
+}
+
+// Load reads and validates a manifest file.
+func Load(path string) (*Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening manifest: %w", err)
+	}
+	defer f.Close()
+
+	var m Manifest
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(&m); err != nil {
+		return nil, fmt.Errorf("decoding manifest %s: %w", path, err)
+	}
+	return &m, m.Validate()
+}
+
+// Validate reports every problem in the manifest at once.
+func (m *Manifest) Validate() error {
+	var errs []error
+	seen := map[string]bool{}
+	for i, t := range m.Topics {
+		at := fmt.Sprintf("topics[%d]", i)
+		if t.Name != "" {
+			at = t.Name
+		}
+		switch {
+		case t.Name == "":
+			errs = append(errs, fmt.Errorf("%s: name is required", at))
+		case seen[t.Name]:
+			errs = append(errs, fmt.Errorf("%s: listed more than once", at))
+		}
+		seen[t.Name] = true
+		if t.Partitions < 1 {
+			errs = append(errs, fmt.Errorf("%s: partitions must be at least 1", at))
+		}
+		if t.ReplicationFactor < 1 {
+			errs = append(errs, fmt.Errorf("%s: replication_factor must be at least 1", at))
+		}
+		switch t.CleanupPolicy {
+		case "", "delete", "compact", "compact,delete":
+		default:
+			errs = append(errs, fmt.Errorf("%s: cleanup_policy must be delete, compact or compact,delete, got %q", at, t.CleanupPolicy))
+		}
+		if r := t.Compaction.MinCleanableRatio; r < 0 || r > 1 {
+			errs = append(errs, fmt.Errorf("%s: compaction.min_cleanable_ratio must be between 0 and 1", at))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Find returns the topic with the given name.
+func (m *Manifest) Find(name string) (Topic, bool) {
+	for _, t := range m.Topics {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return Topic{}, false
+}
+
+// KafkaConfigs returns the topic-level configs this topic sets, keyed
+// by their Kafka names. Explicit Configs entries win over the typed
+// fields.
+func (t Topic) KafkaConfigs() map[string]string {
+	out := map[string]string{}
+	ms := func(d time.Duration) string { return strconv.FormatInt(d.Milliseconds(), 10) }
+	if t.Retention != 0 {
+		out["retention.ms"] = ms(t.Retention)
+	}
+	if t.CleanupPolicy != "" {
+		out["cleanup.policy"] = t.CleanupPolicy
+	}
+	if t.Compaction.MinLag != 0 {
+		out["min.compaction.lag.ms"] = ms(t.Compaction.MinLag)
+	}
+	if t.Compaction.DeleteRetention != 0 {
+		out["delete.retention.ms"] = ms(t.Compaction.DeleteRetention)
+	}
+	if t.Compaction.MinCleanableRatio != 0 {
+		out["min.cleanable.dirty.ratio"] = strconv.FormatFloat(t.Compaction.MinCleanableRatio, 'f', -1, 64)
+	}
+	for k, v := range t.Configs {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,235 @@
+package topics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Action is the kind of step a plan takes for a topic.
+type Action string
+
+const (
+	Create        Action = "create"         // topic is missing
+	AddPartitions Action = "add-partitions" // topic has fewer partitions than the manifest
+	SetConfig     Action = "set-config"     // a managed config differs
+	Drift         Action = "drift"          // differs but cannot be fixed safely; reported only
+)
+
+// Change is one step of a plan.
+type Change struct {
+	Topic  string
+	Action Action
+	Key    string // config name, or "partitions" / "replication_factor"
+	From   string // current value
+	To     string // desired value
+
+	spec Topic // for Create
+}
+
+func (c Change) String() string {
+	switch c.Action {
+	case Create:
+		parts := []string{
+			"partitions=" + strconv.Itoa(c.spec.Partitions),
+			"replication_factor=" + strconv.Itoa(c.spec.ReplicationFactor),
+		}
+		cfgs := c.spec.KafkaConfigs()
+		for _, k := range sortedKeys(cfgs) {
+			parts = append(parts, k+"="+cfgs[k])
+		}
+		return fmt.Sprintf("+ %s: create (%s)", c.Topic, strings.Join(parts, ", "))
+	case Drift:
+		return fmt.Sprintf("! %s: %s is %s, manifest says %s; left unchanged", c.Topic, c.Key, c.From, c.To)
+	default:
+		from := c.From
+		if from == "" {
+			from = "(unset)"
+		}
+		return fmt.Sprintf("~ %s: %s %s -> %s", c.Topic, c.Key, from, c.To)
+	}
+}
+
+// Plan compares the manifest with the cluster and returns the changes
+// Apply would make, in manifest order. An empty plan means the cluster
+// already matches.
+func Plan(ctx context.Context, client *kafka.Client, m *Manifest) ([]Change, error) {
+	meta, err := client.Metadata(ctx, &kafka.MetadataRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("fetching metadata: %w", err)
+	}
+	existing := map[string]kafka.Topic{}
+	for _, t := range meta.Topics {
+		if t.Error == nil {
+			existing[t.Name] = t
+		}
+	}
+
+	// Current values of the configs each existing topic manages
+	var resources []kafka.DescribeConfigRequestResource
+	for _, t := range m.Topics {
+		if _, ok := existing[t.Name]; !ok {
+			continue
+		}
+		if names := sortedKeys(t.KafkaConfigs()); len(names) > 0 {
+			resources = append(resources, kafka.DescribeConfigRequestResource{
+				ResourceType: kafka.ResourceTypeTopic,
+				ResourceName: t.Name,
+				ConfigNames:  names,
+			})
+		}
+	}
+	current := map[string]map[string]string{}
+	if len(resources) > 0 {
+		resp, err := client.DescribeConfigs(ctx, &kafka.DescribeConfigsRequest{Resources: resources})
+		if err != nil {
+			return nil, fmt.Errorf("describing topic configs: %w", err)
+		}
+		for _, r := range resp.Resources {
+			if r.Error != nil {
+				return nil, fmt.Errorf("describing %s: %w", r.ResourceName, r.Error)
+			}
+			vals := map[string]string{}
+			for _, e := range r.ConfigEntries {
+				vals[e.ConfigName] = e.ConfigValue
+			}
+			current[r.ResourceName] = vals
+		}
+	}
+
+	var plan []Change
+	for _, t := range m.Topics {
+		cur, ok := existing[t.Name]
+		if !ok {
+			plan = append(plan, Change{Topic: t.Name, Action: Create, spec: t})
+			continue
+		}
+
+		have, want := len(cur.Partitions), t.Partitions
+		switch {
+		case have < want:
+			plan = append(plan, Change{Topic: t.Name, Action: AddPartitions, Key: "partitions", From: strconv.Itoa(have), To: strconv.Itoa(want)})
+		case have > want:
+			// Kafka cannot remove partitions, and doing it by recreating
+			// the topic would lose data.
+			plan = append(plan, Change{Topic: t.Name, Action: Drift, Key: "partitions", From: strconv.Itoa(have), To: strconv.Itoa(want)})
+		}
+		if rf := replicationFactor(cur); rf != t.ReplicationFactor {
+			// Changing it needs a partition reassignment, which is an
+			// operator decision, not something to do on every apply.
+			plan = append(plan, Change{Topic: t.Name, Action: Drift, Key: "replication_factor", From: strconv.Itoa(rf), To: strconv.Itoa(t.ReplicationFactor)})
+		}
+
+		cfgs := t.KafkaConfigs()
+		for _, k := range sortedKeys(cfgs) {
+			if v := current[t.Name][k]; v != cfgs[k] {
+				plan = append(plan, Change{Topic: t.Name, Action: SetConfig, Key: k, From: v, To: cfgs[k]})
+			}
+		}
+	}
+	return plan, nil
+}
+
+// Apply executes a plan: it creates topics, then adds partitions, then
+// sets configs. Drift entries are skipped. Every failure is reported.
+func Apply(ctx context.Context, client *kafka.Client, plan []Change) error {
+	var (
+		creates    []kafka.TopicConfig
+		partitions []kafka.TopicPartitionsConfig
+		configs    = map[string][]kafka.IncrementalAlterConfigsRequestConfig{}
+		order      []string
+	)
+	for _, c := range plan {
+		switch c.Action {
+		case Create:
+			tc := kafka.TopicConfig{
+				Topic:             c.Topic,
+				NumPartitions:     c.spec.Partitions,
+				ReplicationFactor: c.spec.ReplicationFactor,
+			}
+			cfgs := c.spec.KafkaConfigs()
+			for _, k := range sortedKeys(cfgs) {
+				tc.ConfigEntries = append(tc.ConfigEntries, kafka.ConfigEntry{ConfigName: k, ConfigValue: cfgs[k]})
+			}
+			creates = append(creates, tc)
+		case AddPartitions:
+			n, _ := strconv.Atoi(c.To)
+			partitions = append(partitions, kafka.TopicPartitionsConfig{Name: c.Topic, Count: int32(n)})
+		case SetConfig:
+			if _, ok := configs[c.Topic]; !ok {
+				order = append(order, c.Topic)
+			}
+			configs[c.Topic] = append(configs[c.Topic], kafka.IncrementalAlterConfigsRequestConfig{
+				Name:            c.Key,
+				Value:           c.To,
+				ConfigOperation: kafka.ConfigOperationSet,
+			})
+		}
+	}
+
+	var errs []error
+	if len(creates) > 0 {
+		resp, err := client.CreateTopics(ctx, &kafka.CreateTopicsRequest{Topics: creates})
+		if err != nil {
+			return fmt.Errorf("creating topics: %w", err)
+		}
+		for name, err := range resp.Errors {
+			if err != nil && !errors.Is(err, kafka.TopicAlreadyExists) {
+				errs = append(errs, fmt.Errorf("creating %s: %w", name, err))
+			}
+		}
+	}
+	if len(partitions) > 0 {
+		resp, err := client.CreatePartitions(ctx, &kafka.CreatePartitionsRequest{Topics: partitions})
+		if err != nil {
+			return errors.Join(append(errs, fmt.Errorf("adding partitions: %w", err))...)
+		}
+		for name, err := range resp.Errors {
+			if err != nil {
+				errs = append(errs, fmt.Errorf("adding partitions to %s: %w", name, err))
+			}
+		}
+	}
+	if len(order) > 0 {
+		req := &kafka.IncrementalAlterConfigsRequest{}
+		for _, name := range order {
+			req.Resources = append(req.Resources, kafka.IncrementalAlterConfigsRequestResource{
+				ResourceType: kafka.ResourceTypeTopic,
+				ResourceName: name,
+				Configs:      configs[name],
+			})
+		}
+		resp, err := client.IncrementalAlterConfigs(ctx, req)
+		if err != nil {
+			return errors.Join(append(errs, fmt.Errorf("altering configs: %w", err))...)
+		}
+		for _, r := range resp.Resources {
+			if r.Error != nil {
+				errs = append(errs, fmt.Errorf("altering configs of %s: %w", r.ResourceName, r.Error))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// replicationFactor is the replica count of the topic's first partition.
+func replicationFactor(t kafka.Topic) int {
+	if len(t.Partitions) == 0 {
+		return 0
+	}
+	return len(t.Partitions[0].Replicas)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
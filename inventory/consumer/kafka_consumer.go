@@ -4,7 +4,11 @@ import (
 	"context"
 	"encoding/json"
 
+	"e-commerce/common/kafkaclient"
+	"e-commerce/common/logger"
+	"e-commerce/common/metrics"
 	"e-commerce/common/models"
+	"e-commerce/common/tracing"
 	"e-commerce/inventory/producer"
 	"e-commerce/inventory/service"
 
@@ -22,16 +26,18 @@ type InventoryConsumer struct {
 
 // NewInventoryConsumer configures a manual-commit reader.
 func NewInventoryConsumer(
-	brokers []string,
+	conn *kafkaclient.Conn,
+	topic string,
 	groupID string,
 	stockSvc *service.StockService,
 	prod *producer.InventoryProducer,
 	log *zap.Logger,
 ) *InventoryConsumer {
 	r := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:        brokers,
-		Topic:          "orders.created",
+		Brokers:        conn.Brokers,
+		Topic:          topic,
 		GroupID:        groupID,
+		Dialer:         conn.Dialer(""),
 		MinBytes:       10e3,
 		MaxBytes:       10e6,
 		CommitInterval: 0,
@@ -45,44 +51,67 @@ func NewInventoryConsumer(
 }
 
 // Run consumes, processes, and acknowledges messages.
-func (c *InventoryConsumer) Run(ctx context.Context) {
+// Canceling ctx stops fetching; a message already fetched is still
+// processed and committed before Run returns.
+func (c *InventoryConsumer) Run(ctx context.Context) error {
 	c.logger.Info("Inventory consumer started")
+	commitCtx := context.WithoutCancel(ctx)
 	for {
 		m, err := c.reader.FetchMessage(ctx)
 		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
 			c.logger.Warn("FetchMessage error, stopping consumer", zap.Error(err))
-			return
+			return err
 		}
+		metrics.MessagesConsumed.WithLabelValues(m.Topic).Inc()
+		metrics.ObserveLag(m.Topic, m.Partition, m.Offset, m.HighWaterMark)
 
-		var order models.OrderCreated
-		if err := json.Unmarshal(m.Value, &order); err != nil {
-			c.logger.Error("Invalid OrderCreated payload", zap.Error(err), zap.Int64("offset", m.Offset))
-			_ = c.reader.CommitMessages(ctx, m)
-			continue
-		}
+		c.process(commitCtx, m)
+	}
+}
 
-		// Reserve stock
-		if _, err := c.stockSvc.Reserve(order.Items); err != nil {
-			c.logger.Info("Stock reserve failed", zap.String("orderID", order.OrderID), zap.Error(err))
-			failEvt := models.InventoryFailed{OrderID: order.OrderID, Items: order.Items, Reason: err.Error()}
-			if err := c.producer.EmitFailed(failEvt); err != nil {
-				c.logger.Error("EmitFailed error", zap.Error(err), zap.String("orderID", order.OrderID))
-				continue
-			}
-		} else {
-			c.logger.Info("Stock reserved", zap.String("orderID", order.OrderID))
-			resEvt := models.InventoryReserved{OrderID: order.OrderID, Items: order.Items}
-			if err := c.producer.EmitReserved(resEvt); err != nil {
-				c.logger.Error("EmitReserved error", zap.Error(err), zap.String("orderID", order.OrderID))
-				continue
-			}
-		}
+// process handles one message inside a consumer span continuing the
+// trace in its headers, and commits it once the outcome is published.
+func (c *InventoryConsumer) process(ctx context.Context, m kafka.Message) {
+	ctx = tracing.ExtractKafka(ctx, &m)
+	ctx, span := tracing.StartProcess(ctx, tracer, m.Topic, m.Partition, m.Offset, string(m.Key))
+	var err error
+	defer func() { tracing.End(span, err) }()
+	log := logger.WithContext(ctx, c.logger)
 
-		// Commit after successful emit
-		if err := c.reader.CommitMessages(ctx, m); err != nil {
-			c.logger.Error("CommitMessages error", zap.Error(err), zap.Int64("offset", m.Offset))
+	var order models.OrderCreated
+	if err = json.Unmarshal(m.Value, &order); err != nil {
+		log.Error("Invalid OrderCreated payload", zap.Error(err), zap.Int64("offset", m.Offset))
+		metrics.MessagesDeadLettered.WithLabelValues(m.Topic).Inc()
+		_ = c.reader.CommitMessages(ctx, m)
+		return
+	}
+
+	// Reserve stock
+	if _, rerr := c.stockSvc.Reserve(order.Items); rerr != nil {
+		log.Info("Stock reserve failed", zap.String("orderID", order.OrderID), zap.Error(rerr))
+		failEvt := models.InventoryFailed{OrderID: order.OrderID, UserID: order.UserID, Items: order.Items, Total: order.Total, Reason: rerr.Error()}
+		if err = c.producer.EmitFailed(ctx, failEvt); err != nil {
+			log.Error("EmitFailed error", zap.Error(err), zap.String("orderID", order.OrderID))
+			return
 		}
+	} else {
+		log.Info("Stock reserved", zap.String("orderID", order.OrderID))
+		resEvt := models.InventoryReserved{OrderID: order.OrderID, UserID: order.UserID, Items: order.Items, Total: order.Total}
+		if err = c.producer.EmitReserved(ctx, resEvt); err != nil {
+			log.Error("EmitReserved error", zap.Error(err), zap.String("orderID", order.OrderID))
+			return
+		}
+	}
+
+	// Commit after successful emit
+	if err = c.reader.CommitMessages(ctx, m); err != nil {
+		log.Error("CommitMessages error", zap.Error(err), zap.Int64("offset", m.Offset))
+		return
 	}
+	metrics.MessagesCommitted.WithLabelValues(m.Topic).Inc()
 }
 
 // Close shuts down the reader.
@@ -3,77 +3,150 @@ package consumer
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"time"
 
+	"e-commerce/common/health"
+	"e-commerce/common/kafkaclient"
+	"e-commerce/common/logger"
+	"e-commerce/common/metrics"
 	"e-commerce/common/models"
+	"e-commerce/common/tracing"
 	"e-commerce/inventory/producer"
 
 	"github.com/IBM/sarama"
 	"go.uber.org/zap"
 )
 
-// TxConsumer reads orders.created, hands them off to the producer,
+// TxConsumer reads the orders topic, hands them off to the producer,
 // and marks offsets only after Process returns (durable at-least-once).
 type TxConsumer struct {
 	group    sarama.ConsumerGroup
+	topic    string
 	producer *producer.TransactionalProducer
 	stockSvc producer.ReserveService
 	logger   *zap.Logger
+	joined   atomic.Bool     // true while a group session is active
+	watchdog health.Watchdog // tracks the message in progress
 }
 
+var tracer = tracing.Tracer("e-commerce/inventory/consumer")
+
 // NewTxConsumer builds a Kafka consumer group instance.
 func NewTxConsumer(
-	brokers []string,
+	conn *kafkaclient.Conn,
+	topic string,
 	groupID string,
+	clientID string,
 	stockSvc producer.ReserveService,
 	prod *producer.TransactionalProducer,
 	logger *zap.Logger,
 ) (*TxConsumer, error) {
 	cfg := sarama.NewConfig()
+	cfg.ClientID = clientID
 	cfg.Version = sarama.V2_5_0_0
 	cfg.Consumer.Group.Rebalance.Strategy = sarama.BalanceStrategyRange
 	cfg.Consumer.Offsets.Initial = sarama.OffsetOldest
+	conn.Sarama(cfg)
 
-	grp, err := sarama.NewConsumerGroup(brokers, groupID, cfg)
+	grp, err := sarama.NewConsumerGroup(conn.Brokers, groupID, cfg)
 	if err != nil {
 		return nil, err
 	}
 	return &TxConsumer{
 		group:    grp,
+		topic:    topic,
 		producer: prod,
 		stockSvc: stockSvc,
 		logger:   logger,
 	}, nil
 }
 
-// Setup is invoked when a new session starts. We don’t need to do anything.
-func (c *TxConsumer) Setup(_ sarama.ConsumerGroupSession) error { return nil }
+// Setup is invoked when a new session starts, i.e. once we have joined
+// the group and received our partition assignment.
+func (c *TxConsumer) Setup(_ sarama.ConsumerGroupSession) error {
+	c.joined.Store(true)
+	return nil
+}
+
+// Cleanup is invoked at the end of a session, after every ConsumeClaim
+// has returned. We flush marked offsets synchronously so a shutdown or
+// rebalance doesn't lose the last processed batch.
+func (c *TxConsumer) Cleanup(session sarama.ConsumerGroupSession) error {
+	c.joined.Store(false)
+	session.Commit()
+	return nil
+}
 
-// Cleanup is invoked at the end of a session. No action needed.
-func (c *TxConsumer) Cleanup(_ sarama.ConsumerGroupSession) error { return nil }
+// Ready reports whether this instance currently holds a group session.
+func (c *TxConsumer) Ready(_ context.Context) error {
+	if !c.joined.Load() {
+		return errors.New("not a member of the consumer group")
+	}
+	return nil
+}
+
+// Watchdog exposes the in-progress message tracker for liveness checks.
+func (c *TxConsumer) Watchdog() *health.Watchdog {
+	return &c.watchdog
+}
 
 // ConsumeClaim is where all the message handling happens.
 func (c *TxConsumer) ConsumeClaim(
 	session sarama.ConsumerGroupSession,
 	claim sarama.ConsumerGroupClaim,
 ) error {
-	// Loop over messages
-	for msg := range claim.Messages() {
-		// Deserialize the OrderCreated event
-		var order models.OrderCreated
-		if err := json.Unmarshal(msg.Value, &order); err != nil {
-			c.logger.Warn("invalid payload", zap.Error(err))
-			session.MarkMessage(msg, "")
-			continue
+	// Loop over messages until the claim closes or the session ends.
+	// A message already received is always processed to completion.
+	for {
+		var msg *sarama.ConsumerMessage
+		select {
+		case m, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			msg = m
+		case <-session.Context().Done():
+			return nil
 		}
 
-		// Delegate to our transactional producer
-		if err := c.producer.Process(
-			session.Context(), order, msg, session, c.stockSvc,
-		); err != nil {
-			c.logger.Error("processing failed", zap.Error(err), zap.String("orderID", order.OrderID))
-		}
+		metrics.MessagesConsumed.WithLabelValues(msg.Topic).Inc()
+		metrics.ObserveLag(msg.Topic, int(msg.Partition), msg.Offset, claim.HighWaterMarkOffset())
+
+		start := time.Now()
+		end := c.watchdog.Begin()
+		c.handle(session, msg)
+		end()
+		metrics.ProcessingDuration.WithLabelValues(msg.Topic).Observe(time.Since(start).Seconds())
+	}
+}
+
+// handle decodes one message and hands it to the producer, inside a
+// consumer span continuing the trace carried in the message headers.
+func (c *TxConsumer) handle(session sarama.ConsumerGroupSession, msg *sarama.ConsumerMessage) {
+	ctx := tracing.ExtractSarama(session.Context(), msg)
+	ctx, span := tracing.StartProcess(ctx, tracer, msg.Topic, int(msg.Partition), msg.Offset, string(msg.Key))
+	var err error
+	defer func() { tracing.End(span, err) }()
+	log := logger.WithContext(ctx, c.logger)
+
+	// Deserialize the OrderCreated event
+	var order models.OrderCreated
+	if err = json.Unmarshal(msg.Value, &order); err != nil {
+		log.Warn("invalid payload", zap.Error(err))
+		metrics.MessagesDeadLettered.WithLabelValues(msg.Topic).Inc()
+		session.MarkMessage(msg, "")
+		metrics.MessagesCommitted.WithLabelValues(msg.Topic).Inc()
+		return
+	}
+
+	// Delegate to our transactional producer
+	if err = c.producer.Process(
+		ctx, order, msg, session, c.stockSvc,
+	); err != nil {
+		log.Error("processing failed", zap.Error(err), zap.String("orderID", order.OrderID))
 	}
-	return nil
 }
 
 // Close shuts down the consumer group.
@@ -81,16 +154,20 @@ func (c *TxConsumer) Close() error {
 	return c.group.Close()
 }
 
-// Run kicks off the consume loop against the "orders.created" topic.
-// It handles rebalance and will exit when ctx is canceled.
-func (c *TxConsumer) Run(ctx context.Context) {
-	topics := []string{"orders.created"}
+// Run kicks off the consume loop against the orders topic.
+// It handles rebalance and returns once ctx is canceled and the current
+// session has drained and committed.
+func (c *TxConsumer) Run(ctx context.Context) error {
+	topics := []string{c.topic}
 	for {
 		if err := c.group.Consume(ctx, topics, c); err != nil {
+			if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+				return err
+			}
 			c.logger.Error("consume error", zap.Error(err))
 		}
 		if ctx.Err() != nil {
-			return
+			return nil
 		}
 	}
 }
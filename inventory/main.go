@@ -2,13 +2,15 @@ package main
 
 import (
 	"context"
-	"os"
-	"os/signal"
-	"syscall"
-	"time"
+	"net/http"
 
 	"e-commerce/common/config"
+	"e-commerce/common/health"
+	"e-commerce/common/kafkaclient"
+	"e-commerce/common/lifecycle"
 	"e-commerce/common/logger"
+	"e-commerce/common/metrics"
+	"e-commerce/common/tracing"
 	"e-commerce/inventory/consumer"
 	"e-commerce/inventory/producer"
 	"e-commerce/inventory/service"
@@ -18,40 +20,74 @@ import (
 
 func main() {
 	// 1) Load configuration (profiles: dev/prod) & init structured logger
-	cfg, _ := config.Load()
-	log, _ := logger.NewLogger(cfg.Env, cfg.LogLevel)
+	cfg := config.MustLoad()
+	log, level, err := logger.NewLeveled(cfg.Env, cfg.LogLevel)
+	if err != nil {
+		panic("failed to initialize logger: " + err.Error())
+	}
 	defer log.Sync()
+
+	// Follow log level and publish retry changes in the config file
+	rt := config.NewRuntime(cfg, log)
+	logger.WatchLevel(rt, log, level)
 	log.Info("Starting Inventory Service", zap.String("env", cfg.Env))
 
-	// 2) Initialize in-memory stock levels
-	stockSvc := service.NewStockService(map[string]int{"foo": 10, "bar": 5})
+	// 1b) Tracing: spans flow HTTP → Kafka headers → consumers
+	shutdownTracing, err := tracing.Setup(context.Background(), "inventory", cfg.Trace)
+	if err != nil {
+		log.Fatal("tracing init failed", zap.Error(err))
+	}
+
+	// 1c) Kafka connection settings (TLS/SASL) shared by every client
+	kconn, err := kafkaclient.New(cfg.Kafka)
+	if err != nil {
+		log.Fatal("kafka client config failed", zap.Error(err))
+	}
+
+	// 2) Initialize in-memory stock levels from the configured seed
+	stockSvc := service.NewStockService(cfg.Inventory.SeedStock)
 
 	// 3) Create our idempotent, deduping producer
-	prod, err := producer.NewTransactionalProducer(cfg.KafkaBrokers, "inv-client-1", log)
+	clientID := config.ClientID(cfg.Inventory.ClientID)
+	prod, err := producer.NewTransactionalProducer(kconn, clientID, cfg.Topics, cfg.Inventory.Publish, log)
 	if err != nil {
 		log.Fatal("producer init failed", zap.Error(err))
 	}
-	defer prod.Close()
+	config.OnChange(rt, func(c *config.Config) config.Retry { return c.Inventory.Publish }, prod.SetRetry)
+	rt.Watch()
 
 	// 4) Create the consumer group
-	cons, err := consumer.NewTxConsumer(cfg.KafkaBrokers, "inventory-group", stockSvc, prod, log)
+	cons, err := consumer.NewTxConsumer(
+		kconn, cfg.Topics.OrdersCreated, cfg.Inventory.GroupID, clientID, stockSvc, prod, log,
+	)
 	if err != nil {
 		log.Fatal("consumer init failed", zap.Error(err))
 	}
-	defer cons.Close()
 
-	// 5) Run consumer in background
-	ctx, cancel := context.WithCancel(context.Background())
-	go cons.Run(ctx)
+	// 5) Health probes and metrics on the admin port
+	hc := health.NewHandler(log)
+	hc.AddLiveness("consumer", cons.Watchdog().Check(cfg.Inventory.StuckAfter))
+	hc.AddReadiness("kafka", health.KafkaBrokers(kconn))
+	hc.AddReadiness("consumer-group", cons.Ready)
+	mux := http.NewServeMux()
+	hc.Register(mux)
+	metrics.Register(mux)
 
-	// 6) Wait for OS signal (Ctrl+C)
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
-	<-sig
+	// 6) Register components: the admin server first so probes answer
+	//    until the end, then the producer so it is flushed only after the
+	//    consumer has drained and committed its offsets. Readiness is
+	//    dropped first of all.
+	lc := lifecycle.New(log, cfg.ShutdownTimeout)
+	lc.Append(lifecycle.Hook{Name: "tracing", OnStop: shutdownTracing})
+	lc.HTTPServer("admin", &http.Server{Addr: cfg.Inventory.AdminAddr, Handler: mux})
+	lc.Closer("producer", prod.Close)
+	lc.Go("consumer", cons.Run, cons.Close)
+	lc.Append(lifecycle.Hook{Name: "readiness", OnStop: hc.Drain})
 
-	// 7) Begin shutdown
-	log.Info("Shutdown signal received")
-	cancel()
-	time.Sleep(5 * time.Second)
+	// 7) Run until SIGINT/SIGTERM, then shut down in order
+	if err := lc.Run(); err != nil {
+		log.Error("Shutdown completed with errors", zap.Error(err))
+		return
+	}
 	log.Info("Exited cleanly")
 }
@@ -5,9 +5,16 @@ import (
 	"encoding/json"
 	"errors"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"e-commerce/common/config"
+	"e-commerce/common/dedupe"
+	"e-commerce/common/kafkaclient"
+	"e-commerce/common/logger"
+	"e-commerce/common/metrics"
 	"e-commerce/common/models"
+	"e-commerce/common/tracing"
 
 	"github.com/segmentio/kafka-go"
 	"go.uber.org/zap"
@@ -15,87 +22,112 @@ import (
 
 // InventoryProducer adds retry and dedupe logic.
 type InventoryProducer struct {
-	reservedWriter *kafka.Writer
-	failedWriter   *kafka.Writer
-	logger         *zap.Logger
-	seenKeys       sync.Map // dedupe by orderID
+	writer   *kafka.Writer
+	logger   *zap.Logger
+	seenKeys sync.Map // dedupe by orderID
+
+	retry atomic.Pointer[config.Retry] // swapped on config reload
 }
 
-func NewInventoryProducer(brokers []string, log *zap.Logger) *InventoryProducer {
-	return &InventoryProducer{
-		reservedWriter: kafka.NewWriter(kafka.WriterConfig{
-			Brokers:  brokers,
-			Topic:    "inventory.reserved",
-			Balancer: &kafka.Hash{},
-		}),
-		failedWriter: kafka.NewWriter(kafka.WriterConfig{
-			Brokers:  brokers,
-			Topic:    "inventory.failed",
+// NewInventoryProducer creates a writer on the inventory events topic.
+// Both outcomes go to it keyed by orderID, so an order's events stay in
+// one partition, in the order they were published.
+func NewInventoryProducer(conn *kafkaclient.Conn, topics config.Topics, retry config.Retry, log *zap.Logger) *InventoryProducer {
+	p := &InventoryProducer{
+		writer: kafka.NewWriter(kafka.WriterConfig{
+			Brokers:  conn.Brokers,
+			Topic:    topics.InventoryEvents,
+			Dialer:   conn.Dialer(""),
 			Balancer: &kafka.Hash{},
 		}),
 		logger: log,
 	}
+	p.SetRetry(retry)
+	return p
+}
+
+// SetRetry replaces the retry policy for subsequent publishes.
+func (p *InventoryProducer) SetRetry(r config.Retry) {
+	p.retry.Store(&r)
 }
 
-// publishWithRetry writes the message, retrying on transient errors,
-// and dedupes by the provided key (orderID), not by topic.
+// publishWithRetry writes the message, keyed by orderID and carrying
+// eventID in its headers, retrying on transient errors. It dedupes by
+// eventID, so a reservation and a failure for one order are both sent.
 func (p *InventoryProducer) publishWithRetry(
+	ctx context.Context,
 	writer *kafka.Writer,
 	orderID string,
+	eventID string,
 	value []byte,
-) error {
-	// Deduplication: skip if we've already published this orderID
-	if _, loaded := p.seenKeys.LoadOrStore(orderID, true); loaded {
-		p.logger.Warn("Duplicate publish skipped", zap.String("orderID", orderID))
+) (err error) {
+	ctx, span := tracing.StartPublish(ctx, tracer, writer.Topic, orderID)
+	defer func() { tracing.End(span, err) }()
+	log := logger.WithContext(ctx, p.logger)
+
+	// Deduplication: skip if we've already published this event
+	if _, loaded := p.seenKeys.LoadOrStore(eventID, true); loaded && !dedupe.Bypassed(ctx) {
+		log.Warn("Duplicate publish skipped", zap.String("orderID", orderID), zap.String("eventID", eventID))
+		metrics.DedupeHits.WithLabelValues("inventory-producer").Inc()
 		return nil
 	}
 
-	msg := kafka.Message{Key: []byte(orderID), Value: value}
-	backoff := 100 * time.Millisecond
-	for attempt := 1; attempt <= 5; attempt++ {
+	msg := kafka.Message{Key: []byte(orderID), Value: value,
+		Headers: []kafka.Header{{Key: dedupe.EventIDHeader, Value: []byte(eventID)}}}
+	tracing.InjectKafka(ctx, &msg)
+	retry := p.retry.Load()
+	backoff := retry.Backoff
+	for attempt := 1; attempt <= retry.MaxAttempts; attempt++ {
+		metrics.PublishAttempts.WithLabelValues(writer.Topic).Inc()
 		if err := writer.WriteMessages(context.Background(), msg); err != nil {
-			p.logger.Warn("Publish failed, retrying",
+			if attempt == retry.MaxAttempts {
+				log.Warn("Publish failed", zap.String("topic", writer.Topic), zap.String("orderID", orderID),
+					zap.Error(err), zap.Int("attempt", attempt))
+				break
+			}
+			log.Warn("Publish failed, retrying",
 				zap.String("topic", writer.Topic),
 				zap.String("orderID", orderID),
 				zap.Error(err),
 				zap.Int("attempt", attempt),
 			)
+			metrics.PublishRetries.WithLabelValues(writer.Topic).Inc()
 			time.Sleep(backoff)
 			backoff *= 2
 			continue
 		}
-		p.logger.Info("Published event",
+		log.Info("Published event",
 			zap.String("topic", writer.Topic),
 			zap.String("orderID", orderID),
 		)
 		return nil
 	}
+	metrics.PublishFailures.WithLabelValues(writer.Topic).Inc()
 	return errors.New("failed to publish after retries")
 }
 
 // EmitReserved publishes a Reservation event.
-func (p *InventoryProducer) EmitReserved(evt models.InventoryReserved) error {
+func (p *InventoryProducer) EmitReserved(ctx context.Context, evt models.InventoryReserved) error {
 	data, err := json.Marshal(evt)
 	if err != nil {
 		return err
 	}
-	return p.publishWithRetry(p.reservedWriter, evt.OrderID, data)
+	return p.publishWithRetry(ctx, p.writer, evt.OrderID,
+		dedupe.EventID(models.TypeInventoryReserved, evt.OrderID, 1), data)
 }
 
 // EmitFailed publishes a Failure event.
-func (p *InventoryProducer) EmitFailed(evt models.InventoryFailed) error {
+func (p *InventoryProducer) EmitFailed(ctx context.Context, evt models.InventoryFailed) error {
 	data, err := json.Marshal(evt)
 	if err != nil {
 		return err
 	}
-	return p.publishWithRetry(p.failedWriter, evt.OrderID, data)
+	return p.publishWithRetry(ctx, p.writer, evt.OrderID,
+		dedupe.EventID(models.TypeInventoryFailed, evt.OrderID, 1), data)
 }
 
-// Close flushes both writers.
+// Close flushes the writer.
 func (p *InventoryProducer) Close() error {
 	p.logger.Info("Closing InventoryProducer")
-	if err := p.reservedWriter.Close(); err != nil {
-		return err
-	}
-	return p.failedWriter.Close()
+	return p.writer.Close()
 }
@@ -5,8 +5,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"sync"
-
+	"sync/atomic"
+	"time"
+
+	"e-commerce/common/config"
+	"e-commerce/common/dedupe"
+	"e-commerce/common/kafkaclient"
+	"e-commerce/common/logger"
+	"e-commerce/common/metrics"
 	"e-commerce/common/models"
+	"e-commerce/common/tracing"
 
 	"github.com/IBM/sarama"
 	"go.uber.org/zap"
@@ -21,16 +29,26 @@ type ReserveService interface {
 // TransactionalProducer wraps an idempotent SyncProducer and
 // uses an in-memory dedupe map to ensure exactly-once behavior.
 type TransactionalProducer struct {
-	prod      sarama.SyncProducer
-	logger    *zap.Logger
-	seen      sync.Map // tracks OrderIDs we've already published
-	topicOK   string   // topic for successful reservations
-	topicFail string   // topic for failed reservations
+	prod   sarama.SyncProducer
+	logger *zap.Logger
+	seen   sync.Map // tracks OrderIDs we've already published
+	topic  string   // topic for both reservation outcomes
+
+	retry atomic.Pointer[config.Retry] // swapped on config reload
 }
 
+var tracer = tracing.Tracer("e-commerce/inventory/producer")
+
 // NewTransactionalProducer configures Sarama for idempotence.
 // We set Net.MaxOpenRequests=1 to satisfy the idempotence requirement.
-func NewTransactionalProducer(brokers []string, clientID string, logger *zap.Logger) (*TransactionalProducer, error) {
+// retry governs how often a send Sarama gave up on is tried again.
+func NewTransactionalProducer(
+	conn *kafkaclient.Conn,
+	clientID string,
+	topics config.Topics,
+	retry config.Retry,
+	logger *zap.Logger,
+) (*TransactionalProducer, error) {
 	cfg := sarama.NewConfig()
 	cfg.ClientID = clientID
 	cfg.Version = sarama.V2_5_0_0
@@ -39,23 +57,31 @@ func NewTransactionalProducer(brokers []string, clientID string, logger *zap.Log
 	cfg.Producer.Idempotent = true
 	cfg.Net.MaxOpenRequests = 1
 
-	// Wait for all in-sync replicas to ack, retry up to 5 times
+	// Wait for all in-sync replicas to ack; idempotence needs at least
+	// one internal retry, the rest are ours so the policy can be reloaded
 	cfg.Producer.RequiredAcks = sarama.WaitForAll
-	cfg.Producer.Retry.Max = 5
+	cfg.Producer.Retry.Max = 1
 	cfg.Producer.Return.Successes = true
+	conn.Sarama(cfg)
 
 	// Create the SyncProducer (blocks until ack)
-	prod, err := sarama.NewSyncProducer(brokers, cfg)
+	prod, err := sarama.NewSyncProducer(conn.Brokers, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("creating sync producer: %w", err)
 	}
 
-	return &TransactionalProducer{
-		prod:      prod,
-		logger:    logger,
-		topicOK:   "inventory.reserved",
-		topicFail: "inventory.failed",
-	}, nil
+	tp := &TransactionalProducer{
+		prod:   prod,
+		logger: logger,
+		topic:  topics.InventoryEvents,
+	}
+	tp.SetRetry(retry)
+	return tp, nil
+}
+
+// SetRetry replaces the retry policy for subsequent publishes.
+func (tp *TransactionalProducer) SetRetry(r config.Retry) {
+	tp.retry.Store(&r)
 }
 
 // Process does four things:
@@ -70,50 +96,85 @@ func (tp *TransactionalProducer) Process(
 	session sarama.ConsumerGroupSession,
 	stockSvc ReserveService,
 ) error {
-	// 1) App-level dedupe: skip if we've already seen this order
-	if _, dup := tp.seen.LoadOrStore(order.OrderID, true); dup {
-		tp.logger.Warn("duplicate order skipped", zap.String("orderID", order.OrderID))
+	log := logger.WithContext(ctx, tp.logger)
+
+	// 1) App-level dedupe: skip if we've already seen this order,
+	//    unless this is a replay marked to bypass dedupe
+	if _, dup := tp.seen.LoadOrStore(order.OrderID, true); dup && !dedupe.Bypassed(ctx) {
+		log.Warn("duplicate order skipped", zap.String("orderID", order.OrderID))
+		metrics.DedupeHits.WithLabelValues("inventory-producer").Inc()
 		session.MarkMessage(msg, "") // commit offset so we don't reprocess
+		metrics.MessagesCommitted.WithLabelValues(msg.Topic).Inc()
 		return nil
 	}
 
 	// 2) Business logic: attempt to reserve stock
 	reserved, err := stockSvc.Reserve(order.Items)
 
-	// Choose topic & payload based on success/failure
-	topic := tp.topicOK
+	// Choose event type & payload based on success/failure; both go to
+	// one topic keyed by OrderID so consumers see them in order
+	topic := tp.topic
+	eventID := dedupe.EventID(models.TypeInventoryReserved, order.OrderID, 1)
 	var payload []byte
 	if err != nil || !reserved {
-		topic = tp.topicFail
+		eventID = dedupe.EventID(models.TypeInventoryFailed, order.OrderID, 1)
 		evt := models.InventoryFailed{
 			OrderID: order.OrderID,
+			UserID:  order.UserID,
 			Items:   order.Items,
+			Total:   order.Total,
 			Reason:  fmt.Sprintf("%v", err),
 		}
 		payload, _ = json.Marshal(evt)
 	} else {
 		evt := models.InventoryReserved{
 			OrderID: order.OrderID,
+			UserID:  order.UserID,
 			Items:   order.Items,
+			Total:   order.Total,
 		}
 		payload, _ = json.Marshal(evt)
 	}
 
-	// 3) Produce the event
-	if _, _, err := tp.prod.SendMessage(&sarama.ProducerMessage{
-		Topic: topic,
-		Key:   sarama.StringEncoder(order.OrderID), // key by OrderID
-		Value: sarama.ByteEncoder(payload),
-	}); err != nil {
+	// 3) Produce the event with exponential backoff, carrying the trace
+	//    context onward in the headers
+	pctx, span := tracing.StartPublish(ctx, tracer, topic, order.OrderID)
+	retry := tp.retry.Load()
+	backoff := retry.Backoff
+	for attempt := 1; attempt <= retry.MaxAttempts; attempt++ {
+		// A fresh message each time: Sarama keeps its retry state on it
+		out := &sarama.ProducerMessage{
+			Topic: topic,
+			Key:   sarama.StringEncoder(order.OrderID), // key by OrderID
+			Value: sarama.ByteEncoder(payload),
+			Headers: []sarama.RecordHeader{
+				{Key: []byte(dedupe.EventIDHeader), Value: []byte(eventID)},
+			},
+		}
+		tracing.InjectSarama(pctx, out)
+		metrics.PublishAttempts.WithLabelValues(topic).Inc()
+		if _, _, err = tp.prod.SendMessage(out); err == nil || attempt == retry.MaxAttempts {
+			break
+		}
+		log.Warn("publish failed, retrying",
+			zap.String("orderID", order.OrderID), zap.Error(err), zap.Int("attempt", attempt))
+		metrics.PublishRetries.WithLabelValues(topic).Inc()
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	tracing.End(span, err)
+	if err != nil {
+		metrics.PublishFailures.WithLabelValues(topic).Inc()
 		return fmt.Errorf("send message: %w", err)
 	}
-	tp.logger.Info("published event",
+	log.Info("published event",
 		zap.String("orderID", order.OrderID),
 		zap.String("topic", topic),
 	)
 
 	// 4) Commit offset so Kafka knows we've processed this message
 	session.MarkMessage(msg, "")
+	metrics.MessagesCommitted.WithLabelValues(msg.Topic).Inc()
 
 	return nil
 }
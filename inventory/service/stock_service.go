@@ -3,6 +3,8 @@ package service
 import (
 	"fmt"
 	"sync"
+
+	"e-commerce/common/metrics"
 )
 
 // StockService manages available item quantities.
@@ -13,6 +15,9 @@ type StockService struct {
 
 // NewStockService seeds the initial stock levels.
 func NewStockService(initial map[string]int) *StockService {
+	for sku, qty := range initial {
+		metrics.StockLevel.WithLabelValues(sku).Set(float64(qty))
+	}
 	return &StockService{stock: initial}
 }
 
@@ -37,6 +42,7 @@ func (s *StockService) Reserve(items []string) (bool, error) {
 	// All available → decrement
 	for _, item := range items {
 		s.stock[item]--
+		metrics.StockLevel.WithLabelValues(item).Set(float64(s.stock[item]))
 	}
 	return true, nil
 }
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+
+	"e-commerce/common/config"
+	"e-commerce/common/health"
+	"e-commerce/common/kafkaclient"
+	"e-commerce/common/lifecycle"
+	"e-commerce/common/logger"
+	"e-commerce/common/metrics"
+	"e-commerce/lagmonitor/monitor"
+
+	"go.uber.org/zap"
+)
+
+func main() {
+	// 1. Load config + logger
+	cfg := config.MustLoad()
+	log, level, err := logger.NewLeveled(cfg.Env, cfg.LogLevel)
+	if err != nil {
+		panic("failed to init logger: " + err.Error())
+	}
+	defer log.Sync()
+	log.Info("Starting Lag Monitor", zap.String("env", cfg.Env), zap.Strings("groups", cfg.LagMonitor.Groups))
+
+	rt := config.NewRuntime(cfg, log)
+	logger.WatchLevel(rt, log, level)
+	rt.Watch()
+
+	// 1b. Kafka connection settings (TLS/SASL) shared by every client
+	kconn, err := kafkaclient.New(cfg.Kafka)
+	if err != nil {
+		log.Fatal("kafka client config failed", zap.Error(err))
+	}
+	clientID := config.ClientID(cfg.LagMonitor.ClientID)
+
+	// 2. Alerts go to ops.alerts; the monitor polls the brokers
+	pub := monitor.NewKafkaPublisher(kconn, cfg.Topics.OpsAlerts, clientID)
+	lm := cfg.LagMonitor
+	alerter := monitor.NewAlerter(lm.Warn, lm.Critical, lm.Realert, pub, log)
+	mon := monitor.New(kconn.Client(clientID), lm.Groups, lm.Interval, alerter, log)
+
+	// 3. Health, metrics and the JSON lag report on the admin port
+	hc := health.NewHandler(log)
+	hc.AddLiveness("collector", mon.Fresh(3*lm.Interval))
+	hc.AddReadiness("kafka", health.KafkaBrokers(kconn))
+	mux := http.NewServeMux()
+	hc.Register(mux)
+	metrics.Register(mux)
+	mux.Handle("GET /lag", mon.Handler())
+
+	// 4. Register components with the lifecycle manager
+	lc := lifecycle.New(log, cfg.ShutdownTimeout)
+	lc.HTTPServer("admin", &http.Server{Addr: lm.AdminAddr, Handler: mux})
+	lc.Closer("alert-publisher", pub.Close)
+	lc.Go("monitor", mon.Run)
+	lc.Append(lifecycle.Hook{Name: "readiness", OnStop: hc.Drain})
+
+	// 5. Run until SIGINT/SIGTERM
+	if err := lc.Run(); err != nil {
+		log.Error("Shutdown completed with errors", zap.Error(err))
+		return
+	}
+	log.Info("Lag Monitor shut down cleanly")
+}
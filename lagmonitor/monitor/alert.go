@@ -0,0 +1,165 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"e-commerce/common/config"
+	"e-commerce/common/kafkaclient"
+	"e-commerce/common/metrics"
+	"e-commerce/common/models"
+
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+// Publisher delivers alerts.
+type Publisher interface {
+	Publish(ctx context.Context, alert models.OpsAlert) error
+}
+
+// Alerter turns snapshots into alerts. It alerts when a group first
+// breaches a threshold, when its severity changes, every realert while
+// it stays breached, and once more when it recovers.
+type Alerter struct {
+	warn     config.LagThreshold
+	critical config.LagThreshold
+	realert  time.Duration
+	pub      Publisher
+	logger   *zap.Logger
+
+	state map[string]alertState // by group; only touched from the monitor loop
+}
+
+type alertState struct {
+	severity string
+	sent     time.Time
+}
+
+// NewAlerter creates an Alerter publishing through pub.
+func NewAlerter(warn, critical config.LagThreshold, realert time.Duration, pub Publisher, log *zap.Logger) *Alerter {
+	return &Alerter{
+		warn:     warn,
+		critical: critical,
+		realert:  realert,
+		pub:      pub,
+		logger:   log,
+		state:    map[string]alertState{},
+	}
+}
+
+// Evaluate compares each group in snap against the thresholds and
+// publishes the alerts due. Groups that could not be read keep their
+// previous state. A failed publish is retried on the next snapshot.
+func (a *Alerter) Evaluate(ctx context.Context, snap *Snapshot) {
+	for _, g := range snap.Groups {
+		if g.Error != "" {
+			continue
+		}
+		prev := a.state[g.Group]
+		sev := a.severity(g)
+
+		var alert models.OpsAlert
+		switch {
+		case sev == "" && prev.severity == "":
+			continue
+		case sev == "":
+			alert = a.alert(g, models.SeverityResolved, snap.Time)
+			alert.Summary = fmt.Sprintf("%s caught up: %d messages, %s behind", g.Group, g.TotalLag, seconds(g.SecondsBehind))
+		case sev != prev.severity || snap.Time.Sub(prev.sent) >= a.realert:
+			alert = a.alert(g, sev, snap.Time)
+		default:
+			continue
+		}
+
+		if err := a.pub.Publish(ctx, alert); err != nil {
+			a.logger.Error("Publishing lag alert failed", zap.String("group", g.Group), zap.Error(err))
+			continue
+		}
+		metrics.LagAlerts.WithLabelValues(g.Group, alert.Severity).Inc()
+		a.logger.Warn("Lag alert", zap.String("group", g.Group), zap.String("severity", alert.Severity),
+			zap.Int64("lag", g.TotalLag), zap.Float64("seconds_behind", g.SecondsBehind))
+		if sev == "" {
+			delete(a.state, g.Group)
+		} else {
+			a.state[g.Group] = alertState{severity: sev, sent: snap.Time}
+		}
+	}
+}
+
+func (a *Alerter) severity(g GroupLag) string {
+	switch {
+	case breached(a.critical, g):
+		return models.SeverityCritical
+	case breached(a.warn, g):
+		return models.SeverityWarning
+	}
+	return ""
+}
+
+func breached(t config.LagThreshold, g GroupLag) bool {
+	return (t.Messages > 0 && g.TotalLag > t.Messages) ||
+		(t.Behind > 0 && g.SecondsBehind > t.Behind.Seconds())
+}
+
+func (a *Alerter) alert(g GroupLag, sev string, at time.Time) models.OpsAlert {
+	th := a.warn
+	if sev == models.SeverityCritical {
+		th = a.critical
+	}
+	return models.OpsAlert{
+		Source:   "lagmonitor",
+		Kind:     "consumer_lag",
+		Severity: sev,
+		Subject:  g.Group,
+		Summary: fmt.Sprintf("%s is %d messages and %s behind (%s above %d messages or %s)",
+			g.Group, g.TotalLag, seconds(g.SecondsBehind), sev, th.Messages, th.Behind),
+		Details: map[string]any{
+			"total_lag":      g.TotalLag,
+			"seconds_behind": g.SecondsBehind,
+			"partitions":     g.Partitions,
+		},
+		Time: at,
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return (time.Duration(s * float64(time.Second))).Round(time.Second)
+}
+
+// KafkaPublisher writes alerts as JSON to the ops alerts topic, keyed by
+// subject.
+type KafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+// NewKafkaPublisher creates a publisher for topic.
+func NewKafkaPublisher(conn *kafkaclient.Conn, topic, clientID string) *KafkaPublisher {
+	return &KafkaPublisher{writer: kafka.NewWriter(kafka.WriterConfig{
+		Brokers:  conn.Brokers,
+		Topic:    topic,
+		Dialer:   conn.Dialer(clientID),
+		Balancer: &kafka.Hash{},
+	})}
+}
+
+// Publish sends one alert.
+func (p *KafkaPublisher) Publish(ctx context.Context, alert models.OpsAlert) error {
+	data, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	metrics.PublishAttempts.WithLabelValues(p.writer.Topic).Inc()
+	if err := p.writer.WriteMessages(ctx, kafka.Message{Key: []byte(alert.Subject), Value: data}); err != nil {
+		metrics.PublishFailures.WithLabelValues(p.writer.Topic).Inc()
+		return err
+	}
+	return nil
+}
+
+// Close flushes and closes the writer.
+func (p *KafkaPublisher) Close() error {
+	return p.writer.Close()
+}
@@ -0,0 +1,286 @@
+// Package monitor computes consumer group lag from the brokers' point of
+// view: committed offsets against high-water marks, plus how old the
+// oldest unconsumed message is.
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"e-commerce/common/health"
+	"e-commerce/common/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+// PartitionLag is one partition's position for a group.
+type PartitionLag struct {
+	Topic         string  `json:"topic"`
+	Partition     int     `json:"partition"`
+	Committed     int64   `json:"committed"` // -1 if the group never committed here
+	HighWaterMark int64   `json:"high_water_mark"`
+	Lag           int64   `json:"lag"`
+	SecondsBehind float64 `json:"seconds_behind"` // age of the oldest unconsumed message
+}
+
+// GroupLag summarises one consumer group.
+type GroupLag struct {
+	Group         string         `json:"group"`
+	TotalLag      int64          `json:"total_lag"`
+	SecondsBehind float64        `json:"seconds_behind"` // worst partition
+	Partitions    []PartitionLag `json:"partitions"`
+	Error         string         `json:"error,omitempty"`
+}
+
+// Snapshot is the result of one collection pass.
+type Snapshot struct {
+	Time   time.Time  `json:"time"`
+	Groups []GroupLag `json:"groups"`
+}
+
+// Monitor polls the brokers for every watched group on an interval,
+// records the result as metrics and hands it to the alerter.
+type Monitor struct {
+	client   *kafka.Client
+	groups   []string
+	interval time.Duration
+	alerter  *Alerter
+	logger   *zap.Logger
+	last     atomic.Pointer[Snapshot]
+}
+
+// New creates a Monitor for groups. alerter may be nil to only collect.
+func New(client *kafka.Client, groups []string, interval time.Duration, alerter *Alerter, log *zap.Logger) *Monitor {
+	return &Monitor{client: client, groups: groups, interval: interval, alerter: alerter, logger: log}
+}
+
+// Run collects immediately and then once per interval until ctx is canceled.
+func (m *Monitor) Run(ctx context.Context) error {
+	m.logger.Info("Lag monitor started", zap.Strings("groups", m.groups), zap.Duration("interval", m.interval))
+	t := time.NewTicker(m.interval)
+	defer t.Stop()
+	for {
+		m.poll(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+func (m *Monitor) poll(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, m.interval)
+	defer cancel()
+
+	snap := m.Collect(ctx)
+	m.last.Store(snap)
+	for _, g := range snap.Groups {
+		if g.Error != "" {
+			continue
+		}
+		// Drop series for partitions the group no longer has
+		metrics.GroupLag.DeletePartialMatch(prometheus.Labels{"group": g.Group})
+		metrics.GroupLagSeconds.DeletePartialMatch(prometheus.Labels{"group": g.Group})
+		for _, p := range g.Partitions {
+			part := strconv.Itoa(p.Partition)
+			metrics.GroupLag.WithLabelValues(g.Group, p.Topic, part).Set(float64(p.Lag))
+			metrics.GroupLagSeconds.WithLabelValues(g.Group, p.Topic, part).Set(p.SecondsBehind)
+		}
+	}
+	if m.alerter != nil {
+		m.alerter.Evaluate(ctx, snap)
+	}
+}
+
+// Collect computes lag for every group. A group that cannot be read is
+// reported with its error rather than failing the whole snapshot.
+func (m *Monitor) Collect(ctx context.Context) *Snapshot {
+	snap := &Snapshot{Time: time.Now().UTC()}
+	for _, g := range m.groups {
+		gl, err := m.group(ctx, g)
+		if err != nil {
+			m.logger.Warn("Lag collection failed", zap.String("group", g), zap.Error(err))
+			gl = GroupLag{Group: g, Error: err.Error()}
+		}
+		snap.Groups = append(snap.Groups, gl)
+	}
+	return snap
+}
+
+type topicPartition struct {
+	topic     string
+	partition int
+}
+
+func (m *Monitor) group(ctx context.Context, group string) (GroupLag, error) {
+	gl := GroupLag{Group: group, Partitions: []PartitionLag{}}
+
+	// 1. Committed offsets for every topic the group has committed on
+	off, err := m.client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{GroupID: group})
+	if err != nil {
+		return gl, err
+	}
+	if off.Error != nil {
+		return gl, off.Error
+	}
+	if len(off.Topics) == 0 {
+		return gl, nil
+	}
+	committed := map[topicPartition]int64{}
+	topics := make([]string, 0, len(off.Topics))
+	for topic, parts := range off.Topics {
+		topics = append(topics, topic)
+		for _, p := range parts {
+			if p.Error == nil {
+				committed[topicPartition{topic, p.Partition}] = p.CommittedOffset
+			}
+		}
+	}
+
+	// 2. Every partition of those topics, including ones never committed
+	meta, err := m.client.Metadata(ctx, &kafka.MetadataRequest{Topics: topics})
+	if err != nil {
+		return gl, err
+	}
+	req := map[string][]kafka.OffsetRequest{}
+	for _, t := range meta.Topics {
+		if t.Error != nil {
+			return gl, fmt.Errorf("metadata for %s: %w", t.Name, t.Error)
+		}
+		for _, p := range t.Partitions {
+			req[t.Name] = append(req[t.Name], kafka.FirstOffsetOf(p.ID), kafka.LastOffsetOf(p.ID))
+		}
+	}
+
+	// 3. Log start and high-water mark of each partition
+	offsets, err := m.client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: req})
+	if err != nil {
+		return gl, err
+	}
+	for topic, parts := range offsets.Topics {
+		for _, p := range parts {
+			if p.Error != nil {
+				return gl, fmt.Errorf("offsets for %s/%d: %w", topic, p.Partition, p.Error)
+			}
+			pl := PartitionLag{Topic: topic, Partition: p.Partition, Committed: -1, HighWaterMark: p.LastOffset}
+
+			// Without a commit, or with one older than retention, the
+			// group will start from the log start.
+			next := p.FirstOffset
+			if c, ok := committed[topicPartition{topic, p.Partition}]; ok && c >= 0 {
+				pl.Committed = c
+				next = max(c, p.FirstOffset)
+			}
+			pl.Lag = max(p.LastOffset-next, 0)
+			if pl.Lag > 0 {
+				if pl.SecondsBehind, err = m.behind(ctx, topic, p.Partition, next); err != nil {
+					m.logger.Debug("Could not read oldest unconsumed message",
+						zap.String("topic", topic), zap.Int("partition", p.Partition), zap.Error(err))
+				}
+			}
+			gl.Partitions = append(gl.Partitions, pl)
+			gl.TotalLag += pl.Lag
+			gl.SecondsBehind = max(gl.SecondsBehind, pl.SecondsBehind)
+		}
+	}
+	sort.Slice(gl.Partitions, func(i, j int) bool {
+		a, b := gl.Partitions[i], gl.Partitions[j]
+		if a.Topic != b.Topic {
+			return a.Topic < b.Topic
+		}
+		return a.Partition < b.Partition
+	})
+	return gl, nil
+}
+
+// behind returns the age of the message at offset, i.e. how long the
+// next message the group will consume has been waiting.
+func (m *Monitor) behind(ctx context.Context, topic string, partition int, offset int64) (float64, error) {
+	resp, err := m.client.Fetch(ctx, &kafka.FetchRequest{
+		Topic:     topic,
+		Partition: partition,
+		Offset:    offset,
+		MinBytes:  1,
+		MaxBytes:  64 << 10,
+		MaxWait:   500 * time.Millisecond,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if resp.Error != nil {
+		return 0, resp.Error
+	}
+	for {
+		r, err := resp.Records.ReadRecord()
+		if errors.Is(err, io.EOF) {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		// Batches may start before the requested offset
+		if r.Offset < offset {
+			continue
+		}
+		return max(time.Since(r.Time).Seconds(), 0), nil
+	}
+}
+
+// Last returns the most recent snapshot, or nil before the first one.
+func (m *Monitor) Last() *Snapshot {
+	return m.last.Load()
+}
+
+// Fresh is a liveness check: it fails if no snapshot was taken within maxAge.
+func (m *Monitor) Fresh(maxAge time.Duration) health.Check {
+	return func(context.Context) error {
+		s := m.Last()
+		if s == nil {
+			return errors.New("no lag snapshot yet")
+		}
+		if age := time.Since(s.Time); age > maxAge {
+			return fmt.Errorf("last lag snapshot is %s old", age.Round(time.Second))
+		}
+		return nil
+	}
+}
+
+// Handler serves the latest snapshot as JSON. ?group= narrows it to one
+// consumer group.
+func (m *Monitor) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		snap := m.Last()
+		if snap == nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "no lag snapshot yet"})
+			return
+		}
+		if g := r.URL.Query().Get("group"); g != "" {
+			filtered := Snapshot{Time: snap.Time, Groups: []GroupLag{}}
+			for _, gl := range snap.Groups {
+				if gl.Group == g {
+					filtered.Groups = append(filtered.Groups, gl)
+				}
+			}
+			if len(filtered.Groups) == 0 {
+				w.WriteHeader(http.StatusNotFound)
+				_ = json.NewEncoder(w).Encode(map[string]string{"error": "group not monitored: " + g})
+				return
+			}
+			snap = &filtered
+		}
+		_ = json.NewEncoder(w).Encode(snap)
+	})
+}
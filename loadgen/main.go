@@ -0,0 +1,261 @@
+// Command loadgen drives orders through the platform at a controlled
+// rate and reports submit and end-to-end latency. End-to-end latency is
+// measured from submission until the order's inventory outcome
+// (reserved or failed) appears on the downstream topics, the events the
+// notification service consumes.
+//
+// Kafka connection settings come from the shared config (config/<env>.yaml,
+// APP_* variables), like the services.
+//
+// Examples:
+//
+//	loadgen --profile constant --rate 50 --duration 30s
+//	loadgen --profile ramp --rate 10 --peak 300 --duration 2m
+//	loadgen --profile spike --rate 20 --peak 500 --spike-at 20s --spike-for 10s --duration 1m
+//	loadgen --target kafka --dup-ratio 0.05
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"e-commerce/common/config"
+	"e-commerce/common/kafkaclient"
+	"e-commerce/common/models"
+)
+
+func main() {
+	var (
+		cfgFile   = flag.String("config", os.Getenv("APP_CONFIG_FILE"), "path to a YAML config file (default config/<env>.yaml)")
+		targetArg = flag.String("target", "http", `where to submit orders: "http" (order service) or "kafka" (orders topic directly)`)
+		url       = flag.String("url", "http://localhost:8090/orders", "order endpoint for --target http")
+
+		profileArg = flag.String("profile", "constant", "rate profile: constant, ramp or spike")
+		rps        = flag.Float64("rate", 50, "orders per second (ramp: start rate, spike: base rate)")
+		peak       = flag.Float64("peak", 200, "ramp end rate or spike rate, orders per second")
+		duration   = flag.Duration("duration", 30*time.Second, "length of the run")
+		spikeAt    = flag.Duration("spike-at", 10*time.Second, "spike start, from the beginning of the run")
+		spikeFor   = flag.Duration("spike-for", 5*time.Second, "spike length")
+		workers    = flag.Int("workers", 64, "maximum concurrent submissions")
+
+		users    = flag.Int("users", 1000, "number of distinct users")
+		userSkew = flag.Float64("user-skew", 1.1, "Zipf exponent for user popularity (>1), 0 for uniform")
+		items    = flag.String("items", "", "comma-separated SKUs to order (default: inventory.seed_stock)")
+		itemSkew = flag.Float64("item-skew", 1.2, "Zipf exponent for SKU popularity (>1), 0 for uniform")
+		maxItems = flag.Int("max-items", 3, "maximum distinct SKUs per order")
+		dupRatio = flag.Float64("dup-ratio", 0.01, "fraction of submissions that resend a recent order ID")
+		seed     = flag.Int64("seed", time.Now().UnixNano(), "random seed, for repeatable workloads")
+
+		e2e   = flag.Bool("e2e", true, "measure end-to-end latency by consuming the inventory outcome topics")
+		drain = flag.Duration("drain", 15*time.Second, "after the run, how long to wait for outstanding outcomes")
+	)
+	flag.Parse()
+
+	cfg, err := config.LoadFile(*cfgFile)
+	if err != nil {
+		fatalf("invalid configuration:\n%v", err)
+	}
+	kconn, err := kafkaclient.New(cfg.Kafka)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	clientID := config.ClientID("loadgen")
+
+	// 1. Workload: rate profile and order generator
+	prof, err := newProfile(*profileArg, *rps, *peak, *duration, *spikeAt, *spikeFor)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	skus := splitList(*items)
+	if len(skus) == 0 {
+		for sku := range cfg.Inventory.SeedStock {
+			skus = append(skus, sku)
+		}
+	}
+	runID := strconv.FormatInt(time.Now().Unix(), 36)
+	wl, err := newWorkload(*seed, runID, *users, *userSkew, skus, *itemSkew, *maxItems, *dupRatio)
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	// 2. Target
+	var tgt target
+	switch *targetArg {
+	case "http":
+		tgt = newHTTPTarget(*url, *workers)
+	case "kafka":
+		tgt = newKafkaTarget(kconn, cfg.Topics.OrdersCreated, clientID)
+	default:
+		fatalf("unknown --target %q (want http or kafka)", *targetArg)
+	}
+	defer tgt.close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// 3. Downstream tracker, positioned before the first order is sent
+	var trk *tracker
+	if *e2e {
+		trk = newTracker()
+		if err := trk.start(ctx, kconn, clientID, []string{cfg.Topics.InventoryEvents}); err != nil {
+			fatalf("starting end-to-end tracker: %v", err)
+		}
+	}
+
+	fmt.Printf("Run %s: %s against %s, seed %d\n", runID, prof, tgt, *seed)
+	res := run(ctx, prof, wl, tgt, trk, *duration, *workers)
+	if trk != nil {
+		fmt.Printf("Waiting up to %s for %d outstanding outcome(s)...\n", *drain, trk.outstanding())
+		trk.drain(*drain)
+	}
+	res.report(os.Stdout, trk)
+}
+
+// result accumulates what happened during a run.
+type result struct {
+	mu         sync.Mutex
+	elapsed    time.Duration
+	sent       int
+	duplicates int
+	outcomes   map[string]int
+	submit     latencies
+}
+
+func (r *result) record(outcome string, took time.Duration) {
+	r.mu.Lock()
+	r.outcomes[outcome]++
+	r.mu.Unlock()
+	r.submit.add(took)
+}
+
+// submission is one order handed to a worker.
+type submission struct {
+	order models.OrderCreated
+	dup   bool // resends an earlier order ID; no new outcome is expected
+}
+
+// run paces submissions to the profile until duration elapses or ctx is
+// canceled. Submissions go through a fixed worker pool; if all workers
+// are busy the pacer waits, so the achieved rate can fall short of the
+// profile and the report shows both.
+func run(ctx context.Context, prof profile, wl *workload, tgt target, trk *tracker, duration time.Duration, workers int) *result {
+	res := &result{outcomes: map[string]int{}}
+	jobs := make(chan submission, workers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s := range jobs {
+				start := time.Now()
+				if trk != nil && !s.dup {
+					trk.submitted(s.order.OrderID, start)
+				}
+				outcome := tgt.submit(ctx, s.order)
+				res.record(outcome, time.Since(start))
+				if trk != nil && !s.dup && outcome != outcomeAccepted {
+					trk.forget(s.order.OrderID)
+				}
+			}
+		}()
+	}
+
+	start := time.Now()
+	next := start
+	timer := time.NewTimer(0)
+	<-timer.C
+pace:
+	for {
+		elapsed := time.Since(start)
+		if elapsed >= duration {
+			break
+		}
+		r := prof.rate(elapsed)
+		if r <= 0 {
+			r = 1
+		}
+		next = next.Add(time.Duration(float64(time.Second) / r))
+		if wait := time.Until(next); wait > 0 {
+			timer.Reset(wait)
+			select {
+			case <-ctx.Done():
+				break pace
+			case <-timer.C:
+			}
+		}
+
+		o, dup := wl.next()
+		select {
+		case jobs <- submission{order: o, dup: dup}:
+		case <-ctx.Done():
+			break pace
+		}
+		res.sent++
+		if dup {
+			res.duplicates++
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	res.elapsed = time.Since(start)
+	return res
+}
+
+func (r *result) report(w io.Writer, trk *tracker) {
+	fmt.Fprintf(w, "\nSent            %d in %s (%.1f/s), %d duplicate ID(s)\n",
+		r.sent, r.elapsed.Round(time.Millisecond), float64(r.sent)/r.elapsed.Seconds(), r.duplicates)
+
+	names := make([]string, 0, len(r.outcomes))
+	for k := range r.outcomes {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, k := range names {
+		parts = append(parts, fmt.Sprintf("%s=%d", k, r.outcomes[k]))
+	}
+	fmt.Fprintf(w, "Outcomes        %s\n", strings.Join(parts, " "))
+	fmt.Fprintf(w, "Submit latency  %s\n", &r.submit)
+
+	if trk == nil {
+		return
+	}
+	trk.mu.Lock()
+	matched := 0
+	var byType []string
+	for typ, n := range trk.outcomes {
+		matched += n
+		byType = append(byType, fmt.Sprintf("%s=%d", typ, n))
+	}
+	missing := len(trk.pending)
+	trk.mu.Unlock()
+	sort.Strings(byType)
+	fmt.Fprintf(w, "End-to-end      %d matched (%s), %d without an outcome\n", matched, strings.Join(byType, " "), missing)
+	fmt.Fprintf(w, "E2E latency     %s\n", &trk.e2e)
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func fatalf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "loadgen: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// profile gives the target request rate, in orders per second, at a
+// point in the run.
+type profile interface {
+	rate(elapsed time.Duration) float64
+	String() string
+}
+
+// constant holds one rate for the whole run.
+type constant struct{ rps float64 }
+
+func (p constant) rate(time.Duration) float64 { return p.rps }
+func (p constant) String() string             { return fmt.Sprintf("constant %.0f/s", p.rps) }
+
+// ramp rises linearly from one rate to another over the run.
+type ramp struct {
+	from, to float64
+	over     time.Duration
+}
+
+func (p ramp) rate(elapsed time.Duration) float64 {
+	f := min(float64(elapsed)/float64(p.over), 1)
+	return p.from + (p.to-p.from)*f
+}
+
+func (p ramp) String() string {
+	return fmt.Sprintf("ramp %.0f/s -> %.0f/s over %s", p.from, p.to, p.over)
+}
+
+// spike holds a base rate with one burst at the peak rate.
+type spike struct {
+	base, peak float64
+	at, length time.Duration
+}
+
+func (p spike) rate(elapsed time.Duration) float64 {
+	if elapsed >= p.at && elapsed < p.at+p.length {
+		return p.peak
+	}
+	return p.base
+}
+
+func (p spike) String() string {
+	return fmt.Sprintf("spike %.0f/s, %.0f/s from %s for %s", p.base, p.peak, p.at, p.length)
+}
+
+func newProfile(name string, rps, peak float64, duration, spikeAt, spikeFor time.Duration) (profile, error) {
+	if rps <= 0 {
+		return nil, fmt.Errorf("--rate must be positive")
+	}
+	switch name {
+	case "constant":
+		return constant{rps: rps}, nil
+	case "ramp":
+		if peak <= 0 {
+			return nil, fmt.Errorf("--peak must be positive for a ramp")
+		}
+		return ramp{from: rps, to: peak, over: duration}, nil
+	case "spike":
+		if peak <= rps {
+			return nil, fmt.Errorf("--peak must be above --rate for a spike")
+		}
+		if spikeAt < 0 || spikeFor <= 0 || spikeAt+spikeFor > duration {
+			return nil, fmt.Errorf("--spike-at/--spike-for must fall within --duration")
+		}
+		return spike{base: rps, peak: peak, at: spikeAt, length: spikeFor}, nil
+	}
+	return nil, fmt.Errorf("unknown profile %q (want constant, ramp or spike)", name)
+}
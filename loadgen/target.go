@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"e-commerce/common/dedupe"
+	"e-commerce/common/kafkaclient"
+	"e-commerce/common/models"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Submission outcomes.
+const (
+	outcomeAccepted    = "accepted"     // 202 from the order service, or written to Kafka
+	outcomeRateLimited = "rate_limited" // 429
+	outcomeRejected    = "rejected"     // any other 4xx
+	outcomeError       = "error"        // 5xx, timeouts, connection and Kafka errors
+)
+
+// target is where orders are submitted.
+type target interface {
+	submit(ctx context.Context, o models.OrderCreated) string
+	close() error
+	String() string
+}
+
+// httpTarget posts orders to the order service.
+type httpTarget struct {
+	url    string
+	client *http.Client
+}
+
+func newHTTPTarget(url string, workers int) *httpTarget {
+	return &httpTarget{
+		url: url,
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{MaxIdleConnsPerHost: workers},
+		},
+	}
+}
+
+func (t *httpTarget) submit(ctx context.Context, o models.OrderCreated) string {
+	body, _ := json.Marshal(o)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return outcomeError
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return outcomeError
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusAccepted:
+		return outcomeAccepted
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return outcomeRateLimited
+	case resp.StatusCode < 500:
+		return outcomeRejected
+	}
+	return outcomeError
+}
+
+func (t *httpTarget) close() error {
+	t.client.CloseIdleConnections()
+	return nil
+}
+
+func (t *httpTarget) String() string { return "POST " + t.url }
+
+// kafkaTarget writes OrderCreated events straight to the orders topic,
+// bypassing the order service (and its dedupe and rate limit).
+type kafkaTarget struct {
+	writer *kafka.Writer
+}
+
+func newKafkaTarget(conn *kafkaclient.Conn, topic, clientID string) *kafkaTarget {
+	return &kafkaTarget{writer: kafka.NewWriter(kafka.WriterConfig{
+		Brokers:  conn.Brokers,
+		Topic:    topic,
+		Dialer:   conn.Dialer(clientID),
+		Balancer: &kafka.Hash{},
+		// Each worker writes synchronously; don't hold batches for the
+		// default second.
+		BatchTimeout: 5 * time.Millisecond,
+	})}
+}
+
+func (t *kafkaTarget) submit(ctx context.Context, o models.OrderCreated) string {
+	data, _ := json.Marshal(o)
+	msg := kafka.Message{Key: []byte(o.OrderID), Value: data, Headers: []kafka.Header{
+		{Key: dedupe.EventIDHeader, Value: []byte(dedupe.EventID(models.TypeOrderCreated, o.OrderID, 1))},
+	}}
+	if err := t.writer.WriteMessages(ctx, msg); err != nil {
+		return outcomeError
+	}
+	return outcomeAccepted
+}
+
+func (t *kafkaTarget) close() error { return t.writer.Close() }
+
+func (t *kafkaTarget) String() string { return "kafka " + t.writer.Topic }
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"e-commerce/common/dedupe"
+	"e-commerce/common/kafkaclient"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// tracker measures end-to-end latency: from submitting an order to its
+// outcome event (reserved or failed) appearing downstream. It reads
+// every partition of the outcome topic from its current end, so it
+// needs no consumer group and never disturbs the services' offsets.
+type tracker struct {
+	mu       sync.Mutex
+	pending  map[string]time.Time // order ID -> submitted at
+	outcomes map[string]int       // event type -> matched events
+	e2e      latencies
+
+	readers []*kafka.Reader
+	wg      sync.WaitGroup
+}
+
+func newTracker() *tracker {
+	return &tracker{pending: map[string]time.Time{}, outcomes: map[string]int{}}
+}
+
+// start positions one reader per partition at the current end of each
+// topic and starts consuming. It returns once every position is known,
+// so no outcome of an order submitted afterwards can be missed.
+func (t *tracker) start(ctx context.Context, conn *kafkaclient.Conn, clientID string, topics []string) error {
+	client := conn.Client(clientID)
+	client.Timeout = 30 * time.Second
+	meta, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: topics})
+	if err != nil {
+		return fmt.Errorf("downstream metadata: %w", err)
+	}
+	req := map[string][]kafka.OffsetRequest{}
+	for _, tp := range meta.Topics {
+		if tp.Error != nil {
+			return fmt.Errorf("downstream topic %s: %w", tp.Name, tp.Error)
+		}
+		for _, p := range tp.Partitions {
+			req[tp.Name] = append(req[tp.Name], kafka.LastOffsetOf(p.ID))
+		}
+	}
+	offsets, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: req})
+	if err != nil {
+		return fmt.Errorf("downstream offsets: %w", err)
+	}
+
+	for topic, parts := range offsets.Topics {
+		for _, p := range parts {
+			if p.Error != nil {
+				return fmt.Errorf("downstream offset %s/%d: %w", topic, p.Partition, p.Error)
+			}
+			r := kafka.NewReader(kafka.ReaderConfig{
+				Brokers:   conn.Brokers,
+				Topic:     topic,
+				Partition: p.Partition,
+				Dialer:    conn.Dialer(clientID),
+				MinBytes:  1,
+				MaxBytes:  10e6,
+				MaxWait:   100 * time.Millisecond,
+			})
+			if err := r.SetOffset(p.LastOffset); err != nil {
+				return err
+			}
+			t.readers = append(t.readers, r)
+			t.wg.Add(1)
+			go t.consume(ctx, r)
+		}
+	}
+	return nil
+}
+
+func (t *tracker) consume(ctx context.Context, r *kafka.Reader) {
+	defer t.wg.Done()
+	for {
+		m, err := r.ReadMessage(ctx)
+		if err != nil {
+			return
+		}
+		var evt struct {
+			OrderID string `json:"order_id"`
+		}
+		if json.Unmarshal(m.Value, &evt) != nil {
+			continue
+		}
+		t.mu.Lock()
+		if at, ok := t.pending[evt.OrderID]; ok {
+			delete(t.pending, evt.OrderID)
+			t.outcomes[eventType(m)]++
+			t.e2e.add(time.Since(at))
+		}
+		t.mu.Unlock()
+	}
+}
+
+// eventType reads the type from m's event ID header, falling back to
+// its topic for events published without one.
+func eventType(m kafka.Message) string {
+	for _, h := range m.Headers {
+		if h.Key == dedupe.EventIDHeader {
+			if typ := dedupe.EventType(string(h.Value)); typ != "" {
+				return typ
+			}
+		}
+	}
+	return m.Topic
+}
+
+// submitted starts the clock for an order. Call it before submitting,
+// so a fast outcome cannot arrive first.
+func (t *tracker) submitted(orderID string, at time.Time) {
+	t.mu.Lock()
+	t.pending[orderID] = at
+	t.mu.Unlock()
+}
+
+// forget stops waiting for an order the target did not accept.
+func (t *tracker) forget(orderID string) {
+	t.mu.Lock()
+	delete(t.pending, orderID)
+	t.mu.Unlock()
+}
+
+// drain waits up to timeout for outstanding outcomes, then stops the
+// readers.
+func (t *tracker) drain(timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) && t.outstanding() > 0 {
+		time.Sleep(100 * time.Millisecond)
+	}
+	for _, r := range t.readers {
+		_ = r.Close()
+	}
+	t.wg.Wait()
+}
+
+func (t *tracker) outstanding() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.pending)
+}
+
+// latencies collects samples for percentile reporting.
+type latencies struct {
+	mu      sync.Mutex
+	samples []time.Duration
+}
+
+func (l *latencies) add(d time.Duration) {
+	l.mu.Lock()
+	l.samples = append(l.samples, d)
+	l.mu.Unlock()
+}
+
+// String renders count and p50/p90/p99/max.
+func (l *latencies) String() string {
+	l.mu.Lock()
+	s := append([]time.Duration(nil), l.samples...)
+	l.mu.Unlock()
+	if len(s) == 0 {
+		return "no samples"
+	}
+	sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+	pct := func(p float64) time.Duration { return s[int(p*float64(len(s)-1))] }
+	r := func(d time.Duration) time.Duration { return d.Round(10 * time.Microsecond) }
+	return fmt.Sprintf("n=%d p50=%s p90=%s p99=%s max=%s", len(s), r(pct(.5)), r(pct(.9)), r(pct(.99)), r(s[len(s)-1]))
+}
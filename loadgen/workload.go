@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sort"
+
+	"e-commerce/common/models"
+)
+
+// workload generates orders. A few users and SKUs account for most
+// orders when skew is set (Zipf), and a fraction of submissions reuse a
+// recent order ID the way a retrying client would.
+type workload struct {
+	rng      *rand.Rand
+	users    func() int
+	items    func() int
+	skus     []string
+	prices   map[string]float64
+	maxItems int
+	dupRatio float64
+	runID    string
+
+	seq    int
+	recent []models.OrderCreated // ring buffer of recent orders to duplicate
+}
+
+func newWorkload(seed int64, runID string, users int, userSkew float64, skus []string, itemSkew float64, maxItems int, dupRatio float64) (*workload, error) {
+	if users < 1 {
+		return nil, fmt.Errorf("--users must be at least 1")
+	}
+	if len(skus) == 0 {
+		return nil, fmt.Errorf("--items must list at least one SKU")
+	}
+	if maxItems < 1 {
+		return nil, fmt.Errorf("--max-items must be at least 1")
+	}
+	if dupRatio < 0 || dupRatio >= 1 {
+		return nil, fmt.Errorf("--dup-ratio must be in [0, 1)")
+	}
+	rng := rand.New(rand.NewSource(seed))
+	userPick, err := picker(rng, users, userSkew, "--user-skew")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(skus)
+	itemPick, err := picker(rng, len(skus), itemSkew, "--item-skew")
+	if err != nil {
+		return nil, err
+	}
+
+	// Stable per-SKU prices so totals are consistent across runs
+	prices := map[string]float64{}
+	for _, s := range skus {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(s))
+		prices[s] = 5 + float64(h.Sum32()%9500)/100
+	}
+
+	return &workload{
+		rng:      rng,
+		users:    userPick,
+		items:    itemPick,
+		skus:     skus,
+		prices:   prices,
+		maxItems: min(maxItems, len(skus)),
+		dupRatio: dupRatio,
+		runID:    runID,
+		recent:   make([]models.OrderCreated, 0, 1024),
+	}, nil
+}
+
+// picker returns a func drawing indexes in [0, n): Zipf-distributed with
+// exponent skew, or uniform when skew is 0.
+func picker(rng *rand.Rand, n int, skew float64, flagName string) (func() int, error) {
+	switch {
+	case skew == 0:
+		return func() int { return rng.Intn(n) }, nil
+	case skew <= 1:
+		return nil, fmt.Errorf("%s must be 0 (uniform) or greater than 1", flagName)
+	}
+	z := rand.NewZipf(rng, skew, 1, uint64(n-1))
+	return func() int { return int(z.Uint64()) }, nil
+}
+
+// next returns the next order to submit and whether it duplicates an
+// earlier one.
+func (w *workload) next() (models.OrderCreated, bool) {
+	if len(w.recent) > 0 && w.rng.Float64() < w.dupRatio {
+		return w.recent[w.rng.Intn(len(w.recent))], true
+	}
+
+	w.seq++
+	n := 1 + w.rng.Intn(w.maxItems)
+	seen := map[string]bool{}
+	var items []string
+	total := 0.0
+	for len(items) < n {
+		sku := w.skus[w.items()]
+		if seen[sku] {
+			continue
+		}
+		seen[sku] = true
+		items = append(items, sku)
+		total += w.prices[sku]
+	}
+	o := models.OrderCreated{
+		OrderID: fmt.Sprintf("lg-%s-%d", w.runID, w.seq),
+		UserID:  fmt.Sprintf("u-%d", w.users()),
+		Items:   items,
+		Total:   math.Round(total*100) / 100,
+	}
+
+	if len(w.recent) < cap(w.recent) {
+		w.recent = append(w.recent, o)
+	} else {
+		w.recent[w.seq%len(w.recent)] = o
+	}
+	return o, false
+}
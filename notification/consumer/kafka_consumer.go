@@ -2,98 +2,121 @@ package consumer
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
+	"time"
 
-	"e-commerce/common/models"
-	"e-commerce/notification/sink"
+	"e-commerce/common/dedupe"
+	"e-commerce/common/health"
+	"e-commerce/common/kafkaclient"
+	"e-commerce/common/logger"
+	"e-commerce/common/metrics"
+	"e-commerce/common/tracing"
 
 	"github.com/segmentio/kafka-go"
 	"go.uber.org/zap"
 )
 
-// NotificationConsumer reads and notifies with structured logging.
+// NotificationConsumer reads every notification topic through one
+// group member and hands each message to the handler registered for
+// it, one at a time. Order is kept within a partition only, so an
+// order's reservation and failure share one topic keyed by order ID and
+// are told apart by Registry.HandleType.
 type NotificationConsumer struct {
-	reservedReader *kafka.Reader
-	failedReader   *kafka.Reader
-	sink           sink.NotificationSink
-	logger         *zap.Logger
+	reader   *kafka.Reader
+	handlers *Registry
+	logger   *zap.Logger
+	watchdog health.Watchdog // tracks messages in progress
 }
 
-// NewNotificationConsumer creates two readers (one per topic) sharing the same group.
+var tracer = tracing.Tracer("e-commerce/notification/consumer")
+
+// NewNotificationConsumer creates a reader subscribed to every topic in
+// handlers. clientID identifies this instance to the group coordinator.
 func NewNotificationConsumer(
-	brokers []string,
+	conn *kafkaclient.Conn,
+	handlers *Registry,
 	groupID string,
-	notifSink sink.NotificationSink,
+	clientID string,
 	log *zap.Logger,
 ) *NotificationConsumer {
 	return &NotificationConsumer{
-		reservedReader: kafka.NewReader(kafka.ReaderConfig{
-			Brokers:        brokers,
-			Topic:          "inventory.reserved",
-			GroupID:        groupID,
-			MinBytes:       10e3,
-			MaxBytes:       10e6,
-			CommitInterval: 0,
-		}),
-		failedReader: kafka.NewReader(kafka.ReaderConfig{
-			Brokers:        brokers,
-			Topic:          "inventory.failed",
+		reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers:        conn.Brokers,
+			GroupTopics:    handlers.Topics(),
 			GroupID:        groupID,
+			Dialer:         conn.Dialer(clientID),
 			MinBytes:       10e3,
 			MaxBytes:       10e6,
 			CommitInterval: 0,
 		}),
-		sink:   notifSink,
-		logger: log,
+		handlers: handlers,
+		logger:   log,
 	}
 }
 
-// Run starts two goroutines, one for each topic reader.
-// It returns when the context is canceled.
-func (c *NotificationConsumer) Run(ctx context.Context) {
-	c.logger.Info("🔔 Notification consumer started")
-	// Helper to process one reader
-	process := func(reader *kafka.Reader, handle func([]byte) error) {
-		for {
-			m, err := reader.FetchMessage(ctx)
-			if err != nil {
-				c.logger.Warn("FetchMessage error", zap.Error(err))
-				return
-			}
-			if err := handle(m.Value); err != nil {
-				c.logger.Error("Handle message error", zap.Error(err))
-			}
-			if err := reader.CommitMessages(ctx, m); err != nil {
-				c.logger.Warn("Commit offset failed", zap.Error(err))
+// Run handles messages until ctx is cancelled, or fails if fetching
+// does. It returns once the in-flight message has been handled and
+// committed.
+func (c *NotificationConsumer) Run(ctx context.Context) error {
+	c.logger.Info("🔔 Notification consumer started", zap.Strings("topics", c.handlers.Topics()))
+	commitCtx := context.WithoutCancel(ctx)
+	for {
+		m, err := c.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
 			}
+			c.logger.Warn("FetchMessage error, stopping consumer", zap.Error(err))
+			return err
 		}
-	}
+		metrics.MessagesConsumed.WithLabelValues(m.Topic).Inc()
+		metrics.ObserveLag(m.Topic, m.Partition, m.Offset, m.HighWaterMark)
 
-	// Reserved
-	go process(c.reservedReader, func(val []byte) error {
-		var evt models.InventoryReserved
-		if err := json.Unmarshal(val, &evt); err != nil {
-			return err
+		start := time.Now()
+		end := c.watchdog.Begin()
+		mctx := tracing.ExtractKafka(commitCtx, &m)
+		if id := header(m, dedupe.EventIDHeader); id != "" {
+			mctx = dedupe.WithEventID(mctx, id)
 		}
-		return c.sink.NotifyReserved(evt)
-	})
-	// Failed
-	go process(c.failedReader, func(val []byte) error {
-		var evt models.InventoryFailed
-		if err := json.Unmarshal(val, &evt); err != nil {
-			return err
+		mctx, span := tracing.StartProcess(mctx, tracer, m.Topic, m.Partition, m.Offset, string(m.Key))
+		if handle := c.handlers.lookup(m); handle != nil {
+			err = handle(mctx, m)
+		} else {
+			err = fmt.Errorf("no handler for topic %s", m.Topic)
+		}
+		if err != nil {
+			logger.WithContext(mctx, c.logger).Error("Handle message error", zap.String("topic", m.Topic), zap.Error(err))
+			metrics.MessagesFailed.WithLabelValues(m.Topic).Inc()
 		}
-		return c.sink.NotifyFailed(evt)
-	})
+		tracing.End(span, err)
+		end()
+		metrics.ProcessingDuration.WithLabelValues(m.Topic).Observe(time.Since(start).Seconds())
 
-	<-ctx.Done()
+		if err := c.reader.CommitMessages(commitCtx, m); err != nil {
+			c.logger.Warn("Commit offset failed", zap.Error(err))
+			continue
+		}
+		metrics.MessagesCommitted.WithLabelValues(m.Topic).Inc()
+	}
 }
 
-// Close shuts down both readers.
+// header returns the value of a message header, or "".
+func header(m kafka.Message, key string) string {
+	for _, h := range m.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// Watchdog exposes the in-progress message tracker for liveness checks.
+func (c *NotificationConsumer) Watchdog() *health.Watchdog {
+	return &c.watchdog
+}
+
+// Close shuts down the reader.
 func (c *NotificationConsumer) Close() error {
 	c.logger.Info("Closing NotificationConsumer")
-	if err := c.reservedReader.Close(); err != nil {
-		return err
-	}
-	return c.failedReader.Close()
+	return c.reader.Close()
 }
@@ -0,0 +1,86 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+
+	"e-commerce/common/dedupe"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Handler handles one message. ctx carries its trace and event ID.
+type Handler func(ctx context.Context, m kafka.Message) error
+
+// JSON adapts a function taking a decoded event to a Handler.
+func JSON[T any](handle func(context.Context, T) error) Handler {
+	return func(ctx context.Context, m kafka.Message) error {
+		var evt T
+		if err := json.Unmarshal(m.Value, &evt); err != nil {
+			return err
+		}
+		return handle(ctx, evt)
+	}
+}
+
+// Registry maps topics, and event types within a topic, to handlers.
+// The consumer subscribes to every topic registered, so consuming a new
+// topic is a matter of registering its handler.
+type Registry struct {
+	topics map[string]*route
+}
+
+// route holds the handlers of one topic.
+type route struct {
+	handler Handler            // for events without a more specific handler
+	byType  map[string]Handler // by models.Type* name, from the event ID
+}
+
+func NewRegistry() *Registry {
+	return &Registry{topics: map[string]*route{}}
+}
+
+func (r *Registry) route(topic string) *route {
+	rt, ok := r.topics[topic]
+	if !ok {
+		rt = &route{byType: map[string]Handler{}}
+		r.topics[topic] = rt
+	}
+	return rt
+}
+
+// Handle registers h for the messages on topic.
+func (r *Registry) Handle(topic string, h Handler) {
+	r.route(topic).handler = h
+}
+
+// HandleType registers h for the events of type typ on topic, for
+// topics that carry several event types so that they are handled in the
+// order they were published. The type is read from the event ID
+// header; events without one go to the topic's handler.
+func (r *Registry) HandleType(topic, typ string, h Handler) {
+	r.route(topic).byType[typ] = h
+}
+
+// Topics returns the registered topics, sorted.
+func (r *Registry) Topics() []string {
+	topics := make([]string, 0, len(r.topics))
+	for t := range r.topics {
+		topics = append(topics, t)
+	}
+	slices.Sort(topics)
+	return topics
+}
+
+// lookup returns the handler for m, or nil if none is registered.
+func (r *Registry) lookup(m kafka.Message) Handler {
+	rt, ok := r.topics[m.Topic]
+	if !ok {
+		return nil
+	}
+	if h, ok := rt.byType[dedupe.EventType(header(m, dedupe.EventIDHeader))]; ok {
+		return h
+	}
+	return rt.handler
+}
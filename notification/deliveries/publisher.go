@@ -0,0 +1,49 @@
+package deliveries
+
+import (
+	"context"
+	"encoding/json"
+
+	"e-commerce/common/kafkaclient"
+	"e-commerce/common/metrics"
+	"e-commerce/common/models"
+	"e-commerce/common/tracing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// ResendPublisher publishes NotificationResent events for the audit log.
+type ResendPublisher struct {
+	writer *kafka.Writer
+}
+
+// NewResendPublisher creates a publisher for topic.
+func NewResendPublisher(conn *kafkaclient.Conn, topic, clientID string) *ResendPublisher {
+	return &ResendPublisher{writer: kafka.NewWriter(kafka.WriterConfig{
+		Brokers:  conn.Brokers,
+		Topic:    topic,
+		Dialer:   conn.Dialer(clientID),
+		Balancer: &kafka.Hash{},
+	})}
+}
+
+// Publish sends one event, keyed by order ID like every domain event.
+func (p *ResendPublisher) Publish(ctx context.Context, evt models.NotificationResent) error {
+	data, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+	msg := kafka.Message{Key: []byte(evt.OrderID), Value: data}
+	tracing.InjectKafka(ctx, &msg)
+	metrics.PublishAttempts.WithLabelValues(p.writer.Topic).Inc()
+	if err := p.writer.WriteMessages(ctx, msg); err != nil {
+		metrics.PublishFailures.WithLabelValues(p.writer.Topic).Inc()
+		return err
+	}
+	return nil
+}
+
+// Close flushes and closes the writer.
+func (p *ResendPublisher) Close() error {
+	return p.writer.Close()
+}
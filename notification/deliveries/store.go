@@ -0,0 +1,239 @@
+// Package deliveries is the notification delivery log: every
+// notification sent on a channel, each attempt at sending it, and
+// operator resends.
+package deliveries
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"e-commerce/common/sqldb"
+)
+
+// ErrNotFound means no notification has the given ID.
+var ErrNotFound = errors.New("notification not found")
+
+// Attempt outcomes.
+const (
+	Delivered = "delivered"
+	Failed    = "failed"
+)
+
+var schema = []string{`
+CREATE TABLE IF NOT EXISTS notifications (
+	id            TEXT    PRIMARY KEY,
+	order_id      TEXT    NOT NULL,
+	user_id       TEXT    NOT NULL,
+	kind          TEXT    NOT NULL,
+	channel       TEXT    NOT NULL,
+	event         TEXT    NOT NULL,
+	status        TEXT    NOT NULL,
+	attempts      INTEGER NOT NULL,
+	last_error    TEXT    NOT NULL,
+	payload_hash  TEXT    NOT NULL,
+	resend_of     TEXT    NOT NULL,
+	requested_by  TEXT    NOT NULL,
+	reason        TEXT    NOT NULL,
+	created_at_ms BIGINT  NOT NULL,
+	updated_at_ms BIGINT  NOT NULL
+)`, `
+CREATE TABLE IF NOT EXISTS notification_attempts (
+	notification_id TEXT    NOT NULL,
+	attempt         INTEGER NOT NULL,
+	status          TEXT    NOT NULL,
+	error           TEXT    NOT NULL,
+	payload_hash    TEXT    NOT NULL,
+	started_at_ms   BIGINT  NOT NULL,
+	finished_at_ms  BIGINT  NOT NULL,
+	PRIMARY KEY (notification_id, attempt)
+)`,
+	`CREATE INDEX IF NOT EXISTS notifications_order ON notifications (order_id, created_at_ms)`,
+}
+
+// Notification is one notification on one channel.
+type Notification struct {
+	ID          string          `json:"id"`
+	OrderID     string          `json:"order_id"`
+	UserID      string          `json:"user_id"`
+	Kind        string          `json:"kind"`
+	Channel     string          `json:"channel"`
+	Event       json.RawMessage `json:"event"`  // what was notified, kept for resends
+	Status      string          `json:"status"` // of the latest attempt
+	LastError   string          `json:"last_error,omitempty"`
+	PayloadHash string          `json:"payload_hash,omitempty"` // of the latest rendered message
+	ResendOf    string          `json:"resend_of,omitempty"`
+	RequestedBy string          `json:"requested_by,omitempty"` // resends only
+	Reason      string          `json:"reason,omitempty"`       // resends only
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	Attempts    []Attempt       `json:"attempts"`
+}
+
+// Attempt is one try at sending a notification.
+type Attempt struct {
+	Attempt     int       `json:"attempt"`
+	Status      string    `json:"status"`
+	Error       string    `json:"error,omitempty"`
+	PayloadHash string    `json:"payload_hash,omitempty"` // empty if it failed before rendering
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at"`
+}
+
+// NewID returns a random notification ID, for resends.
+func NewID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "ntf_" + hex.EncodeToString(b)
+}
+
+// Store reads and writes the delivery log.
+type Store struct {
+	db *sqldb.DB
+}
+
+// New creates the tables if needed.
+func New(ctx context.Context, db *sqldb.DB) (*Store, error) {
+	for _, stmt := range schema {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return nil, fmt.Errorf("creating delivery log tables: %w", err)
+		}
+	}
+	return &Store{db: db}, nil
+}
+
+// Ping is a readiness check.
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.Ping(ctx)
+}
+
+// Record logs an attempt at n, creating n on its first attempt. The
+// attempt is numbered after those already logged; n's status, error
+// and hash become the attempt's.
+func (s *Store) Record(ctx context.Context, n Notification, a Attempt) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var attempts int
+	err = tx.QueryRowContext(ctx, s.db.Rebind(`SELECT attempts FROM notifications WHERE id = ?`), n.ID).Scan(&attempts)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		_, err = tx.ExecContext(ctx, s.db.Rebind(`
+			INSERT INTO notifications (id, order_id, user_id, kind, channel, event, status, attempts, last_error,
+				payload_hash, resend_of, requested_by, reason, created_at_ms, updated_at_ms)
+			VALUES (?, ?, ?, ?, ?, ?, ?, 1, ?, ?, ?, ?, ?, ?, ?)`),
+			n.ID, n.OrderID, n.UserID, n.Kind, n.Channel, string(n.Event), a.Status, a.Error,
+			a.PayloadHash, n.ResendOf, n.RequestedBy, n.Reason, a.StartedAt.UnixMilli(), a.FinishedAt.UnixMilli())
+	case err == nil:
+		_, err = tx.ExecContext(ctx, s.db.Rebind(`
+			UPDATE notifications SET status = ?, attempts = ?, last_error = ?, payload_hash = ?, updated_at_ms = ?
+			WHERE id = ?`),
+			a.Status, attempts+1, a.Error, a.PayloadHash, a.FinishedAt.UnixMilli(), n.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("logging notification %s: %w", n.ID, err)
+	}
+	a.Attempt = attempts + 1
+	if _, err = tx.ExecContext(ctx, s.db.Rebind(`
+		INSERT INTO notification_attempts (notification_id, attempt, status, error, payload_hash, started_at_ms, finished_at_ms)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`),
+		n.ID, a.Attempt, a.Status, a.Error, a.PayloadHash, a.StartedAt.UnixMilli(), a.FinishedAt.UnixMilli()); err != nil {
+		return fmt.Errorf("logging attempt at %s: %w", n.ID, err)
+	}
+	return tx.Commit()
+}
+
+const columns = `id, order_id, user_id, kind, channel, event, status, last_error, payload_hash,
+	resend_of, requested_by, reason, created_at_ms, updated_at_ms`
+
+func scan(row interface{ Scan(...any) error }) (Notification, error) {
+	var (
+		n                Notification
+		event            string
+		created, updated int64
+	)
+	if err := row.Scan(&n.ID, &n.OrderID, &n.UserID, &n.Kind, &n.Channel, &event, &n.Status, &n.LastError,
+		&n.PayloadHash, &n.ResendOf, &n.RequestedBy, &n.Reason, &created, &updated); err != nil {
+		return Notification{}, err
+	}
+	n.Event = json.RawMessage(event)
+	n.CreatedAt = time.UnixMilli(created).UTC()
+	n.UpdatedAt = time.UnixMilli(updated).UTC()
+	return n, nil
+}
+
+// Get returns a notification with its attempts, or ErrNotFound.
+func (s *Store) Get(ctx context.Context, id string) (Notification, error) {
+	n, err := scan(s.db.QueryRowContext(ctx, s.db.Rebind(`SELECT `+columns+` FROM notifications WHERE id = ?`), id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Notification{}, ErrNotFound
+	} else if err != nil {
+		return Notification{}, err
+	}
+	if n.Attempts, err = s.attempts(ctx, id); err != nil {
+		return Notification{}, err
+	}
+	return n, nil
+}
+
+// ByOrder returns an order's notifications with their attempts, oldest
+// first.
+func (s *Store) ByOrder(ctx context.Context, orderID string) ([]Notification, error) {
+	rows, err := s.db.QueryContext(ctx, s.db.Rebind(
+		`SELECT `+columns+` FROM notifications WHERE order_id = ? ORDER BY created_at_ms, id`), orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Notification{}
+	for rows.Next() {
+		n, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range out {
+		if out[i].Attempts, err = s.attempts(ctx, out[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (s *Store) attempts(ctx context.Context, id string) ([]Attempt, error) {
+	rows, err := s.db.QueryContext(ctx, s.db.Rebind(`
+		SELECT attempt, status, error, payload_hash, started_at_ms, finished_at_ms
+		FROM notification_attempts WHERE notification_id = ? ORDER BY attempt`), id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Attempt{}
+	for rows.Next() {
+		var a Attempt
+		var started, finished int64
+		if err := rows.Scan(&a.Attempt, &a.Status, &a.Error, &a.PayloadHash, &started, &finished); err != nil {
+			return nil, err
+		}
+		a.StartedAt = time.UnixMilli(started).UTC()
+		a.FinishedAt = time.UnixMilli(finished).UTC()
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
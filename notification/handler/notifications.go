@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"e-commerce/common/dedupe"
+	"e-commerce/common/logger"
+	"e-commerce/common/metrics"
+	"e-commerce/common/models"
+	"e-commerce/notification/deliveries"
+	"e-commerce/notification/sink"
+
+	"go.uber.org/zap"
+)
+
+// Auditor records operator resends before they happen.
+type Auditor interface {
+	Publish(context.Context, models.NotificationResent) error
+}
+
+// Notifications registers the delivery log API on mux:
+//
+//	GET  /notifications?order_id=       an order's notifications and their attempts
+//	GET  /notifications/{id}            one notification
+//	POST /notifications/{id}/resend     send again on the same channel
+//
+// A resend skips dedupe on purpose and is logged as a new notification
+// pointing at the original. It needs {"requested_by", "reason"}, which
+// are published to the audit log first; if that fails, nothing is sent.
+// A channel that refuses the send (circuit open, bulkhead full) answers
+// 503 with Retry-After.
+//
+// With a non-empty token every request needs "Authorization: Bearer <token>".
+func Notifications(mux *http.ServeMux, s *deliveries.Store, router *sink.RoutingSink, audit Auditor, token string, log *zap.Logger) {
+	api := &notificationsAPI{store: s, router: router, audit: audit, logger: log}
+	auth := requireToken(token)
+	mux.Handle("GET /notifications", auth(api.list))
+	mux.Handle("GET /notifications/{id}", auth(api.get))
+	mux.Handle("POST /notifications/{id}/resend", auth(api.resend))
+}
+
+type notificationsAPI struct {
+	store  *deliveries.Store
+	router *sink.RoutingSink
+	audit  Auditor
+	logger *zap.Logger
+}
+
+func (a *notificationsAPI) fail(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, deliveries.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "no notification "+r.PathValue("id"))
+		return
+	}
+	logger.WithContext(r.Context(), a.logger).Error("Delivery log request failed", zap.String("path", r.URL.Path), zap.Error(err))
+	writeError(w, http.StatusInternalServerError, "request failed")
+}
+
+func (a *notificationsAPI) list(w http.ResponseWriter, r *http.Request) {
+	orderID := r.URL.Query().Get("order_id")
+	if orderID == "" {
+		writeError(w, http.StatusBadRequest, "order_id is required")
+		return
+	}
+	ns, err := a.store.ByOrder(r.Context(), orderID)
+	if err != nil {
+		a.fail(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"order_id": orderID, "notifications": ns})
+}
+
+func (a *notificationsAPI) get(w http.ResponseWriter, r *http.Request) {
+	n, err := a.store.Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		a.fail(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, n)
+}
+
+func (a *notificationsAPI) resend(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RequestedBy string `json:"requested_by"`
+		Reason      string `json:"reason"`
+	}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	req.RequestedBy, req.Reason = strings.TrimSpace(req.RequestedBy), strings.TrimSpace(req.Reason)
+	if req.RequestedBy == "" || req.Reason == "" {
+		writeError(w, http.StatusBadRequest, "requested_by and reason are required")
+		return
+	}
+
+	orig, err := a.store.Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		a.fail(w, r, err)
+		return
+	}
+	if !slices.Contains(a.router.Channels(), orig.Channel) {
+		writeError(w, http.StatusConflict, "channel "+orig.Channel+" is not configured")
+		return
+	}
+	evt, err := sink.DecodeEvent(orig.Kind, orig.Event)
+	if err != nil {
+		a.fail(w, r, err)
+		return
+	}
+
+	resend := sink.Resend{ID: deliveries.NewID(), Of: orig.ID, RequestedBy: req.RequestedBy, Reason: req.Reason}
+	log := logger.WithContext(r.Context(), a.logger).With(zap.String("notification", resend.ID),
+		zap.String("resendOf", orig.ID), zap.String("requestedBy", req.RequestedBy))
+	if err := a.audit.Publish(r.Context(), models.NotificationResent{
+		NotificationID: resend.ID, ResendOf: orig.ID, OrderID: orig.OrderID, UserID: orig.UserID,
+		Kind: orig.Kind, Channel: orig.Channel, RequestedBy: req.RequestedBy, Reason: req.Reason,
+		Time: time.Now().UTC(),
+	}); err != nil {
+		log.Error("Auditing resend failed, not sent", zap.Error(err))
+		metrics.NotificationResends.WithLabelValues("not_audited").Inc()
+		writeError(w, http.StatusServiceUnavailable, "could not record the resend in the audit log")
+		return
+	}
+
+	ctx := sink.WithResend(dedupe.WithBypass(r.Context()), resend)
+	sendErr := a.router.Deliver(ctx, orig.UserID, orig.Channel, evt)
+	var unavailable *sink.UnavailableError
+	if errors.As(sendErr, &unavailable) {
+		// Refused before the delivery log saw it: nothing was attempted
+		log.Warn("Channel unavailable, notification not resent", zap.Error(sendErr))
+		metrics.NotificationResends.WithLabelValues("unavailable").Inc()
+		retryAfter := max(int(math.Ceil(time.Until(unavailable.RetryAt).Seconds())), 1)
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		writeError(w, http.StatusServiceUnavailable, "channel "+orig.Channel+" is unavailable, try again later")
+		return
+	}
+	n, err := a.store.Get(r.Context(), resend.ID)
+	if err != nil {
+		a.fail(w, r, err)
+		return
+	}
+	if sendErr != nil {
+		log.Warn("Notification resend failed", zap.Error(sendErr))
+		metrics.NotificationResends.WithLabelValues("failed").Inc()
+		writeJSON(w, http.StatusBadGateway, n)
+		return
+	}
+	log.Info("Notification resent", zap.String("reason", req.Reason))
+	metrics.NotificationResends.WithLabelValues("delivered").Inc()
+	writeJSON(w, http.StatusOK, n)
+}
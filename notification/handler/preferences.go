@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"slices"
+
+	"e-commerce/notification/preferences"
+	"e-commerce/notification/sink"
+
+	"go.uber.org/zap"
+)
+
+// Preferences registers the per-user preferences API on mux:
+//
+//	GET    /users/{id}/preferences  stored preferences, or the defaults with "default": true
+//	PUT    /users/{id}/preferences  replace
+//	DELETE /users/{id}/preferences  forget, so the defaults apply again
+//
+// With a non-empty token every request needs "Authorization: Bearer <token>".
+func Preferences(mux *http.ServeMux, s *preferences.Store, router *sink.RoutingSink, token string, log *zap.Logger) {
+	api := &preferencesAPI{store: s, router: router, logger: log}
+	auth := requireToken(token)
+	mux.Handle("GET /users/{id}/preferences", auth(api.get))
+	mux.Handle("PUT /users/{id}/preferences", auth(api.put))
+	mux.Handle("DELETE /users/{id}/preferences", auth(api.delete))
+}
+
+type preferencesAPI struct {
+	store  *preferences.Store
+	router *sink.RoutingSink
+	logger *zap.Logger
+}
+
+// kinds are what users may opt out of.
+var kinds = []string{sink.OrderConfirmed, sink.OutOfStock}
+
+// localePattern accepts BCP 47 tags of the "en" and "de-CH" shape.
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+func (a *preferencesAPI) fail(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, preferences.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "no preferences stored for "+r.PathValue("id"))
+		return
+	}
+	a.logger.Error("Preferences request failed", zap.String("path", r.URL.Path), zap.Error(err))
+	writeError(w, http.StatusInternalServerError, "request failed")
+}
+
+func (a *preferencesAPI) get(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	p, err := a.store.Get(r.Context(), id)
+	if errors.Is(err, preferences.ErrNotFound) {
+		writeJSON(w, http.StatusOK, struct {
+			preferences.Preferences
+			Default bool `json:"default"`
+		}{a.router.Defaults(id), true})
+		return
+	} else if err != nil {
+		a.fail(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+// validate checks a preferences document against what this deployment
+// can deliver.
+func (a *preferencesAPI) validate(p preferences.Preferences) error {
+	var errs []error
+	channels := a.router.Channels()
+	for _, ch := range p.Channels {
+		if !slices.Contains(channels, ch) {
+			errs = append(errs, fmt.Errorf("unknown channel %q (want one of %q)", ch, channels))
+		}
+	}
+	if p.Email != "" {
+		if _, err := mail.ParseAddress(p.Email); err != nil {
+			errs = append(errs, fmt.Errorf("email %q: %w", p.Email, err))
+		}
+	} else if slices.Contains(p.Channels, "email") {
+		errs = append(errs, errors.New("email is required for the email channel"))
+	}
+	if !localePattern.MatchString(p.Locale) {
+		errs = append(errs, fmt.Errorf("locale must look like \"en\" or \"de-CH\", got %q", p.Locale))
+	}
+	if p.QuietHours != nil {
+		errs = append(errs, p.QuietHours.Validate())
+	}
+	for _, k := range p.OptOuts {
+		if !slices.Contains(kinds, k) {
+			errs = append(errs, fmt.Errorf("unknown notification kind %q (want one of %q)", k, kinds))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (a *preferencesAPI) put(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Channels   []string                `json:"channels"`
+		Email      string                  `json:"email"`
+		Locale     string                  `json:"locale"`
+		QuietHours *preferences.QuietHours `json:"quiet_hours"`
+		OptOuts    []string                `json:"opt_outs"`
+	}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	id := r.PathValue("id")
+	p := preferences.Preferences{
+		UserID: id, Channels: req.Channels, Email: req.Email, Locale: req.Locale,
+		QuietHours: req.QuietHours, OptOuts: req.OptOuts,
+	}
+	if p.Channels == nil {
+		p.Channels = []string{}
+	}
+	if p.OptOuts == nil {
+		p.OptOuts = []string{}
+	}
+	if p.Locale == "" {
+		p.Locale = a.router.Defaults(id).Locale
+	}
+	if err := a.validate(p); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	p, err := a.store.Put(r.Context(), p)
+	if err != nil {
+		a.fail(w, r, err)
+		return
+	}
+	a.logger.Info("Notification preferences stored", zap.String("userID", id), zap.Strings("channels", p.Channels))
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (a *preferencesAPI) delete(w http.ResponseWriter, r *http.Request) {
+	if err := a.store.Delete(r.Context(), r.PathValue("id")); err != nil {
+		a.fail(w, r, err)
+		return
+	}
+	a.logger.Info("Notification preferences deleted", zap.String("userID", r.PathValue("id")))
+	w.WriteHeader(http.StatusNoContent)
+}
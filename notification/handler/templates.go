@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"e-commerce/notification/templates"
+)
+
+// Templates registers the template preview API on mux:
+//
+//	GET  /templates                                   kinds, channels, locales and versions
+//	GET  /templates/{kind}/{channel}/preview          render with sample data
+//	POST /templates/{kind}/{channel}/preview          render with the order data in the body
+//
+// Previews take ?locale= (default: the default locale, with the same
+// fallback as sends), ?version= (default: the one sent) and ?format=
+// json (default), text or html; html returns the email body itself, to
+// open in a browser.
+//
+// With a non-empty token every request needs "Authorization: Bearer <token>".
+func Templates(mux *http.ServeMux, reg *templates.Registry, token string) {
+	api := &templatesAPI{registry: reg}
+	auth := requireToken(token)
+	mux.Handle("GET /templates", auth(api.list))
+	mux.Handle("GET /templates/{kind}/{channel}/preview", auth(api.preview))
+	mux.Handle("POST /templates/{kind}/{channel}/preview", auth(api.preview))
+}
+
+type templatesAPI struct {
+	registry *templates.Registry
+}
+
+func (a *templatesAPI) list(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"default_locale": a.registry.DefaultLocale(),
+		"templates":      a.registry.List(),
+	})
+}
+
+func (a *templatesAPI) preview(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	data := templates.Sample
+	if r.Method == http.MethodPost {
+		data = templates.Data{}
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&data); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+			return
+		}
+	}
+	version := 0
+	if v := q.Get("version"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "version must be a positive integer")
+			return
+		}
+		version = n
+	}
+	locale := q.Get("locale")
+	if locale == "" {
+		locale = a.registry.DefaultLocale()
+	}
+
+	m, err := a.registry.RenderVersion(r.PathValue("kind"), r.PathValue("channel"), locale, version, data)
+	if errors.Is(err, templates.ErrNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		// The data, not the template: templates render at startup
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	w.Header().Set("X-Template-Locale", m.Locale)
+	w.Header().Set("X-Template-Version", strconv.Itoa(m.Version))
+	switch q.Get("format") {
+	case "", "json":
+		writeJSON(w, http.StatusOK, m)
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte(m.Text))
+	case "html":
+		if m.HTML == "" {
+			writeError(w, http.StatusBadRequest, m.Channel+" templates have no HTML part")
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(m.HTML))
+	default:
+		writeError(w, http.StatusBadRequest, "format must be json, text or html")
+	}
+}
@@ -0,0 +1,193 @@
+// Package handler serves the notification service's admin API.
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"e-commerce/notification/webhook"
+
+	"go.uber.org/zap"
+)
+
+// Webhooks registers the subscription management API on mux:
+//
+//	POST   /webhooks/subscriptions                       create; the response carries the secret
+//	GET    /webhooks/subscriptions                       list
+//	GET    /webhooks/subscriptions/{id}                  show
+//	PATCH  /webhooks/subscriptions/{id}                  change url, events, description or enabled
+//	DELETE /webhooks/subscriptions/{id}                  delete
+//	POST   /webhooks/subscriptions/{id}/rotate-secret    new secret, returned once
+//	GET    /webhooks/subscriptions/{id}/attempts?limit=  latest delivery attempts
+//
+// With a non-empty token every request needs "Authorization: Bearer <token>".
+func Webhooks(mux *http.ServeMux, s *webhook.Store, token string, log *zap.Logger) {
+	api := &webhooksAPI{store: s, logger: log}
+	auth := requireToken(token)
+	mux.Handle("POST /webhooks/subscriptions", auth(api.create))
+	mux.Handle("GET /webhooks/subscriptions", auth(api.list))
+	mux.Handle("GET /webhooks/subscriptions/{id}", auth(api.get))
+	mux.Handle("PATCH /webhooks/subscriptions/{id}", auth(api.update))
+	mux.Handle("DELETE /webhooks/subscriptions/{id}", auth(api.delete))
+	mux.Handle("POST /webhooks/subscriptions/{id}/rotate-secret", auth(api.rotate))
+	mux.Handle("GET /webhooks/subscriptions/{id}/attempts", auth(api.attempts))
+}
+
+type webhooksAPI struct {
+	store  *webhook.Store
+	logger *zap.Logger
+}
+
+// fail maps a store error to a response.
+func (a *webhooksAPI) fail(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, webhook.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "no subscription "+r.PathValue("id"))
+		return
+	}
+	a.logger.Error("Webhook subscription request failed", zap.String("path", r.URL.Path), zap.Error(err))
+	writeError(w, http.StatusInternalServerError, "request failed")
+}
+
+func validURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http(s) URL, got %q", raw)
+	}
+	return nil
+}
+
+func validEvents(events []string) error {
+	for _, e := range events {
+		if !slices.Contains(webhook.EventTypes, e) {
+			return fmt.Errorf("unknown event type %q (want one of %q)", e, webhook.EventTypes)
+		}
+	}
+	return nil
+}
+
+// redact hides the secret outside create and rotate.
+func redact(sub webhook.Subscription) webhook.Subscription {
+	sub.Secret = ""
+	return sub
+}
+
+func (a *webhooksAPI) create(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		URL         string   `json:"url"`
+		Events      []string `json:"events"`
+		Description string   `json:"description"`
+	}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	if err := errors.Join(validURL(req.URL), validEvents(req.Events)); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	sub, err := a.store.Create(r.Context(), webhook.Subscription{URL: req.URL, Events: req.Events, Description: req.Description})
+	if err != nil {
+		a.fail(w, r, err)
+		return
+	}
+	a.logger.Info("Webhook subscription created", zap.String("id", sub.ID), zap.String("url", sub.URL))
+	writeJSON(w, http.StatusCreated, sub)
+}
+
+func (a *webhooksAPI) list(w http.ResponseWriter, r *http.Request) {
+	subs, err := a.store.List(r.Context())
+	if err != nil {
+		a.fail(w, r, err)
+		return
+	}
+	for i := range subs {
+		subs[i] = redact(subs[i])
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"subscriptions": subs})
+}
+
+func (a *webhooksAPI) get(w http.ResponseWriter, r *http.Request) {
+	sub, err := a.store.Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		a.fail(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, redact(sub))
+}
+
+func (a *webhooksAPI) update(w http.ResponseWriter, r *http.Request) {
+	var u webhook.Update
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&u); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	var errs []error
+	if u.URL != nil {
+		errs = append(errs, validURL(*u.URL))
+	}
+	if u.Events != nil {
+		errs = append(errs, validEvents(*u.Events))
+	}
+	if err := errors.Join(errs...); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	sub, err := a.store.Update(r.Context(), r.PathValue("id"), u)
+	if err != nil {
+		a.fail(w, r, err)
+		return
+	}
+	a.logger.Info("Webhook subscription updated", zap.String("id", sub.ID), zap.Bool("enabled", sub.Enabled))
+	writeJSON(w, http.StatusOK, redact(sub))
+}
+
+func (a *webhooksAPI) delete(w http.ResponseWriter, r *http.Request) {
+	if err := a.store.Delete(r.Context(), r.PathValue("id")); err != nil {
+		a.fail(w, r, err)
+		return
+	}
+	a.logger.Info("Webhook subscription deleted", zap.String("id", r.PathValue("id")))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *webhooksAPI) rotate(w http.ResponseWriter, r *http.Request) {
+	sub, err := a.store.RotateSecret(r.Context(), r.PathValue("id"))
+	if err != nil {
+		a.fail(w, r, err)
+		return
+	}
+	a.logger.Info("Webhook secret rotated", zap.String("id", sub.ID))
+	writeJSON(w, http.StatusOK, sub)
+}
+
+func (a *webhooksAPI) attempts(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 1000 {
+			writeError(w, http.StatusBadRequest, "limit must be between 1 and 1000")
+			return
+		}
+		limit = n
+	}
+	id := r.PathValue("id")
+	if _, err := a.store.Get(r.Context(), id); err != nil {
+		a.fail(w, r, err)
+		return
+	}
+	attempts, err := a.store.Attempts(r.Context(), id, limit)
+	if err != nil {
+		a.fail(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"subscription_id": id, "attempts": attempts})
+}
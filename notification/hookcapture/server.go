@@ -0,0 +1,110 @@
+// Package hookcapture is an in-process HTTP server standing in for a
+// chat incoming webhook: it accepts every JSON POST and keeps the body
+// in memory, so local runs and tests can send real ops alerts and then
+// look at what was posted.
+package hookcapture
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Post is one captured request body.
+type Post struct {
+	Body     json.RawMessage `json:"body"`
+	Received time.Time       `json:"received"`
+}
+
+// Server captures what is posted to URL.
+type Server struct {
+	ln     net.Listener
+	srv    *http.Server
+	logger *zap.Logger
+
+	mu    sync.Mutex
+	posts []Post
+}
+
+// Start listens on addr ("127.0.0.1:0" picks a free port) and serves
+// until Close.
+func Start(addr string, log *zap.Logger) (*Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{ln: ln, logger: log}
+	s.srv = &http.Server{Handler: http.HandlerFunc(s.capture), ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Warn("Webhook capture server failed", zap.Error(err))
+		}
+	}()
+	return s, nil
+}
+
+// URL is where to post.
+func (s *Server) URL() string {
+	return "http://" + s.ln.Addr().String() + "/"
+}
+
+// Posts returns the captured bodies, oldest first.
+func (s *Server) Posts() []Post {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Post(nil), s.posts...)
+}
+
+// Reset forgets the captured bodies.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.posts = nil
+}
+
+// Close stops the server.
+func (s *Server) Close() error {
+	return s.srv.Close()
+}
+
+// capture answers like a chat incoming webhook: "ok" for a JSON body,
+// 400 for anything else.
+func (s *Server) capture(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil || !json.Valid(body) {
+		http.Error(w, "invalid_payload", http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	s.posts = append(s.posts, Post{Body: body, Received: time.Now()})
+	s.mu.Unlock()
+	w.Write([]byte("ok"))
+}
+
+// Handler serves the captured bodies as JSON; DELETE clears them.
+func (s *Server) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(s.Posts())
+		case http.MethodDelete:
+			s.Reset()
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Allow", "GET, DELETE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
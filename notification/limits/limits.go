@@ -0,0 +1,263 @@
+// Package limits enforces the per-user and per-channel notification
+// rate limits and queues the notifications collapsed into digests.
+// Limits count in fixed windows; both the counts and the queued digest
+// entries are stored in the database, so a restart loses neither.
+package limits
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"e-commerce/common/config"
+	"e-commerce/common/sqldb"
+)
+
+var schema = []string{`
+CREATE TABLE IF NOT EXISTS notification_windows (
+	scope           TEXT    PRIMARY KEY,
+	window_start_ms BIGINT  NOT NULL,
+	sent            INTEGER NOT NULL
+)`, `
+CREATE TABLE IF NOT EXISTS notification_digest_entries (
+	id            TEXT    PRIMARY KEY,
+	user_id       TEXT    NOT NULL,
+	channel       TEXT    NOT NULL,
+	kind          TEXT    NOT NULL,
+	event_id      TEXT    NOT NULL,
+	payload       TEXT    NOT NULL,
+	flush_at_ms   BIGINT  NOT NULL,
+	attempts      INTEGER NOT NULL,
+	created_at_ms BIGINT  NOT NULL
+)`,
+	`CREATE INDEX IF NOT EXISTS notification_digest_entries_due ON notification_digest_entries (flush_at_ms)`,
+}
+
+// Action is what to do with a notification.
+type Action int
+
+const (
+	Allow  Action = iota // send it now
+	Digest               // queue it for the user's next digest
+	Drop                 // over a limit and digests are off, or there is no user to digest for
+)
+
+// Decision is the outcome of Take.
+type Decision struct {
+	Action Action
+	Until  time.Time // Digest and Drop: when the exhausted window ends
+}
+
+// Entry is a notification queued for a digest.
+type Entry struct {
+	ID       string
+	UserID   string
+	Channel  string
+	Kind     string
+	EventID  string
+	Payload  []byte // the event as JSON
+	FlushAt  time.Time
+	Attempts int
+}
+
+// Batch is the due entries of one user and channel, oldest first.
+type Batch struct {
+	UserID  string
+	Channel string
+	Entries []Entry
+}
+
+// Limiter counts notifications against the configured limits.
+type Limiter struct {
+	db     *sqldb.DB
+	lock   string                        // locks the window rows Take reads, where SQL can
+	limits atomic.Pointer[config.Limits] // swapped on config reload
+}
+
+// New creates the tables if needed.
+func New(ctx context.Context, db *sqldb.DB, cfg config.Limits) (*Limiter, error) {
+	for _, stmt := range schema {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return nil, fmt.Errorf("creating limit tables: %w", err)
+		}
+	}
+	l := &Limiter{db: db}
+	l.SetLimits(cfg)
+	if db.Driver == sqldb.Postgres {
+		// SQLite has a single writer and no row locks
+		l.lock = " FOR UPDATE"
+	}
+	return l, nil
+}
+
+// SetLimits replaces the limits for subsequent notifications. While
+// they are disabled every notification is allowed; counts in windows
+// already open are kept.
+func (l *Limiter) SetLimits(cfg config.Limits) {
+	l.limits.Store(&cfg)
+}
+
+// window is one limit applying to a notification.
+type window struct {
+	scope string
+	limit config.Limit
+}
+
+// Take counts a notification to userID on channel, if every limit that
+// applies has room for it; otherwise nothing is counted. The per-user
+// limit counts the user's notifications on all channels together;
+// notifications without a user ID are only subject to the channel limit.
+// The windows are locked until Take returns, so concurrent callers
+// cannot both take the last notification a window allows.
+func (l *Limiter) Take(ctx context.Context, userID, channel string, now time.Time) (d Decision, err error) {
+	cfg := l.limits.Load()
+	if !cfg.Enabled {
+		return Decision{Action: Allow}, nil
+	}
+	var windows []window
+	if userID != "" && cfg.PerUser.Max > 0 {
+		windows = append(windows, window{"user:" + userID, cfg.PerUser})
+	}
+	if lim := cfg.PerChannel[channel]; lim.Max > 0 {
+		windows = append(windows, window{"channel:" + channel, lim})
+	}
+	if len(windows) == 0 {
+		return Decision{Action: Allow}, nil
+	}
+
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Decision{}, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	sent := make([]int, len(windows))
+	for i, w := range windows {
+		// A row must exist to be locked; windows are always locked in the
+		// same order, user before channel
+		if _, err = tx.ExecContext(ctx, l.db.Rebind(`
+			INSERT INTO notification_windows (scope, window_start_ms, sent) VALUES (?, 0, 0)
+			ON CONFLICT (scope) DO NOTHING`), w.scope); err != nil {
+			return Decision{}, fmt.Errorf("creating window %s: %w", w.scope, err)
+		}
+		start := now.Truncate(w.limit.Window)
+		var startMs int64
+		if err = tx.QueryRowContext(ctx, l.db.Rebind(
+			`SELECT window_start_ms, sent FROM notification_windows WHERE scope = ?`+l.lock), w.scope).Scan(&startMs, &sent[i]); err != nil {
+			return Decision{}, fmt.Errorf("loading window %s: %w", w.scope, err)
+		}
+		if startMs != start.UnixMilli() {
+			sent[i] = 0
+		}
+		if sent[i] >= w.limit.Max {
+			if end := start.Add(w.limit.Window); end.After(d.Until) {
+				d.Until = end
+			}
+		}
+	}
+	if !d.Until.IsZero() {
+		tx.Rollback()
+		d.Action = Drop
+		if cfg.Digest && userID != "" {
+			d.Action = Digest
+		}
+		return d, nil
+	}
+	for i, w := range windows {
+		if _, err = tx.ExecContext(ctx, l.db.Rebind(
+			`UPDATE notification_windows SET window_start_ms = ?, sent = ? WHERE scope = ?`),
+			now.Truncate(w.limit.Window).UnixMilli(), sent[i]+1, w.scope); err != nil {
+			return Decision{}, fmt.Errorf("counting window %s: %w", w.scope, err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return Decision{}, err
+	}
+	return Decision{Action: Allow}, nil
+}
+
+// Queue adds e to its user's next digest on its channel.
+func (l *Limiter) Queue(ctx context.Context, e Entry) error {
+	// IDs sort by time, so entries queued within a millisecond keep their order
+	b := make([]byte, 4)
+	rand.Read(b)
+	id := fmt.Sprintf("dge_%016x%s", time.Now().UnixNano(), hex.EncodeToString(b))
+	_, err := l.db.ExecContext(ctx, l.db.Rebind(`
+		INSERT INTO notification_digest_entries (id, user_id, channel, kind, event_id, payload, flush_at_ms, attempts, created_at_ms)
+		VALUES (?, ?, ?, ?, ?, ?, ?, 0, ?)`),
+		id, e.UserID, e.Channel, e.Kind, e.EventID, string(e.Payload), e.FlushAt.UnixMilli(), time.Now().UnixMilli())
+	if err != nil {
+		return fmt.Errorf("queueing digest entry for %s: %w", e.UserID, err)
+	}
+	return nil
+}
+
+// Due returns the digests whose window has ended: every queued entry of
+// each user and channel with at least one entry due, up to limit
+// entries in all.
+func (l *Limiter) Due(ctx context.Context, now time.Time, limit int) ([]Batch, error) {
+	rows, err := l.db.QueryContext(ctx, l.db.Rebind(`
+		SELECT e.id, e.user_id, e.channel, e.kind, e.event_id, e.payload, e.flush_at_ms, e.attempts
+		FROM notification_digest_entries e
+		WHERE EXISTS (SELECT 1 FROM notification_digest_entries d
+			WHERE d.user_id = e.user_id AND d.channel = e.channel AND d.flush_at_ms <= ?)
+		ORDER BY e.user_id, e.channel, e.id LIMIT ?`), now.UnixMilli(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Batch
+	for rows.Next() {
+		var e Entry
+		var payload string
+		var at int64
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Channel, &e.Kind, &e.EventID, &payload, &at, &e.Attempts); err != nil {
+			return nil, err
+		}
+		e.Payload = []byte(payload)
+		e.FlushAt = time.UnixMilli(at)
+		if n := len(out); n == 0 || out[n-1].UserID != e.UserID || out[n-1].Channel != e.Channel {
+			out = append(out, Batch{UserID: e.UserID, Channel: e.Channel})
+		}
+		out[len(out)-1].Entries = append(out[len(out)-1].Entries, e)
+	}
+	return out, rows.Err()
+}
+
+// Done removes a digest's entries once sent or given up on.
+func (l *Limiter) Done(ctx context.Context, b Batch) error {
+	for _, e := range b.Entries {
+		if _, err := l.db.ExecContext(ctx, l.db.Rebind(`DELETE FROM notification_digest_entries WHERE id = ?`), e.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Retry counts a failed attempt at a digest and moves it to at.
+func (l *Limiter) Retry(ctx context.Context, b Batch, at time.Time) error {
+	for _, e := range b.Entries {
+		if _, err := l.db.ExecContext(ctx, l.db.Rebind(
+			`UPDATE notification_digest_entries SET attempts = attempts + 1, flush_at_ms = ? WHERE id = ?`), at.UnixMilli(), e.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Postpone moves a digest to at without counting an attempt.
+func (l *Limiter) Postpone(ctx context.Context, b Batch, at time.Time) error {
+	for _, e := range b.Entries {
+		if _, err := l.db.ExecContext(ctx, l.db.Rebind(
+			`UPDATE notification_digest_entries SET flush_at_ms = ? WHERE id = ?`), at.UnixMilli(), e.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,53 +2,276 @@ package main
 
 import (
 	"context"
-	"os"
-	"os/signal"
-	"syscall"
-	"time"
+	"net/http"
 
 	"e-commerce/common/config"
+	"e-commerce/common/health"
+	"e-commerce/common/kafkaclient"
+	"e-commerce/common/lifecycle"
 	"e-commerce/common/logger"
+	"e-commerce/common/metrics"
+	"e-commerce/common/models"
+	"e-commerce/common/sqldb"
+	"e-commerce/common/tracing"
 	"e-commerce/notification/consumer"
+	"e-commerce/notification/deliveries"
+	"e-commerce/notification/handler"
+	"e-commerce/notification/hookcapture"
+	"e-commerce/notification/limits"
+	"e-commerce/notification/preferences"
 	"e-commerce/notification/sink"
+	"e-commerce/notification/smtpcapture"
+	"e-commerce/notification/templates"
+	"e-commerce/notification/webhook"
 
 	"go.uber.org/zap"
 )
 
 func main() {
 	// 1. Load config + logger
-	cfg, err := config.Load()
-	if err != nil {
-		panic("failed to load config: " + err.Error())
-	}
-	log, err := logger.NewLogger(cfg.Env, cfg.LogLevel)
+	cfg := config.MustLoad()
+	log, level, err := logger.NewLeveled(cfg.Env, cfg.LogLevel)
 	if err != nil {
 		panic("failed to init logger: " + err.Error())
 	}
 	defer log.Sync()
 	log.Info("Starting Notification Service", zap.String("env", cfg.Env))
 
-	// 2. Choose sink (console by default)
-	baseSink := sink.NewConsoleSink(log)
-	// Wrap with retry and dedupe
-	notifSink := sink.NewRetryDedupeSink(baseSink, log)
+	// 1b. Tracing: spans flow HTTP → Kafka headers → consumers
+	shutdownTracing, err := tracing.Setup(context.Background(), "notification", cfg.Trace)
+	if err != nil {
+		log.Fatal("tracing init failed", zap.Error(err))
+	}
+
+	// 1c. Kafka connection settings (TLS/SASL) shared by every client
+	kconn, err := kafkaclient.New(cfg.Kafka)
+	if err != nil {
+		log.Fatal("kafka client config failed", zap.Error(err))
+	}
 
-	// 3. Initialize consumer
-	notifCons := consumer.NewNotificationConsumer(cfg.KafkaBrokers, "notification-group", notifSink, log)
-	defer notifCons.Close()
+	// 2. Templates, validated now so a broken one fails startup
+	pc := cfg.Notification.Preferences
+	tmpl, err := templates.Load(cfg.Notification.Templates.Dir, pc.DefaultLocale)
+	if err != nil {
+		log.Fatal("notification templates invalid", zap.Error(err))
+	}
+	log.Info("Notification templates loaded", zap.String("dir", cfg.Notification.Templates.Dir), zap.Int("sets", len(tmpl.List())))
 
-	// 4. Run consumer
-	ctx, cancel := context.WithCancel(context.Background())
-	go notifCons.Run(ctx)
+	// 2a. Channels: console always, email when configured
+	console, err := sink.NewConsoleSink(tmpl, log)
+	if err != nil {
+		log.Fatal("console sink init failed", zap.Error(err))
+	}
+	channels := map[string]sink.NotificationSink{"console": console}
+	var mailbox *smtpcapture.Server
+	if cfg.Notification.Sink == "email" {
+		emailCfg := cfg.Notification.Email
+		if emailCfg.Capture {
+			// Local dev: deliver to an in-process server, browsable at /mail
+			if mailbox, err = smtpcapture.Start("127.0.0.1:0", log); err != nil {
+				log.Fatal("smtp capture server failed", zap.Error(err))
+			}
+			emailCfg.SMTP.Addr, emailCfg.SMTP.TLS, emailCfg.SMTP.Username = mailbox.Addr(), "none", ""
+		}
+		email, err := sink.NewEmailSink(emailCfg, tmpl, log)
+		if err != nil {
+			log.Fatal("email sink init failed", zap.Error(err))
+		}
+		channels["email"] = email
+		log.Info("Sending notifications by email", zap.String("smtp", emailCfg.SMTP.Addr), zap.Bool("capture", emailCfg.Capture))
+	}
 
-	// 5. Wait for shutdown
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-	<-sigCh
-	log.Info("Shutdown signal received, exiting...")
+	// 2b. Log every attempt on every channel
+	dl := cfg.Notification.DeliveryLog.Database
+	deliveryDB, err := sqldb.Open(context.Background(), dl.Driver, dl.DSN)
+	if err != nil {
+		log.Fatal("delivery log database init failed", zap.Error(err))
+	}
+	deliveryLog, err := deliveries.New(context.Background(), deliveryDB)
+	if err != nil {
+		log.Fatal("delivery log init failed", zap.Error(err))
+	}
+	// 2c. Guard each channel: a circuit breaker fails fast while it is
+	// down, a bulkhead gives it its own queue and retrying workers
+	var (
+		breakers  []*sink.BreakerSink
+		bulkheads []*sink.BulkheadSink
+	)
+	for name, ch := range channels {
+		breaker := sink.NewBreakerSink(name, sink.NewLoggedSink(name, ch, deliveryLog, log), cfg.Notification.Breaker, log)
+		bulkhead := sink.NewBulkheadSink(name, breaker, cfg.Notification.Bulkhead, cfg.Notification.Delivery, log)
+		breakers, bulkheads = append(breakers, breaker), append(bulkheads, bulkhead)
+		channels[name] = bulkhead
+	}
 
-	// 6. Cancel and wait for in-flight work
-	cancel()
-	time.Sleep(5 * time.Second)
+	// 2d. Route each notification to the channels its user chose
+	prefsDB, err := sqldb.Open(context.Background(), pc.Database.Driver, pc.Database.DSN)
+	if err != nil {
+		log.Fatal("preferences database init failed", zap.Error(err))
+	}
+	prefs, err := preferences.New(context.Background(), prefsDB)
+	if err != nil {
+		log.Fatal("preferences store init failed", zap.Error(err))
+	}
+	defaults := preferences.Preferences{Channels: pc.DefaultChannels, Locale: pc.DefaultLocale, OptOuts: []string{}}
+	if len(defaults.Channels) == 0 {
+		defaults.Channels = []string{cfg.Notification.Sink}
+	}
+	router := sink.NewRoutingSink(prefs, channels, defaults, cfg.Notification.Delivery.MaxAttempts, pc.DeferredPoll, log)
+	for _, b := range bulkheads {
+		b.SetHold(router.Hold)
+	}
+	// Window counts and pending digests live with the preferences. The
+	// limiter is set up even while disabled, so a reload can enable it.
+	nl := cfg.Notification.Limits
+	if nl.Enabled && nl.Digest {
+		if err := tmpl.Require([]string{sink.DigestKind}, router.Channels()); err != nil {
+			log.Fatal("digest templates missing", zap.Error(err))
+		}
+	}
+	limiter, err := limits.New(context.Background(), prefsDB, nl)
+	if err != nil {
+		log.Fatal("rate limiter init failed", zap.Error(err))
+	}
+	router.SetLimiter(limiter)
+	if nl.Enabled {
+		log.Info("Notification rate limits enabled", zap.Int("perUser", nl.PerUser.Max),
+			zap.Duration("window", nl.PerUser.Window), zap.Bool("digest", nl.Digest))
+	}
+	var baseSink sink.NotificationSink = router
+
+	// 2e. Partner webhooks, delivered alongside the sink
+	var (
+		webhookDB   *sqldb.DB
+		webhooks    *webhook.Store
+		webhookSink *sink.WebhookSink
+	)
+	if wh := cfg.Notification.Webhooks; wh.Enabled {
+		if webhookDB, err = sqldb.Open(context.Background(), wh.Database.Driver, wh.Database.DSN); err != nil {
+			log.Fatal("webhook database init failed", zap.Error(err))
+		}
+		if webhooks, err = webhook.New(context.Background(), webhookDB); err != nil {
+			log.Fatal("webhook store init failed", zap.Error(err))
+		}
+		webhookSink = sink.NewWebhookSink(webhooks, wh, log)
+		baseSink = sink.FanoutSink{baseSink, webhookSink}
+	}
+	// 2f. Inventory failures to the ops chat, alongside the sink
+	var (
+		opsAlerts  *sink.OpsAlertSink
+		opsCapture *hookcapture.Server
+	)
+	if oa := cfg.Notification.OpsAlerts; oa.Enabled {
+		url := oa.WebhookURL
+		if oa.Capture {
+			// Local dev: post to an in-process receiver, browsable at /ops-alerts
+			if opsCapture, err = hookcapture.Start("127.0.0.1:0", log); err != nil {
+				log.Fatal("ops alert capture server failed", zap.Error(err))
+			}
+			url = opsCapture.URL()
+		}
+		opsAlerts = sink.NewOpsAlertSink(oa, url, log)
+		baseSink = sink.FanoutSink{baseSink, opsAlerts}
+		log.Info("Posting inventory failures to ops chat", zap.Duration("window", oa.Window), zap.Bool("capture", oa.Capture))
+	}
+	// Wrap with dedupe
+	notifSink := sink.NewDedupeSink(baseSink, log)
+	notifSink.SetEnabled(cfg.Features.Notifications)
+
+	// 2g. Apply log level, retry, limit and feature changes live
+	rt := config.NewRuntime(cfg, log)
+	logger.WatchLevel(rt, log, level)
+	config.OnChange(rt, func(c *config.Config) config.Retry { return c.Notification.Delivery }, func(r config.Retry) {
+		for _, b := range bulkheads {
+			b.SetRetry(r)
+		}
+	})
+	config.OnChange(rt, func(c *config.Config) config.Limits { return c.Notification.Limits }, func(nl config.Limits) {
+		if nl.Enabled && nl.Digest {
+			if err := tmpl.Require([]string{sink.DigestKind}, router.Channels()); err != nil {
+				log.Error("Digest templates missing, limited notifications are dropped", zap.Error(err))
+				nl.Digest = false
+			}
+		}
+		limiter.SetLimits(nl)
+	})
+	if webhookSink != nil {
+		config.OnChange(rt, func(c *config.Config) config.Retry { return c.Notification.Webhooks.Retry }, webhookSink.SetRetry)
+	}
+	config.OnChange(rt, func(c *config.Config) bool { return c.Features.Notifications }, notifSink.SetEnabled)
+	rt.Watch()
+
+	// 3. Initialize consumer, one group member for every topic with a
+	// handler, and the publisher auditing resends
+	clientID := config.ClientID(cfg.Notification.ClientID)
+	resends := deliveries.NewResendPublisher(kconn, cfg.Topics.NotificationsResent, clientID)
+	handlers := consumer.NewRegistry()
+	handlers.HandleType(cfg.Topics.InventoryEvents, models.TypeInventoryReserved, consumer.JSON(notifSink.NotifyReserved))
+	handlers.HandleType(cfg.Topics.InventoryEvents, models.TypeInventoryFailed, consumer.JSON(notifSink.NotifyFailed))
+	notifCons := consumer.NewNotificationConsumer(kconn, handlers, cfg.Notification.GroupID, clientID, log)
+
+	// 4. Health probes and metrics on the admin port
+	hc := health.NewHandler(log)
+	hc.AddLiveness("consumer", notifCons.Watchdog().Check(cfg.Notification.StuckAfter))
+	hc.AddReadiness("kafka", health.KafkaBrokers(kconn))
+	hc.AddReadiness("consumer-group", health.GroupMember(kconn, cfg.Notification.GroupID, clientID))
+	hc.AddReadiness("preferences-store", health.Ping(prefs))
+	hc.AddReadiness("delivery-log", health.Ping(deliveryLog))
+	if webhooks != nil {
+		hc.AddReadiness("webhook-store", health.Ping(webhooks))
+	}
+	for _, b := range breakers {
+		hc.AddInfo("circuit-"+b.Channel(), b.State)
+	}
+	mux := http.NewServeMux()
+	hc.Register(mux)
+	metrics.Register(mux)
+	if mailbox != nil {
+		mux.Handle("/mail", mailbox.Handler())
+	}
+	if opsCapture != nil {
+		mux.Handle("/ops-alerts", opsCapture.Handler())
+	}
+	handler.Templates(mux, tmpl, cfg.Notification.APIToken)
+	handler.Preferences(mux, prefs, router, cfg.Notification.APIToken, log)
+	handler.Notifications(mux, deliveryLog, router, resends, cfg.Notification.APIToken, log)
+	if webhooks != nil {
+		handler.Webhooks(mux, webhooks, cfg.Notification.APIToken, log)
+	}
+
+	// 5. Register components with the lifecycle manager
+	lc := lifecycle.New(log, cfg.ShutdownTimeout)
+	lc.Append(lifecycle.Hook{Name: "tracing", OnStop: shutdownTracing})
+	// Stores behind the admin API close after the admin server stops
+	lc.Closer("preferences-database", prefsDB.Close)
+	lc.Closer("delivery-log-database", deliveryDB.Close)
+	lc.Closer("resend-publisher", resends.Close)
+	if webhookDB != nil {
+		lc.Closer("webhook-database", webhookDB.Close)
+	}
+	lc.HTTPServer("admin", &http.Server{Addr: cfg.Notification.AdminAddr, Handler: mux})
+	if mailbox != nil {
+		lc.Closer("smtp-capture", mailbox.Close)
+	}
+	if opsCapture != nil {
+		lc.Closer("ops-alert-capture", opsCapture.Close)
+	}
+	for _, b := range bulkheads {
+		// Stop after everything that sends, holding what is still queued
+		lc.Go("channel-"+b.Channel(), b.Run)
+	}
+	lc.Go("deferred-notifications", router.RunDeferred)
+	if opsAlerts != nil {
+		// Stops after the consumer, posting what is still being counted
+		lc.Go("ops-alerts", opsAlerts.Run)
+	}
+	lc.Go("consumer", notifCons.Run, notifCons.Close)
+	lc.Append(lifecycle.Hook{Name: "readiness", OnStop: hc.Drain})
+
+	// 6. Run until shutdown; in-flight notifications finish before exit
+	if err := lc.Run(); err != nil {
+		log.Error("Shutdown completed with errors", zap.Error(err))
+		return
+	}
 	log.Info("Notification Service shut down cleanly")
 }
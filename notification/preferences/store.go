@@ -0,0 +1,253 @@
+// Package preferences stores how each user wants to be notified, and
+// the notifications held back until their quiet hours end.
+package preferences
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "time/tzdata" // quiet hours name IANA zones; do not depend on the image having them
+
+	"e-commerce/common/sqldb"
+)
+
+// ErrNotFound means the user has no stored preferences.
+var ErrNotFound = errors.New("no preferences stored")
+
+var schema = []string{`
+CREATE TABLE IF NOT EXISTS notification_preferences (
+	user_id       TEXT   PRIMARY KEY,
+	preferences   TEXT   NOT NULL,
+	updated_at_ms BIGINT NOT NULL
+)`, `
+CREATE TABLE IF NOT EXISTS deferred_notifications (
+	id            TEXT    PRIMARY KEY,
+	user_id       TEXT    NOT NULL,
+	channel       TEXT    NOT NULL,
+	kind          TEXT    NOT NULL,
+	payload       TEXT    NOT NULL,
+	deliver_at_ms BIGINT  NOT NULL,
+	attempts      INTEGER NOT NULL,
+	created_at_ms BIGINT  NOT NULL
+)`,
+	`CREATE INDEX IF NOT EXISTS deferred_notifications_due ON deferred_notifications (deliver_at_ms)`,
+}
+
+// Preferences are one user's notification settings.
+type Preferences struct {
+	UserID     string      `json:"user_id"`
+	Channels   []string    `json:"channels"`        // channels to notify on; empty means none
+	Email      string      `json:"email,omitempty"` // address for the email channel
+	Locale     string      `json:"locale"`          // e.g. "en", "de-CH"
+	QuietHours *QuietHours `json:"quiet_hours,omitempty"`
+	OptOuts    []string    `json:"opt_outs"` // notification kinds the user does not want
+	UpdatedAt  time.Time   `json:"updated_at,omitzero"`
+}
+
+// QuietHours is a daily window, in the user's time zone, during which
+// notifications are held and delivered when it ends. Start after End
+// spans midnight.
+type QuietHours struct {
+	Start    string `json:"start"`     // "22:00"
+	End      string `json:"end"`       // "07:00"
+	TimeZone string `json:"time_zone"` // IANA name, e.g. "Europe/Berlin"
+}
+
+// Validate checks the clock times and the zone.
+func (q QuietHours) Validate() error {
+	start, err := clock(q.Start)
+	if err != nil {
+		return fmt.Errorf("quiet_hours.start: %w", err)
+	}
+	end, err := clock(q.End)
+	if err != nil {
+		return fmt.Errorf("quiet_hours.end: %w", err)
+	}
+	if start == end {
+		return errors.New("quiet_hours: start and end must differ")
+	}
+	if _, err := time.LoadLocation(q.TimeZone); err != nil || q.TimeZone == "" {
+		return fmt.Errorf("quiet_hours.time_zone: unknown zone %q", q.TimeZone)
+	}
+	return nil
+}
+
+// clock parses "HH:MM" as minutes after midnight.
+func clock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("want HH:MM, got %q", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Until reports whether now falls in the quiet hours and, if so, when
+// they end. Invalid quiet hours are never quiet.
+func (q *QuietHours) Until(now time.Time) (time.Time, bool) {
+	if q == nil || q.Validate() != nil {
+		return time.Time{}, false
+	}
+	loc, _ := time.LoadLocation(q.TimeZone)
+	start, _ := clock(q.Start)
+	end, _ := clock(q.End)
+
+	local := now.In(loc)
+	mins := local.Hour()*60 + local.Minute()
+	var quiet bool
+	if start < end {
+		quiet = mins >= start && mins < end
+	} else {
+		quiet = mins >= start || mins < end
+	}
+	if !quiet {
+		return time.Time{}, false
+	}
+	y, m, d := local.Date()
+	until := time.Date(y, m, d, end/60, end%60, 0, 0, loc)
+	if !until.After(local) {
+		until = time.Date(y, m, d+1, end/60, end%60, 0, 0, loc)
+	}
+	return until, true
+}
+
+// Deferred is a notification held for one channel until DeliverAt.
+type Deferred struct {
+	ID        string
+	UserID    string
+	Channel   string
+	Kind      string
+	Payload   []byte // the event as JSON
+	DeliverAt time.Time
+	Attempts  int
+}
+
+// Store reads and writes preferences and held notifications.
+type Store struct {
+	db *sqldb.DB
+}
+
+// New creates the tables if needed.
+func New(ctx context.Context, db *sqldb.DB) (*Store, error) {
+	for _, stmt := range schema {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return nil, fmt.Errorf("creating preference tables: %w", err)
+		}
+	}
+	return &Store{db: db}, nil
+}
+
+// Ping is a readiness check.
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.Ping(ctx)
+}
+
+// Get returns a user's stored preferences, or ErrNotFound.
+func (s *Store) Get(ctx context.Context, userID string) (Preferences, error) {
+	var doc string
+	err := s.db.QueryRowContext(ctx, s.db.Rebind(
+		`SELECT preferences FROM notification_preferences WHERE user_id = ?`), userID).Scan(&doc)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Preferences{}, ErrNotFound
+	} else if err != nil {
+		return Preferences{}, err
+	}
+	var p Preferences
+	if err := json.Unmarshal([]byte(doc), &p); err != nil {
+		return Preferences{}, fmt.Errorf("decoding preferences of %s: %w", userID, err)
+	}
+	return p, nil
+}
+
+// Put replaces a user's preferences.
+func (s *Store) Put(ctx context.Context, p Preferences) (Preferences, error) {
+	p.UpdatedAt = time.Now().UTC().Truncate(time.Millisecond)
+	doc, err := json.Marshal(p)
+	if err != nil {
+		return Preferences{}, err
+	}
+	_, err = s.db.ExecContext(ctx, s.db.Rebind(`
+		INSERT INTO notification_preferences (user_id, preferences, updated_at_ms) VALUES (?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET preferences = excluded.preferences, updated_at_ms = excluded.updated_at_ms`),
+		p.UserID, string(doc), p.UpdatedAt.UnixMilli())
+	if err != nil {
+		return Preferences{}, fmt.Errorf("storing preferences of %s: %w", p.UserID, err)
+	}
+	return p, nil
+}
+
+// Delete removes a user's preferences, so the defaults apply again.
+func (s *Store) Delete(ctx context.Context, userID string) error {
+	res, err := s.db.ExecContext(ctx, s.db.Rebind(`DELETE FROM notification_preferences WHERE user_id = ?`), userID)
+	if err != nil {
+		return fmt.Errorf("deleting preferences of %s: %w", userID, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Defer holds a notification until d.DeliverAt.
+func (s *Store) Defer(ctx context.Context, d Deferred) error {
+	b := make([]byte, 8)
+	rand.Read(b)
+	_, err := s.db.ExecContext(ctx, s.db.Rebind(`
+		INSERT INTO deferred_notifications (id, user_id, channel, kind, payload, deliver_at_ms, attempts, created_at_ms)
+		VALUES (?, ?, ?, ?, ?, ?, 0, ?)`),
+		"dfn_"+hex.EncodeToString(b), d.UserID, d.Channel, d.Kind, string(d.Payload), d.DeliverAt.UnixMilli(), time.Now().UnixMilli())
+	if err != nil {
+		return fmt.Errorf("holding notification for %s: %w", d.UserID, err)
+	}
+	return nil
+}
+
+// Due returns up to limit held notifications whose time has come,
+// oldest first.
+func (s *Store) Due(ctx context.Context, now time.Time, limit int) ([]Deferred, error) {
+	rows, err := s.db.QueryContext(ctx, s.db.Rebind(`
+		SELECT id, user_id, channel, kind, payload, deliver_at_ms, attempts FROM deferred_notifications
+		WHERE deliver_at_ms <= ? ORDER BY deliver_at_ms, id LIMIT ?`), now.UnixMilli(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Deferred
+	for rows.Next() {
+		var d Deferred
+		var payload string
+		var at int64
+		if err := rows.Scan(&d.ID, &d.UserID, &d.Channel, &d.Kind, &payload, &at, &d.Attempts); err != nil {
+			return nil, err
+		}
+		d.Payload = []byte(payload)
+		d.DeliverAt = time.UnixMilli(at)
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// Done removes a held notification once delivered or given up on.
+func (s *Store) Done(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, s.db.Rebind(`DELETE FROM deferred_notifications WHERE id = ?`), id)
+	return err
+}
+
+// Retry counts a failed attempt and moves the notification to at.
+func (s *Store) Retry(ctx context.Context, id string, at time.Time) error {
+	_, err := s.db.ExecContext(ctx, s.db.Rebind(
+		`UPDATE deferred_notifications SET attempts = attempts + 1, deliver_at_ms = ? WHERE id = ?`), at.UnixMilli(), id)
+	return err
+}
+
+// Postpone moves a held notification to at without counting an attempt.
+func (s *Store) Postpone(ctx context.Context, id string, at time.Time) error {
+	_, err := s.db.ExecContext(ctx, s.db.Rebind(
+		`UPDATE deferred_notifications SET deliver_at_ms = ? WHERE id = ?`), at.UnixMilli(), id)
+	return err
+}
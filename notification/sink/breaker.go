@@ -0,0 +1,190 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"e-commerce/common/config"
+	"e-commerce/common/metrics"
+	"e-commerce/common/models"
+
+	"go.uber.org/zap"
+)
+
+// UnavailableError is returned, without trying, by a channel that
+// refuses a send: its circuit is open, its bulkhead full or stopping.
+// The notification should be held and tried again from RetryAt.
+type UnavailableError struct {
+	Channel string
+	Reason  string // "circuit_open", "bulkhead_full" or "stopping"
+	RetryAt time.Time
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("channel %s unavailable: %s", e.Channel, e.Reason)
+}
+
+type circuit int
+
+const (
+	closed circuit = iota
+	halfOpen
+	open
+)
+
+func (c circuit) String() string {
+	return [...]string{"closed", "half-open", "open"}[c]
+}
+
+// BreakerSink is a circuit breaker around one channel, so a channel that
+// is down fails fast instead of tying up every sender until it times
+// out. See config.Breaker for the states.
+type BreakerSink struct {
+	channel string
+	inner   NotificationSink
+	cfg     config.Breaker
+	logger  *zap.Logger
+
+	mu        sync.Mutex
+	state     circuit
+	gen       int       // bumped on every transition
+	failures  int       // consecutive, while closed
+	successes int       // consecutive probe successes, while half-open
+	probing   bool      // a half-open probe is in flight
+	openUntil time.Time // while open
+}
+
+// pass is a send let through by allow: the state it was admitted in, by
+// generation, and whether it is a half-open probe.
+type pass struct {
+	gen   int
+	probe bool
+}
+
+func NewBreakerSink(channel string, inner NotificationSink, cfg config.Breaker, log *zap.Logger) *BreakerSink {
+	metrics.ChannelCircuitState.WithLabelValues(channel).Set(float64(closed))
+	return &BreakerSink{channel: channel, inner: inner, cfg: cfg, logger: log.With(zap.String("channel", channel))}
+}
+
+func (b *BreakerSink) NotifyReserved(ctx context.Context, evt models.InventoryReserved) error {
+	return b.call(ctx, func(ctx context.Context) error { return b.inner.NotifyReserved(ctx, evt) })
+}
+
+func (b *BreakerSink) NotifyFailed(ctx context.Context, evt models.InventoryFailed) error {
+	return b.call(ctx, func(ctx context.Context) error { return b.inner.NotifyFailed(ctx, evt) })
+}
+
+func (b *BreakerSink) NotifyDigest(ctx context.Context, d Digest) error {
+	ds, ok := b.inner.(DigestSink)
+	if !ok {
+		return fmt.Errorf("channel %s cannot send digests", b.channel)
+	}
+	return b.call(ctx, func(ctx context.Context) error { return ds.NotifyDigest(ctx, d) })
+}
+
+// Channel is the name of the guarded channel.
+func (b *BreakerSink) Channel() string {
+	return b.channel
+}
+
+// State describes the circuit for the health endpoints.
+func (b *BreakerSink) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == open {
+		return "open until " + b.openUntil.UTC().Format(time.RFC3339)
+	}
+	return b.state.String()
+}
+
+func (b *BreakerSink) call(ctx context.Context, send func(context.Context) error) error {
+	p, err := b.allow(time.Now())
+	if err != nil {
+		metrics.ChannelRejections.WithLabelValues(b.channel, "circuit_open").Inc()
+		return err
+	}
+	err = send(ctx)
+	if ctx.Err() != nil {
+		// Cancelled by shutdown: says nothing about the channel
+		b.mu.Lock()
+		b.release(p)
+		b.mu.Unlock()
+		return err
+	}
+	b.done(time.Now(), p, err)
+	return err
+}
+
+// allow reports whether a send may go ahead and, if so, the pass to
+// hand back to done.
+func (b *BreakerSink) allow(now time.Time) (pass, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case closed:
+		return pass{gen: b.gen}, nil
+	case open:
+		if now.Before(b.openUntil) {
+			return pass{}, &UnavailableError{Channel: b.channel, Reason: "circuit_open", RetryAt: b.openUntil}
+		}
+		b.transition(halfOpen, now)
+	}
+	if b.probing {
+		return pass{}, &UnavailableError{Channel: b.channel, Reason: "circuit_open", RetryAt: now}
+	}
+	b.probing = true
+	return pass{gen: b.gen, probe: true}, nil
+}
+
+// release frees the probe slot held by p, if p is the current probe;
+// b.mu must be held.
+func (b *BreakerSink) release(p pass) {
+	if p.probe && p.gen == b.gen {
+		b.probing = false
+	}
+}
+
+// done records the outcome of a send let through by p, finished at now.
+// A send admitted before the last transition, such as a slow one that
+// was in flight when the circuit opened, says nothing about the current
+// state and is not counted.
+func (b *BreakerSink) done(now time.Time, p pass, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if p.gen != b.gen {
+		return
+	}
+	b.release(p)
+	switch {
+	case err == nil && b.state == halfOpen:
+		if b.successes++; b.successes >= b.cfg.Probes {
+			b.transition(closed, now)
+		}
+	case err == nil:
+		b.failures = 0
+	case b.state == halfOpen:
+		b.transition(open, now)
+	case b.state == closed:
+		if b.failures++; b.failures >= b.cfg.Failures {
+			b.transition(open, now)
+		}
+	}
+}
+
+// transition moves the circuit to s at now; b.mu must be held.
+func (b *BreakerSink) transition(s circuit, now time.Time) {
+	b.state, b.failures, b.successes, b.probing = s, 0, 0, false
+	b.gen++
+	metrics.ChannelCircuitState.WithLabelValues(b.channel).Set(float64(s))
+	switch s {
+	case open:
+		b.openUntil = now.Add(b.cfg.OpenFor)
+		b.logger.Warn("Channel circuit opened", zap.Time("until", b.openUntil))
+	case halfOpen:
+		b.logger.Info("Channel circuit half-open, probing")
+	case closed:
+		b.logger.Info("Channel circuit closed")
+	}
+}
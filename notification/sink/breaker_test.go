@@ -0,0 +1,152 @@
+package sink
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"e-commerce/common/config"
+
+	"go.uber.org/zap"
+)
+
+// breakerStep is one call on the breaker, at is time since the start.
+type breakerStep struct {
+	at   time.Duration
+	call string // "allow", "ok" (a send succeeded) or "fail"
+	// pass names the send: allow keeps its pass under this name, ok and
+	// fail finish the send allowed under it. Without one, ok and fail
+	// finish a send allowed at the same moment.
+	pass string
+
+	probe   bool // allow: want a probe
+	refused bool // allow: want an UnavailableError
+	state   circuit
+}
+
+func TestBreakerStateMachine(t *testing.T) {
+	cfg := config.Breaker{Failures: 3, OpenFor: 10 * time.Second, Probes: 2}
+	// opened trips a closed breaker at 1s: open until 11s
+	opened := []breakerStep{
+		{at: 0, call: "fail", state: closed},
+		{at: 0, call: "fail", state: closed},
+		{at: time.Second, call: "fail", state: open},
+	}
+	tests := []struct {
+		name  string
+		steps []breakerStep
+	}{{
+		name: "a success resets the failure count",
+		steps: []breakerStep{
+			{call: "fail", state: closed},
+			{call: "fail", state: closed},
+			{call: "ok", state: closed},
+			{call: "fail", state: closed},
+			{call: "fail", state: closed},
+			{call: "allow", state: closed},
+		},
+	}, {
+		name: "open refuses until open_for has passed",
+		steps: append(opened[:3:3],
+			breakerStep{at: 5 * time.Second, call: "allow", refused: true, state: open},
+			breakerStep{at: 11*time.Second - 1, call: "allow", refused: true, state: open},
+			breakerStep{at: 11 * time.Second, call: "allow", probe: true, state: halfOpen},
+		),
+	}, {
+		name: "half-open lets one probe through at a time",
+		steps: append(opened[:3:3],
+			breakerStep{at: 11 * time.Second, call: "allow", pass: "p1", probe: true, state: halfOpen},
+			breakerStep{at: 11 * time.Second, call: "allow", refused: true, state: halfOpen},
+			breakerStep{at: 12 * time.Second, call: "ok", pass: "p1", state: halfOpen},
+			breakerStep{at: 12 * time.Second, call: "allow", probe: true, state: halfOpen},
+		),
+	}, {
+		name: "probes successes in a row close it",
+		steps: append(opened[:3:3],
+			breakerStep{at: 11 * time.Second, call: "allow", pass: "p1", probe: true, state: halfOpen},
+			breakerStep{at: 11 * time.Second, call: "ok", pass: "p1", state: halfOpen},
+			breakerStep{at: 12 * time.Second, call: "allow", pass: "p2", probe: true, state: halfOpen},
+			breakerStep{at: 12 * time.Second, call: "ok", pass: "p2", state: closed},
+			breakerStep{at: 12 * time.Second, call: "allow", state: closed},
+			breakerStep{at: 12 * time.Second, call: "allow", state: closed},
+		),
+	}, {
+		name: "a failed probe reopens it",
+		steps: append(opened[:3:3],
+			breakerStep{at: 11 * time.Second, call: "allow", pass: "p1", probe: true, state: halfOpen},
+			breakerStep{at: 11 * time.Second, call: "ok", pass: "p1", state: halfOpen},
+			breakerStep{at: 12 * time.Second, call: "allow", pass: "p2", probe: true, state: halfOpen},
+			breakerStep{at: 13 * time.Second, call: "fail", pass: "p2", state: open},
+			breakerStep{at: 22 * time.Second, call: "allow", refused: true, state: open},
+			breakerStep{at: 23 * time.Second, call: "allow", probe: true, state: halfOpen},
+		),
+	}, {
+		name: "a send allowed while closed is not counted once it opened",
+		steps: []breakerStep{
+			{at: 0, call: "allow", pass: "slow", state: closed},
+			{at: 0, call: "fail", state: closed},
+			{at: 0, call: "fail", state: closed},
+			{at: time.Second, call: "fail", state: open},
+			{at: 11 * time.Second, call: "allow", pass: "p1", probe: true, state: halfOpen},
+			{at: 11 * time.Second, call: "fail", pass: "slow", state: halfOpen},
+			{at: 11 * time.Second, call: "allow", refused: true, state: halfOpen},
+			{at: 12 * time.Second, call: "ok", pass: "p1", state: halfOpen},
+			{at: 12 * time.Second, call: "allow", probe: true, state: halfOpen},
+		},
+	}, {
+		name: "a send allowed before it opened is not counted once it closed again",
+		steps: []breakerStep{
+			{at: 0, call: "allow", pass: "slow", state: closed},
+			{at: 0, call: "fail", state: closed},
+			{at: 0, call: "fail", state: closed},
+			{at: time.Second, call: "fail", state: open},
+			{at: 11 * time.Second, call: "allow", pass: "p1", probe: true, state: halfOpen},
+			{at: 11 * time.Second, call: "ok", pass: "p1", state: halfOpen},
+			{at: 11 * time.Second, call: "allow", pass: "p2", probe: true, state: halfOpen},
+			{at: 11 * time.Second, call: "ok", pass: "p2", state: closed},
+			{at: 12 * time.Second, call: "fail", state: closed},
+			{at: 12 * time.Second, call: "fail", state: closed},
+			{at: 12 * time.Second, call: "fail", pass: "slow", state: closed},
+			{at: 12 * time.Second, call: "allow", state: closed},
+		},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBreakerSink("test", nil, cfg, zap.NewNop())
+			start := time.Now()
+			passes := map[string]pass{}
+			for i, st := range tt.steps {
+				now := start.Add(st.at)
+				if st.call != "allow" && st.pass == "" {
+					p, err := b.allow(now)
+					if err != nil {
+						t.Fatalf("step %d: allow before %s: %v", i, st.call, err)
+					}
+					passes[""] = p
+				}
+				switch st.call {
+				case "allow":
+					p, err := b.allow(now)
+					var unavailable *UnavailableError
+					if refused := errors.As(err, &unavailable); refused != st.refused {
+						t.Fatalf("step %d: allow refused = %v (%v), want %v", i, refused, err, st.refused)
+					}
+					if p.probe != st.probe {
+						t.Fatalf("step %d: allow probe = %v, want %v", i, p.probe, st.probe)
+					}
+					if st.refused && unavailable.RetryAt.Before(now) {
+						t.Errorf("step %d: RetryAt %v is in the past", i, unavailable.RetryAt.Sub(start))
+					}
+					passes[st.pass] = p
+				case "ok":
+					b.done(now, passes[st.pass], nil)
+				case "fail":
+					b.done(now, passes[st.pass], errors.New("send failed"))
+				}
+				if b.state != st.state {
+					t.Fatalf("step %d (%s at %v): state = %v, want %v", i, st.call, st.at, b.state, st.state)
+				}
+			}
+		})
+	}
+}
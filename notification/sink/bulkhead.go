@@ -0,0 +1,255 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"e-commerce/common/config"
+	"e-commerce/common/logger"
+	"e-commerce/common/metrics"
+	"e-commerce/common/models"
+
+	"go.uber.org/zap"
+)
+
+// BulkheadSink gives one channel its own bounded queue and workers, so
+// a slow or failing channel holds up only its own notifications. See
+// config.Bulkhead.
+//
+// Routing hands notifications over with Enqueue and moves on. The
+// workers send them, retrying failures with backoff, and hold (see
+// SetHold) those the channel refuses or that waited too long. The
+// Notify methods instead wait for one attempt and return its error, for
+// callers that need the outcome: held notifications, digests, resends.
+type BulkheadSink struct {
+	channel string
+	inner   NotificationSink
+	workers int
+	maxWait time.Duration
+	queue   chan *job
+	retry   atomic.Pointer[config.Retry] // swapped on config reload
+	hold    HoldFunc
+	logger  *zap.Logger
+
+	mu      sync.RWMutex
+	stopped bool // Run has returned; nothing more is queued
+}
+
+// HoldFunc keeps a notification a channel could not send, to be tried
+// again from at.
+type HoldFunc func(ctx context.Context, channel string, evt any, at time.Time) error
+
+// job is one queued notification.
+type job struct {
+	ctx    context.Context
+	evt    any // models.InventoryReserved, models.InventoryFailed or Digest
+	queued time.Time
+	result chan error // nil if enqueued: the worker retries and holds it
+}
+
+func NewBulkheadSink(channel string, inner NotificationSink, cfg config.Bulkhead, retry config.Retry, log *zap.Logger) *BulkheadSink {
+	b := &BulkheadSink{
+		channel: channel,
+		inner:   inner,
+		workers: cfg.MaxConcurrent,
+		maxWait: cfg.MaxWait,
+		queue:   make(chan *job, cfg.Queue),
+		logger:  log.With(zap.String("channel", channel)),
+	}
+	b.SetRetry(retry)
+	return b
+}
+
+// SetHold sets where notifications the workers cannot send go. Call it
+// before Run.
+func (b *BulkheadSink) SetHold(h HoldFunc) {
+	b.hold = h
+}
+
+// SetRetry replaces the retry policy for subsequent notifications.
+func (b *BulkheadSink) SetRetry(r config.Retry) {
+	b.retry.Store(&r)
+}
+
+// Channel is the name of the channel.
+func (b *BulkheadSink) Channel() string {
+	return b.channel
+}
+
+func (b *BulkheadSink) NotifyReserved(ctx context.Context, evt models.InventoryReserved) error {
+	return b.wait(ctx, evt)
+}
+
+func (b *BulkheadSink) NotifyFailed(ctx context.Context, evt models.InventoryFailed) error {
+	return b.wait(ctx, evt)
+}
+
+func (b *BulkheadSink) NotifyDigest(ctx context.Context, d Digest) error {
+	if _, ok := b.inner.(DigestSink); !ok {
+		return fmt.Errorf("channel %s cannot send digests", b.channel)
+	}
+	return b.wait(ctx, d)
+}
+
+// Enqueue queues evt for the workers and returns. An UnavailableError
+// means nothing was queued.
+func (b *BulkheadSink) Enqueue(ctx context.Context, evt any) error {
+	// The caller moves on; the send must outlive its context
+	return b.push(&job{ctx: context.WithoutCancel(ctx), evt: evt, queued: time.Now()})
+}
+
+// wait queues evt and waits for a worker's single attempt at it.
+func (b *BulkheadSink) wait(ctx context.Context, evt any) error {
+	j := &job{ctx: ctx, evt: evt, queued: time.Now(), result: make(chan error, 1)}
+	if err := b.push(j); err != nil {
+		return err
+	}
+	select {
+	case err := <-j.result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *BulkheadSink) push(j *job) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.stopped {
+		return b.refuse("stopping")
+	}
+	select {
+	case b.queue <- j:
+		return nil
+	default:
+		return b.refuse("bulkhead_full")
+	}
+}
+
+func (b *BulkheadSink) refuse(reason string) error {
+	metrics.ChannelRejections.WithLabelValues(b.channel, reason).Inc()
+	return &UnavailableError{Channel: b.channel, Reason: reason, RetryAt: time.Now()}
+}
+
+// Run works the queue until ctx is cancelled. Sends in progress finish;
+// notifications still queued are held, so none is lost with the process.
+func (b *BulkheadSink) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for range b.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case j := <-b.queue:
+					b.process(ctx, j)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	b.mu.Lock()
+	b.stopped = true
+	b.mu.Unlock()
+	for {
+		select {
+		case j := <-b.queue:
+			if j.result != nil {
+				j.result <- b.refuse("stopping")
+			} else {
+				b.holdJob(j, time.Now())
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+func (b *BulkheadSink) process(stop context.Context, j *job) {
+	waited := time.Since(j.queued) > b.maxWait
+	switch {
+	case j.result == nil && waited:
+		b.refuse("bulkhead_full")
+		b.holdJob(j, time.Now())
+	case j.result == nil:
+		b.deliver(stop, j)
+	case j.ctx.Err() != nil:
+		// The caller has stopped waiting
+		j.result <- j.ctx.Err()
+	case waited:
+		j.result <- b.refuse("bulkhead_full")
+	default:
+		j.result <- b.send(j.ctx, j.evt)
+	}
+}
+
+// deliver sends an enqueued notification, retrying failures with
+// backoff. One the channel refuses, or still failing when the workers
+// stop, is held.
+func (b *BulkheadSink) deliver(stop context.Context, j *job) {
+	kind, _, orderID := describe(j.evt)
+	log := logger.WithContext(j.ctx, b.logger).With(zap.String("kind", kind), zap.String("orderID", orderID))
+	retry := b.retry.Load()
+	backoff := retry.Backoff
+	for attempt := 1; ; attempt++ {
+		err := b.send(j.ctx, j.evt)
+		var unavailable *UnavailableError
+		switch {
+		case err == nil:
+			metrics.NotificationsRouted.WithLabelValues(b.channel, "sent").Inc()
+			log.Info("Notification delivered", zap.Int("attempt", attempt))
+			return
+		case errors.As(err, &unavailable):
+			b.holdJob(j, unavailable.RetryAt)
+			return
+		case attempt >= retry.MaxAttempts:
+			metrics.NotificationsRouted.WithLabelValues(b.channel, "failed").Inc()
+			log.Error("Notification failed after retries", zap.Int("attempts", attempt), zap.Error(err))
+			return
+		}
+		log.Warn("Notification failed, retrying", zap.Int("attempt", attempt), zap.Duration("in", backoff), zap.Error(err))
+		select {
+		case <-time.After(backoff):
+		case <-stop.Done():
+			b.holdJob(j, time.Now())
+			return
+		}
+		backoff *= 2
+	}
+}
+
+// holdJob hands an enqueued notification to the hold function.
+func (b *BulkheadSink) holdJob(j *job, at time.Time) {
+	metrics.NotificationsRouted.WithLabelValues(b.channel, "unavailable").Inc()
+	err := errors.New("no hold function set")
+	if b.hold != nil {
+		err = b.hold(j.ctx, b.channel, j.evt, at)
+	}
+	if err != nil {
+		kind, _, orderID := describe(j.evt)
+		logger.WithContext(j.ctx, b.logger).Error("Holding notification failed, dropped",
+			zap.String("kind", kind), zap.String("orderID", orderID), zap.Error(err))
+	}
+}
+
+func (b *BulkheadSink) send(ctx context.Context, evt any) error {
+	inFlight := metrics.ChannelInFlight.WithLabelValues(b.channel)
+	inFlight.Inc()
+	defer inFlight.Dec()
+	switch e := evt.(type) {
+	case models.InventoryReserved:
+		return b.inner.NotifyReserved(ctx, e)
+	case models.InventoryFailed:
+		return b.inner.NotifyFailed(ctx, e)
+	case Digest:
+		return b.inner.(DigestSink).NotifyDigest(ctx, e)
+	}
+	return fmt.Errorf("cannot send %T", evt)
+}
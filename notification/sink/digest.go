@@ -0,0 +1,74 @@
+package sink
+
+import (
+	"context"
+	"strings"
+
+	"e-commerce/common/models"
+	"e-commerce/notification/templates"
+)
+
+// DigestKind names the templates of digests, which collapse the
+// notifications held back by the rate limits into one message.
+const DigestKind = "digest"
+
+// Digest is several notifications to one user, sent as one message.
+type Digest struct {
+	UserID  string
+	Entries []DigestEntry // oldest first
+}
+
+// DigestEntry is one notification in a digest.
+type DigestEntry struct {
+	Kind    string
+	EventID string
+	Event   any // models.InventoryReserved or models.InventoryFailed
+}
+
+// DigestSink is a channel that can send digests.
+type DigestSink interface {
+	NotifyDigest(context.Context, Digest) error
+}
+
+// digestData is what digest templates see: each entry as it would be
+// rendered on its own, tagged with its kind.
+func digestData(d Digest) templates.Data {
+	data := templates.Data{UserID: d.UserID}
+	for _, e := range d.Entries {
+		var item templates.Data
+		switch evt := e.Event.(type) {
+		case models.InventoryReserved:
+			item = reservedData(evt)
+		case models.InventoryFailed:
+			item = failedData(evt)
+		}
+		item.Kind = e.Kind
+		data.Digest = append(data.Digest, item)
+	}
+	return data
+}
+
+// orderIDs names the orders a message is about: one, or those of a
+// digest joined by commas.
+func orderIDs(data templates.Data) string {
+	if data.Digest == nil {
+		return data.OrderID
+	}
+	ids := make([]string, len(data.Digest))
+	for i, d := range data.Digest {
+		ids[i] = d.OrderID
+	}
+	return strings.Join(ids, ",")
+}
+
+// describe returns the notification kind, event type and order ID of
+// an event.
+func describe(evt any) (kind, typ, orderID string) {
+	switch e := evt.(type) {
+	case models.InventoryReserved:
+		return OrderConfirmed, models.TypeInventoryReserved, e.OrderID
+	case models.InventoryFailed:
+		return OutOfStock, models.TypeInventoryFailed, e.OrderID
+	}
+	return "", "", ""
+}
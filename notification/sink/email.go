@@ -0,0 +1,235 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"e-commerce/common/config"
+	"e-commerce/common/logger"
+	"e-commerce/common/models"
+	"e-commerce/notification/templates"
+
+	"go.uber.org/zap"
+)
+
+// Notification kinds. They name the templates and are what users opt
+// out of.
+const (
+	OrderConfirmed = "order_confirmed"
+	OutOfStock     = "out_of_stock"
+)
+
+// EmailSink sends each notification as a multipart text/HTML email
+// through an SMTP relay, to the Recipient in the context or, without
+// one, to the configured recipients.
+type EmailSink struct {
+	from      *mail.Address
+	to        []string
+	smtp      config.SMTP
+	templates *templates.Registry
+	logger    *zap.Logger
+}
+
+// NewEmailSink checks the addresses and that reg has email templates
+// for every kind; it does not connect to the relay until the first
+// notification.
+func NewEmailSink(cfg config.Email, reg *templates.Registry, log *zap.Logger) (*EmailSink, error) {
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("email from address: %w", err)
+	}
+	to := make([]string, len(cfg.To))
+	for i, a := range cfg.To {
+		addr, err := mail.ParseAddress(a)
+		if err != nil {
+			return nil, fmt.Errorf("email to address %q: %w", a, err)
+		}
+		to[i] = addr.Address
+	}
+	if err := reg.Require([]string{OrderConfirmed, OutOfStock}, []string{"email"}); err != nil {
+		return nil, err
+	}
+	return &EmailSink{from: from, to: to, smtp: cfg.SMTP, templates: reg, logger: log}, nil
+}
+
+func (s *EmailSink) NotifyReserved(ctx context.Context, evt models.InventoryReserved) error {
+	return s.send(ctx, OrderConfirmed, reservedData(evt))
+}
+
+func (s *EmailSink) NotifyFailed(ctx context.Context, evt models.InventoryFailed) error {
+	return s.send(ctx, OutOfStock, failedData(evt))
+}
+
+// NotifyDigest sends one email listing every notification in d.
+func (s *EmailSink) NotifyDigest(ctx context.Context, d Digest) error {
+	return s.send(ctx, DigestKind, digestData(d))
+}
+
+func (s *EmailSink) send(ctx context.Context, kind string, data templates.Data) error {
+	to, locale := s.to, s.templates.DefaultLocale()
+	if r, ok := RecipientFrom(ctx); ok {
+		if r.Email != "" {
+			to = []string{r.Email}
+		}
+		if r.Locale != "" {
+			locale = r.Locale
+		}
+	}
+	m, err := s.templates.Render(kind, "email", locale, data)
+	if err != nil {
+		return err
+	}
+	noteRendered(ctx, m.Subject, m.Text, m.HTML)
+	orderID := orderIDs(data)
+	msg, err := s.render(m, orderID, to)
+	if err != nil {
+		return err
+	}
+	if err := s.deliver(ctx, msg, to); err != nil {
+		return fmt.Errorf("sending %s email for %s: %w", kind, orderID, err)
+	}
+	logger.WithContext(ctx, s.logger).Debug("Email sent", zap.String("kind", kind), zap.String("orderID", orderID),
+		zap.String("locale", m.Locale), zap.Int("templateVersion", m.Version), zap.Strings("to", to))
+	return nil
+}
+
+// render builds the RFC 5322 message: headers, then a
+// multipart/alternative body with the text part first so clients that
+// understand HTML prefer it.
+func (s *EmailSink) render(m templates.Message, orderID string, to []string) ([]byte, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     []byte
+	}{
+		{"text/plain; charset=utf-8", []byte(m.Text)},
+		{"text/html; charset=utf-8", []byte(m.HTML)},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write(part.content); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	header := func(k, v string) { fmt.Fprintf(&msg, "%s: %s\r\n", k, v) }
+	header("From", s.from.String())
+	header("To", strings.Join(to, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", messageID(s.from.Address))
+	header("Content-Language", m.Locale)
+	header("X-Notification-Kind", m.Kind)
+	header("X-Template-Version", fmt.Sprint(m.Version))
+	header("X-Order-ID", orderID)
+	header("MIME-Version", "1.0")
+	header("Content-Type", "multipart/alternative; boundary="+mw.Boundary())
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+func messageID(from string) string {
+	domain := "localhost"
+	if i := strings.LastIndexByte(from, '@'); i >= 0 {
+		domain = from[i+1:]
+	}
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">"
+}
+
+// deliver runs one SMTP transaction. With tls "tls" the connection is
+// TLS from the start; with "starttls" it is upgraded before anything
+// else is sent, and a relay that cannot upgrade is an error rather
+// than a silent fallback to plain text.
+func (s *EmailSink) deliver(ctx context.Context, msg []byte, to []string) error {
+	host, _, err := net.SplitHostPort(s.smtp.Addr)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.smtp.Timeout)
+	defer cancel()
+
+	var conn net.Conn
+	if s.smtp.TLS == "tls" {
+		d := tls.Dialer{Config: &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}}
+		conn, err = d.DialContext(ctx, "tcp", s.smtp.Addr)
+	} else {
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, "tcp", s.smtp.Addr)
+	}
+	if err != nil {
+		return err
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if s.smtp.TLS == "starttls" {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("relay does not offer STARTTLS")
+		}
+		if err := c.StartTLS(&tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}); err != nil {
+			return err
+		}
+	}
+	if s.smtp.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.smtp.Username, s.smtp.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(s.from.Address); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
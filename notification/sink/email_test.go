@@ -0,0 +1,117 @@
+package sink
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"e-commerce/common/config"
+	"e-commerce/common/models"
+	"e-commerce/notification/smtpcapture"
+	"e-commerce/notification/templates"
+
+	"go.uber.org/zap"
+)
+
+func newCapturedEmailSink(t *testing.T) (*EmailSink, *smtpcapture.Server) {
+	t.Helper()
+	mailbox, err := smtpcapture.Start("127.0.0.1:0", zap.NewNop())
+	if err != nil {
+		t.Fatalf("starting capture server: %v", err)
+	}
+	t.Cleanup(func() { mailbox.Close() })
+	reg, err := templates.Load("../../config/templates", "en")
+	if err != nil {
+		t.Fatalf("loading templates: %v", err)
+	}
+	s, err := NewEmailSink(config.Email{
+		From: "Shop <shop@example.com>",
+		To:   []string{"ops@example.com"},
+		SMTP: config.SMTP{Addr: mailbox.Addr(), TLS: "none", Timeout: 5 * time.Second},
+	}, reg, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewEmailSink: %v", err)
+	}
+	return s, mailbox
+}
+
+func TestEmailSinkDeliversBothKinds(t *testing.T) {
+	s, mailbox := newCapturedEmailSink(t)
+	tests := []struct {
+		name    string
+		rcpt    *Recipient
+		send    func(context.Context) error
+		kind    string
+		to      []string
+		subject string
+		textHas []string
+		htmlHas []string
+	}{{
+		name: "reserved to the user",
+		rcpt: &Recipient{UserID: "u1", Email: "ada@example.com", Locale: "en"},
+		send: func(ctx context.Context) error {
+			return s.NotifyReserved(ctx, models.InventoryReserved{OrderID: "o-1", UserID: "u1", Items: []string{"apple", "pear"}, Total: 12.5})
+		},
+		kind:    OrderConfirmed,
+		to:      []string{"ada@example.com"},
+		subject: "Your order o-1 is confirmed",
+		textHas: []string{"order o-1 is in stock", "- apple", "- pear"},
+		htmlHas: []string{"<strong>o-1</strong>", "<li>apple</li>", "<li>pear</li>"},
+	}, {
+		name: "failed to the configured recipients",
+		send: func(ctx context.Context) error {
+			return s.NotifyFailed(ctx, models.InventoryFailed{OrderID: "o-2", Items: []string{"plum"}, Reason: `item "plum" out of stock`})
+		},
+		kind:    OutOfStock,
+		to:      []string{"ops@example.com"},
+		subject: "We could not fulfil your order o-2",
+		textHas: []string{"your order o-2", "- plum", `Reason: item "plum" out of stock`},
+		htmlHas: []string{"<strong>o-2</strong>", "<li>plum</li>", "Reason: item &#34;plum&#34; out of stock"},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mailbox.Reset()
+			ctx := context.Background()
+			if tt.rcpt != nil {
+				ctx = WithRecipient(ctx, *tt.rcpt)
+			}
+			if err := tt.send(ctx); err != nil {
+				t.Fatalf("send: %v", err)
+			}
+			wctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			defer cancel()
+			msgs, err := mailbox.Wait(wctx, 1)
+			if err != nil {
+				t.Fatalf("waiting for mail: %v", err)
+			}
+			m := msgs[0]
+			if m.From != "shop@example.com" {
+				t.Errorf("envelope from = %q, want shop@example.com", m.From)
+			}
+			if !slices.Equal(m.To, tt.to) {
+				t.Errorf("envelope to = %v, want %v", m.To, tt.to)
+			}
+			if got := m.Header.Get("To"); got != strings.Join(tt.to, ", ") {
+				t.Errorf("To header = %q, want %q", got, strings.Join(tt.to, ", "))
+			}
+			if m.Subject != tt.subject {
+				t.Errorf("subject = %q, want %q", m.Subject, tt.subject)
+			}
+			if got := m.Header.Get("X-Notification-Kind"); got != tt.kind {
+				t.Errorf("X-Notification-Kind = %q, want %q", got, tt.kind)
+			}
+			for _, want := range tt.textHas {
+				if !strings.Contains(m.Text, want) {
+					t.Errorf("text part lacks %q:\n%s", want, m.Text)
+				}
+			}
+			for _, want := range tt.htmlHas {
+				if !strings.Contains(m.HTML, want) {
+					t.Errorf("HTML part lacks %q:\n%s", want, m.HTML)
+				}
+			}
+		})
+	}
+}
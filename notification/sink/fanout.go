@@ -0,0 +1,28 @@
+package sink
+
+import (
+	"context"
+	"errors"
+
+	"e-commerce/common/models"
+)
+
+// FanoutSink delivers every notification to each of its sinks in turn.
+// All sinks are tried even if one fails; the errors are joined.
+type FanoutSink []NotificationSink
+
+func (f FanoutSink) NotifyReserved(ctx context.Context, evt models.InventoryReserved) error {
+	var errs []error
+	for _, s := range f {
+		errs = append(errs, s.NotifyReserved(ctx, evt))
+	}
+	return errors.Join(errs...)
+}
+
+func (f FanoutSink) NotifyFailed(ctx context.Context, evt models.InventoryFailed) error {
+	var errs []error
+	for _, s := range f {
+		errs = append(errs, s.NotifyFailed(ctx, evt))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,170 @@
+package sink
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"e-commerce/common/logger"
+	"e-commerce/common/models"
+	"e-commerce/notification/deliveries"
+
+	"go.uber.org/zap"
+)
+
+// LoggedSink records every attempt of one channel in the delivery log.
+// Attempts at the same event and channel belong to one notification, so
+// the retries of an event show up together; a resend (see WithResend)
+// starts a new one, and a digest is logged under every notification it
+// collapses. A log that cannot be written is reported but does not fail
+// the notification.
+type LoggedSink struct {
+	channel string
+	inner   NotificationSink
+	store   *deliveries.Store
+	logger  *zap.Logger
+}
+
+func NewLoggedSink(channel string, inner NotificationSink, store *deliveries.Store, log *zap.Logger) *LoggedSink {
+	return &LoggedSink{channel: channel, inner: inner, store: store, logger: log}
+}
+
+func (s *LoggedSink) NotifyReserved(ctx context.Context, evt models.InventoryReserved) error {
+	key := eventKey(ctx, models.TypeInventoryReserved, evt.OrderID)
+	return s.record(ctx, OrderConfirmed, key, evt.OrderID, evt.UserID, evt, func(ctx context.Context) error {
+		return s.inner.NotifyReserved(ctx, evt)
+	})
+}
+
+func (s *LoggedSink) NotifyFailed(ctx context.Context, evt models.InventoryFailed) error {
+	key := eventKey(ctx, models.TypeInventoryFailed, evt.OrderID)
+	return s.record(ctx, OutOfStock, key, evt.OrderID, evt.UserID, evt, func(ctx context.Context) error {
+		return s.inner.NotifyFailed(ctx, evt)
+	})
+}
+
+// notificationID is stable for an event and channel.
+func notificationID(eventID, channel string) string {
+	sum := sha256.Sum256([]byte(eventID + "\x00" + channel))
+	return "ntf_" + hex.EncodeToString(sum[:12])
+}
+
+func (s *LoggedSink) record(ctx context.Context, kind, eventID, orderID, userID string, evt any, send func(context.Context) error) error {
+	n, err := s.notification(ctx, kind, eventID, orderID, userID, evt)
+	if err != nil {
+		return err
+	}
+	a, err := attempt(ctx, send)
+	s.log(ctx, n, a)
+	return err
+}
+
+// NotifyDigest sends d through the channel and logs the attempt under
+// each notification it collapses, as if each had been sent on its own.
+func (s *LoggedSink) NotifyDigest(ctx context.Context, d Digest) error {
+	ds, ok := s.inner.(DigestSink)
+	if !ok {
+		return fmt.Errorf("channel %s cannot send digests", s.channel)
+	}
+	ns := make([]deliveries.Notification, len(d.Entries))
+	for i, e := range d.Entries {
+		_, _, orderID := describe(e.Event)
+		n, err := s.notification(ctx, e.Kind, e.EventID, orderID, d.UserID, e.Event)
+		if err != nil {
+			return err
+		}
+		ns[i] = n
+	}
+	a, err := attempt(ctx, func(ctx context.Context) error { return ds.NotifyDigest(ctx, d) })
+	for _, n := range ns {
+		s.log(ctx, n, a)
+	}
+	return err
+}
+
+func (s *LoggedSink) notification(ctx context.Context, kind, eventID, orderID, userID string, evt any) (deliveries.Notification, error) {
+	event, err := json.Marshal(evt)
+	if err != nil {
+		return deliveries.Notification{}, err
+	}
+	n := deliveries.Notification{
+		ID: notificationID(eventID, s.channel), OrderID: orderID, UserID: userID,
+		Kind: kind, Channel: s.channel, Event: event,
+	}
+	if r, ok := resendFrom(ctx); ok {
+		n.ID, n.ResendOf, n.RequestedBy, n.Reason = r.ID, r.Of, r.RequestedBy, r.Reason
+	}
+	return n, nil
+}
+
+// attempt runs send and describes how it went.
+func attempt(ctx context.Context, send func(context.Context) error) (deliveries.Attempt, error) {
+	ctx, rendered := withRendered(ctx)
+	a := deliveries.Attempt{StartedAt: time.Now(), Status: deliveries.Delivered}
+	err := send(ctx)
+	a.FinishedAt = time.Now()
+	a.PayloadHash = rendered.hash
+	if err != nil {
+		a.Status, a.Error = deliveries.Failed, err.Error()
+	}
+	return a, err
+}
+
+func (s *LoggedSink) log(ctx context.Context, n deliveries.Notification, a deliveries.Attempt) {
+	// The log must be written even when ctx is cancelled by shutdown
+	if err := s.store.Record(context.WithoutCancel(ctx), n, a); err != nil {
+		logger.WithContext(ctx, s.logger).Error("Logging notification attempt failed",
+			zap.String("notification", n.ID), zap.Error(err))
+	}
+}
+
+// Resend describes an operator resend of notification Of, logged as
+// notification ID.
+type Resend struct {
+	ID          string
+	Of          string
+	RequestedBy string
+	Reason      string
+}
+
+type resendKey struct{}
+
+// WithResend marks ctx as carrying a resend.
+func WithResend(ctx context.Context, r Resend) context.Context {
+	return context.WithValue(ctx, resendKey{}, r)
+}
+
+func resendFrom(ctx context.Context) (Resend, bool) {
+	r, ok := ctx.Value(resendKey{}).(Resend)
+	return r, ok
+}
+
+// rendered is where a channel notes what it sent, for the delivery log.
+type rendered struct {
+	hash string
+}
+
+type renderedKey struct{}
+
+func withRendered(ctx context.Context) (context.Context, *rendered) {
+	r := &rendered{}
+	return context.WithValue(ctx, renderedKey{}, r), r
+}
+
+// noteRendered records the hash of a rendered message's parts, if ctx
+// comes from a LoggedSink.
+func noteRendered(ctx context.Context, parts ...string) {
+	r, ok := ctx.Value(renderedKey{}).(*rendered)
+	if !ok {
+		return
+	}
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	r.hash = "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
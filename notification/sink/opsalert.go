@@ -0,0 +1,278 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"e-commerce/common/config"
+	"e-commerce/common/metrics"
+	"e-commerce/common/models"
+
+	"go.uber.org/zap"
+)
+
+// OpsAlertSink posts inventory failures to the ops team's chat through
+// an incoming webhook. Failures are counted per SKU and reason class,
+// as distinct orders, over a window that starts with the first one.
+// When the window ends a single alert summarises it, if the count
+// reached the reason's warning threshold; reaching the critical
+// threshold posts at once, without waiting for the window to end.
+//
+// Nothing is posted from the consumer: NotifyFailed only counts, and
+// Run posts. A failed post is logged and dropped, never failing the
+// notification.
+type OpsAlertSink struct {
+	url     string
+	client  *http.Client
+	window  time.Duration
+	reasons []alertReason // in match order
+	logger  *zap.Logger
+
+	mu      sync.Mutex
+	windows map[failureKey]*failureWindow
+}
+
+type alertReason struct {
+	name string
+	config.AlertReason
+}
+
+type failureKey struct {
+	sku, reason string
+}
+
+// failureWindow counts the failures of one SKU and reason class.
+type failureWindow struct {
+	class     alertReason
+	start     time.Time
+	orders    []string // distinct, oldest first
+	reason    string   // the latest reason as reported
+	escalated int      // orders counted when the critical alert went out; 0 if it has not
+}
+
+// opsAlertTick is how often Run looks for alerts due.
+const opsAlertTick = time.Second
+
+// NewOpsAlertSink posts to url, which is cfg.WebhookURL unless the
+// capture server stands in for it.
+func NewOpsAlertSink(cfg config.OpsAlerts, url string, log *zap.Logger) *OpsAlertSink {
+	reasons := make([]alertReason, 0, len(cfg.Reasons))
+	for name, r := range cfg.Reasons {
+		reasons = append(reasons, alertReason{name: name, AlertReason: r})
+	}
+	// By name, with the fallback (empty match) last
+	sort.Slice(reasons, func(i, j int) bool {
+		if (reasons[i].Match == "") != (reasons[j].Match == "") {
+			return reasons[j].Match == ""
+		}
+		return reasons[i].name < reasons[j].name
+	})
+	return &OpsAlertSink{
+		url:     url,
+		client:  &http.Client{Timeout: cfg.Timeout},
+		window:  cfg.Window,
+		reasons: reasons,
+		logger:  log,
+		windows: map[failureKey]*failureWindow{},
+	}
+}
+
+func (s *OpsAlertSink) NotifyReserved(context.Context, models.InventoryReserved) error {
+	return nil
+}
+
+func (s *OpsAlertSink) NotifyFailed(_ context.Context, evt models.InventoryFailed) error {
+	reason, ok := s.classify(evt.Reason)
+	if !ok {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sku := range failedSKUs(evt) {
+		k := failureKey{sku: sku, reason: reason.name}
+		w, ok := s.windows[k]
+		if !ok {
+			w = &failureWindow{class: reason, start: time.Now()}
+			s.windows[k] = w
+		}
+		w.reason = evt.Reason
+		// Redelivered events must not count twice
+		if !slices.Contains(w.orders, evt.OrderID) {
+			w.orders = append(w.orders, evt.OrderID)
+		}
+	}
+	return nil
+}
+
+// classify returns the first reason class matching a failure reason.
+func (s *OpsAlertSink) classify(reason string) (alertReason, bool) {
+	lower := strings.ToLower(reason)
+	for _, r := range s.reasons {
+		if strings.Contains(lower, strings.ToLower(r.Match)) {
+			return r, true
+		}
+	}
+	return alertReason{}, false
+}
+
+// quoted finds the SKUs the inventory service names in its reasons,
+// e.g. `item "foo" out of stock`.
+var quoted = regexp.MustCompile(`"([^"]+)"`)
+
+// failedSKUs returns the SKUs a failure is about: those its reason
+// names, or else every item of the order.
+func failedSKUs(evt models.InventoryFailed) []string {
+	var skus []string
+	for _, m := range quoted.FindAllStringSubmatch(evt.Reason, -1) {
+		if slices.Contains(evt.Items, m[1]) && !slices.Contains(skus, m[1]) {
+			skus = append(skus, m[1])
+		}
+	}
+	if len(skus) == 0 {
+		skus = evt.Items
+	}
+	if len(skus) == 0 {
+		skus = []string{"unknown"}
+	}
+	return skus
+}
+
+// Run posts alerts as they fall due until ctx is cancelled, then posts
+// what the open windows have counted so far.
+func (s *OpsAlertSink) Run(ctx context.Context) error {
+	t := time.NewTicker(opsAlertTick)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			s.post(context.WithoutCancel(ctx), s.due(time.Now(), true))
+			return nil
+		case now := <-t.C:
+			s.post(ctx, s.due(now, false))
+		}
+	}
+}
+
+// due collects the alerts to post at now; final closes every window.
+func (s *OpsAlertSink) due(now time.Time, final bool) []models.OpsAlert {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var alerts []models.OpsAlert
+	for k, w := range s.windows {
+		th, n := w.class, len(w.orders)
+		ended := final || now.Sub(w.start) >= s.window
+		if !ended {
+			if th.Critical > 0 && n >= th.Critical && w.escalated == 0 {
+				a := s.alert(k, w, models.SeverityCritical, now)
+				a.Summary = fmt.Sprintf("SKU %s: %d orders failed so far (%s, critical at %d)", k.sku, n, k.reason, th.Critical)
+				alerts = append(alerts, a)
+				w.escalated = n
+			}
+			continue
+		}
+		delete(s.windows, k)
+		if n == w.escalated {
+			continue
+		}
+		sev := ""
+		switch {
+		case th.Critical > 0 && n >= th.Critical:
+			sev = models.SeverityCritical
+		case th.Warning > 0 && n >= th.Warning:
+			sev = models.SeverityWarning
+		default:
+			continue
+		}
+		span := min(now.Sub(w.start), s.window).Round(time.Second)
+		a := s.alert(k, w, sev, now)
+		a.Summary = fmt.Sprintf("SKU %s: %d orders failed within %s (%s)", k.sku, n, span, k.reason)
+		if w.escalated > 0 {
+			a.Summary += fmt.Sprintf(", %d since the critical alert", n-w.escalated)
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts
+}
+
+func (s *OpsAlertSink) alert(k failureKey, w *failureWindow, sev string, now time.Time) models.OpsAlert {
+	return models.OpsAlert{
+		Source:   "notification",
+		Kind:     "inventory_failure",
+		Severity: sev,
+		Subject:  k.sku,
+		Details: map[string]any{
+			"reason_class": k.reason,
+			"reason":       w.reason,
+			"orders":       slices.Clone(w.orders),
+			"window_start": w.start,
+		},
+		Time: now,
+	}
+}
+
+// post sends each alert, logging the ones that fail.
+func (s *OpsAlertSink) post(ctx context.Context, alerts []models.OpsAlert) {
+	for _, a := range alerts {
+		log := s.logger.With(zap.String("sku", a.Subject), zap.String("severity", a.Severity))
+		if err := s.send(ctx, a); err != nil {
+			metrics.OpsAlertsPosted.WithLabelValues(a.Severity, "failed").Inc()
+			log.Error("Posting ops alert failed", zap.Error(err))
+			continue
+		}
+		metrics.OpsAlertsPosted.WithLabelValues(a.Severity, "sent").Inc()
+		log.Info("Ops alert posted", zap.String("summary", a.Summary))
+	}
+}
+
+func (s *OpsAlertSink) send(ctx context.Context, a models.OpsAlert) error {
+	body, err := json.Marshal(map[string]string{"text": chatText(a)})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// chatText formats an alert in the mrkdwn incoming webhooks render.
+func chatText(a models.OpsAlert) string {
+	icon := "⚠️"
+	if a.Severity == models.SeverityCritical {
+		icon = "🚨"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s *%s* · inventory failures · SKU `%s`\n%s", icon, strings.ToUpper(a.Severity), a.Subject, a.Summary)
+	if r, _ := a.Details["reason"].(string); r != "" {
+		fmt.Fprintf(&b, "\n> %s", r)
+	}
+	if orders, _ := a.Details["orders"].([]string); len(orders) > 0 {
+		const shown = 5
+		b.WriteString("\nOrders: " + strings.Join(orders[:min(len(orders), shown)], ", "))
+		if len(orders) > shown {
+			fmt.Fprintf(&b, " and %d more", len(orders)-shown)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,151 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"e-commerce/common/config"
+	"e-commerce/common/models"
+	"e-commerce/notification/hookcapture"
+
+	"go.uber.org/zap"
+)
+
+const testAlertWindow = time.Minute
+
+func newCapturedOpsAlertSink(t *testing.T) (*OpsAlertSink, *hookcapture.Server) {
+	t.Helper()
+	srv, err := hookcapture.Start("127.0.0.1:0", zap.NewNop())
+	if err != nil {
+		t.Fatalf("starting capture server: %v", err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	s := NewOpsAlertSink(config.OpsAlerts{
+		Timeout: 5 * time.Second,
+		Window:  testAlertWindow,
+		Reasons: map[string]config.AlertReason{
+			"out_of_stock": {Match: "out of stock", Warning: 2, Critical: 3},
+			"other":        {Warning: 5, Critical: 20},
+		},
+	}, srv.URL(), zap.NewNop())
+	return s, srv
+}
+
+func outOfStock(orderID, sku string, items ...string) models.InventoryFailed {
+	return models.InventoryFailed{OrderID: orderID, Items: items, Reason: `item "` + sku + `" out of stock`}
+}
+
+// postDue posts the alerts due at now and returns the texts captured
+// since the last call.
+func postDue(t *testing.T, s *OpsAlertSink, srv *hookcapture.Server, now time.Time) []string {
+	t.Helper()
+	s.post(context.Background(), s.due(now, false))
+	var texts []string
+	for _, p := range srv.Posts() {
+		var body struct{ Text string }
+		if err := json.Unmarshal(p.Body, &body); err != nil {
+			t.Fatalf("decoding post %s: %v", p.Body, err)
+		}
+		texts = append(texts, body.Text)
+	}
+	srv.Reset()
+	return texts
+}
+
+func notifyFailed(t *testing.T, s *OpsAlertSink, evts ...models.InventoryFailed) {
+	t.Helper()
+	for _, evt := range evts {
+		if err := s.NotifyFailed(context.Background(), evt); err != nil {
+			t.Fatalf("NotifyFailed(%s): %v", evt.OrderID, err)
+		}
+	}
+}
+
+func TestOpsAlertAggregatesPerSKU(t *testing.T) {
+	s, srv := newCapturedOpsAlertSink(t)
+	start := time.Now()
+	notifyFailed(t, s,
+		outOfStock("o1", "foo", "foo", "bar"),
+		outOfStock("o2", "foo", "foo"),
+		outOfStock("o3", "bar", "bar"),
+	)
+
+	if got := postDue(t, s, srv, start.Add(testAlertWindow/2)); len(got) != 0 {
+		t.Fatalf("posted before the window ended: %q", got)
+	}
+	got := postDue(t, s, srv, start.Add(testAlertWindow+time.Second))
+	if len(got) != 1 {
+		t.Fatalf("want one alert, for foo; got %q", got)
+	}
+	for _, want := range []string{"*WARNING*", "SKU `foo`", "2 orders failed", "Orders: o1, o2"} {
+		if !strings.Contains(got[0], want) {
+			t.Errorf("alert lacks %q:\n%s", want, got[0])
+		}
+	}
+}
+
+func TestOpsAlertCountsRedeliveredOrderOnce(t *testing.T) {
+	s, srv := newCapturedOpsAlertSink(t)
+	start := time.Now()
+	notifyFailed(t, s,
+		outOfStock("o1", "foo", "foo"),
+		outOfStock("o1", "foo", "foo"),
+		outOfStock("o1", "foo", "foo"),
+	)
+	if got := postDue(t, s, srv, start.Add(testAlertWindow+time.Second)); len(got) != 0 {
+		t.Fatalf("one order posted as several: %q", got)
+	}
+}
+
+func TestOpsAlertEscalatesMidWindow(t *testing.T) {
+	s, srv := newCapturedOpsAlertSink(t)
+	start := time.Now()
+	notifyFailed(t, s,
+		outOfStock("o1", "foo", "foo"),
+		outOfStock("o2", "foo", "foo"),
+		outOfStock("o3", "foo", "foo"),
+	)
+	got := postDue(t, s, srv, start.Add(time.Second))
+	if len(got) != 1 {
+		t.Fatalf("want one critical alert before the window ends, got %q", got)
+	}
+	for _, want := range []string{"*CRITICAL*", "SKU `foo`", "3 orders failed so far"} {
+		if !strings.Contains(got[0], want) {
+			t.Errorf("alert lacks %q:\n%s", want, got[0])
+		}
+	}
+	if got := postDue(t, s, srv, start.Add(2*time.Second)); len(got) != 0 {
+		t.Errorf("escalated twice: %q", got)
+	}
+
+	// A failure after the escalation is summarised when the window ends
+	notifyFailed(t, s, outOfStock("o4", "foo", "foo"))
+	got = postDue(t, s, srv, start.Add(testAlertWindow+time.Second))
+	if len(got) != 1 || !strings.Contains(got[0], "4 orders failed within") || !strings.Contains(got[0], "1 since the critical alert") {
+		t.Errorf("want a summary of the window, got %q", got)
+	}
+}
+
+func TestOpsAlertNoSecondPostWithoutNewFailures(t *testing.T) {
+	s, srv := newCapturedOpsAlertSink(t)
+	start := time.Now()
+	notifyFailed(t, s,
+		outOfStock("o1", "foo", "foo"),
+		outOfStock("o2", "foo", "foo"),
+		outOfStock("o3", "foo", "foo"),
+	)
+	if got := postDue(t, s, srv, start.Add(time.Second)); len(got) != 1 {
+		t.Fatalf("want one critical alert, got %q", got)
+	}
+	if got := postDue(t, s, srv, start.Add(testAlertWindow+time.Second)); len(got) != 0 {
+		t.Errorf("window posted again with nothing new: %q", got)
+	}
+	// The window is closed: the next failure starts a new one
+	notifyFailed(t, s, outOfStock("o5", "foo", "foo"))
+	if got := postDue(t, s, srv, time.Now().Add(testAlertWindow+time.Second)); len(got) != 0 {
+		t.Errorf("a single failure in a new window posted: %q", got)
+	}
+}
@@ -0,0 +1,24 @@
+package sink
+
+import "context"
+
+// Recipient is who a notification is for, as resolved by the routing
+// sink. Channels that address a person read it from the context.
+type Recipient struct {
+	UserID string
+	Email  string // empty: the email sink falls back to its configured recipients
+	Locale string
+}
+
+type recipientKey struct{}
+
+// WithRecipient returns ctx carrying r.
+func WithRecipient(ctx context.Context, r Recipient) context.Context {
+	return context.WithValue(ctx, recipientKey{}, r)
+}
+
+// RecipientFrom returns the recipient carried by ctx, if any.
+func RecipientFrom(ctx context.Context) (Recipient, bool) {
+	r, ok := ctx.Value(recipientKey{}).(Recipient)
+	return r, ok
+}
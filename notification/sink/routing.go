@@ -0,0 +1,415 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"e-commerce/common/logger"
+	"e-commerce/common/metrics"
+	"e-commerce/common/models"
+	"e-commerce/notification/limits"
+	"e-commerce/notification/preferences"
+
+	"go.uber.org/zap"
+)
+
+// RoutingSink sends each notification to the channels its user chose.
+// Users without stored preferences (and events without a user ID) get
+// the defaults. Kinds the user opted out of are dropped; during the
+// user's quiet hours the notification is held in the preferences store
+// and delivered by RunDeferred when they end.
+//
+// With a limiter (see SetLimiter) each notification must also fit the
+// rate limits of its user and channel; those over a limit are dropped
+// or queued and sent as one digest when the limit's window ends.
+//
+// Channels that queue (see BulkheadSink) are handed the notification
+// and send it in the background, retrying on their own, so one failing
+// channel neither delays nor repeats the others. A channel that refuses
+// a notification (see UnavailableError) has it held like in quiet hours.
+type RoutingSink struct {
+	prefs       *preferences.Store
+	limiter     *limits.Limiter // nil: no rate limits
+	channels    map[string]NotificationSink
+	defaults    preferences.Preferences
+	maxAttempts int           // for held notifications
+	poll        time.Duration // how often RunDeferred looks for due notifications
+	logger      *zap.Logger
+}
+
+// NewRoutingSink routes to channels by name. defaults supplies the
+// channels and locale of users without preferences.
+func NewRoutingSink(prefs *preferences.Store, channels map[string]NotificationSink,
+	defaults preferences.Preferences, maxAttempts int, poll time.Duration, log *zap.Logger) *RoutingSink {
+	return &RoutingSink{prefs: prefs, channels: channels, defaults: defaults,
+		maxAttempts: maxAttempts, poll: poll, logger: log}
+}
+
+// SetLimiter enables rate limits. Call it before the first notification.
+func (r *RoutingSink) SetLimiter(l *limits.Limiter) {
+	r.limiter = l
+}
+
+// Channels returns the names of the configured channels.
+func (r *RoutingSink) Channels() []string {
+	names := make([]string, 0, len(r.channels))
+	for n := range r.channels {
+		names = append(names, n)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Defaults returns the preferences of users who stored none.
+func (r *RoutingSink) Defaults(userID string) preferences.Preferences {
+	p := r.defaults
+	p.UserID = userID
+	return p
+}
+
+func (r *RoutingSink) NotifyReserved(ctx context.Context, evt models.InventoryReserved) error {
+	return r.route(ctx, OrderConfirmed, evt.UserID, evt)
+}
+
+func (r *RoutingSink) NotifyFailed(ctx context.Context, evt models.InventoryFailed) error {
+	return r.route(ctx, OutOfStock, evt.UserID, evt)
+}
+
+// preferencesFor returns the user's preferences, or the defaults.
+func (r *RoutingSink) preferencesFor(ctx context.Context, userID string) (preferences.Preferences, error) {
+	if userID == "" {
+		return r.Defaults(""), nil
+	}
+	p, err := r.prefs.Get(ctx, userID)
+	if errors.Is(err, preferences.ErrNotFound) {
+		return r.Defaults(userID), nil
+	} else if err != nil {
+		return preferences.Preferences{}, fmt.Errorf("loading preferences of %s: %w", userID, err)
+	}
+	return p, nil
+}
+
+func (r *RoutingSink) route(ctx context.Context, kind, userID string, evt any) error {
+	log := logger.WithContext(ctx, r.logger).With(zap.String("kind", kind), zap.String("userID", userID))
+	p, err := r.preferencesFor(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(p.OptOuts, kind) {
+		log.Debug("User opted out, notification dropped")
+		metrics.NotificationsRouted.WithLabelValues("", "opted_out").Inc()
+		return nil
+	}
+	if len(p.Channels) == 0 {
+		log.Debug("User has no channels, notification dropped")
+		metrics.NotificationsRouted.WithLabelValues("", "no_channel").Inc()
+		return nil
+	}
+
+	if until, quiet := p.QuietHours.Until(time.Now()); quiet {
+		payload, err := json.Marshal(evt)
+		if err != nil {
+			return err
+		}
+		for _, ch := range p.Channels {
+			if err := r.prefs.Defer(ctx, preferences.Deferred{
+				UserID: userID, Channel: ch, Kind: kind, Payload: payload, DeliverAt: until,
+			}); err != nil {
+				return err
+			}
+			metrics.NotificationsRouted.WithLabelValues(ch, "deferred").Inc()
+		}
+		log.Info("Quiet hours, notification held", zap.Time("until", until), zap.Strings("channels", p.Channels))
+		return nil
+	}
+
+	ctx = WithRecipient(ctx, Recipient{UserID: userID, Email: p.Email, Locale: p.Locale})
+	var errs []error
+	for _, ch := range p.Channels {
+		err := r.send(ctx, ch, evt, true)
+		var unavailable *UnavailableError
+		if errors.As(err, &unavailable) {
+			err = r.Hold(ctx, ch, evt, unavailable.RetryAt)
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// Hold keeps a notification to ctx's recipient that channel could not
+// take, to be delivered by RunDeferred from at. It is the HoldFunc of
+// the channels' bulkheads.
+func (r *RoutingSink) Hold(ctx context.Context, channel string, evt any, at time.Time) error {
+	rcpt, _ := RecipientFrom(ctx)
+	kind, _, _ := describe(evt)
+	payload, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+	// Also called by workers after their caller is gone
+	if err := r.prefs.Defer(context.WithoutCancel(ctx), preferences.Deferred{
+		UserID: rcpt.UserID, Channel: channel, Kind: kind, Payload: payload, DeliverAt: at,
+	}); err != nil {
+		return err
+	}
+	logger.WithContext(ctx, r.logger).Info("Channel unavailable, notification held",
+		zap.String("channel", channel), zap.String("kind", kind), zap.String("userID", rcpt.UserID))
+	return nil
+}
+
+// queuer is a channel that sends in the background.
+type queuer interface {
+	Enqueue(ctx context.Context, evt any) error
+}
+
+// send delivers evt on one channel, or with queue hands it to the
+// channel's workers if it has them.
+func (r *RoutingSink) send(ctx context.Context, channel string, evt any, queue bool) error {
+	s, ok := r.channels[channel]
+	if !ok {
+		// Preferences may name a channel this deployment does not run
+		metrics.NotificationsRouted.WithLabelValues(channel, "no_channel").Inc()
+		logger.WithContext(ctx, r.logger).Warn("Notification channel not configured", zap.String("channel", channel))
+		return nil
+	}
+	if held, err := r.limit(ctx, channel, evt); err != nil || held {
+		return err
+	}
+	if q, ok := s.(queuer); ok && queue {
+		err := q.Enqueue(ctx, evt)
+		if err == nil {
+			metrics.NotificationsRouted.WithLabelValues(channel, "queued").Inc()
+		} else {
+			metrics.NotificationsRouted.WithLabelValues(channel, "unavailable").Inc()
+		}
+		return err
+	}
+	var err error
+	switch e := evt.(type) {
+	case models.InventoryReserved:
+		err = s.NotifyReserved(ctx, e)
+	case models.InventoryFailed:
+		err = s.NotifyFailed(ctx, e)
+	default:
+		err = fmt.Errorf("cannot route %T", evt)
+	}
+	var unavailable *UnavailableError
+	switch {
+	case errors.As(err, &unavailable):
+		metrics.NotificationsRouted.WithLabelValues(channel, "unavailable").Inc()
+		return err
+	case err != nil:
+		metrics.NotificationsRouted.WithLabelValues(channel, "failed").Inc()
+		return fmt.Errorf("%s: %w", channel, err)
+	}
+	metrics.NotificationsRouted.WithLabelValues(channel, "sent").Inc()
+	return nil
+}
+
+// limit counts evt against the rate limits of its recipient and
+// channel, reporting whether it was held back: queued for a digest or
+// dropped. Operator resends are not limited.
+func (r *RoutingSink) limit(ctx context.Context, channel string, evt any) (bool, error) {
+	if r.limiter == nil {
+		return false, nil
+	}
+	if _, ok := resendFrom(ctx); ok {
+		return false, nil
+	}
+	rcpt, _ := RecipientFrom(ctx)
+	d, err := r.limiter.Take(ctx, rcpt.UserID, channel, time.Now())
+	if err != nil {
+		return false, fmt.Errorf("checking rate limits: %w", err)
+	}
+	kind, typ, orderID := describe(evt)
+	log := logger.WithContext(ctx, r.logger).With(zap.String("channel", channel), zap.String("kind", kind),
+		zap.String("orderID", orderID), zap.String("userID", rcpt.UserID))
+	switch d.Action {
+	case limits.Allow:
+		return false, nil
+	case limits.Digest:
+		payload, err := json.Marshal(evt)
+		if err != nil {
+			return false, err
+		}
+		if err := r.limiter.Queue(ctx, limits.Entry{
+			UserID: rcpt.UserID, Channel: channel, Kind: kind, EventID: eventKey(ctx, typ, orderID),
+			Payload: payload, FlushAt: d.Until,
+		}); err != nil {
+			return false, err
+		}
+		metrics.NotificationsRouted.WithLabelValues(channel, "digested").Inc()
+		log.Info("Rate limit reached, notification queued for digest", zap.Time("until", d.Until))
+	default:
+		metrics.NotificationsRouted.WithLabelValues(channel, "rate_limited").Inc()
+		log.Warn("Rate limit reached, notification dropped", zap.Time("until", d.Until))
+	}
+	return true, nil
+}
+
+// Deliver sends evt on one channel to userID, ignoring quiet hours and
+// opt-outs: it is for notifications already routed.
+func (r *RoutingSink) Deliver(ctx context.Context, userID, channel string, evt any) error {
+	p, err := r.preferencesFor(ctx, userID)
+	if err != nil {
+		return err
+	}
+	ctx = WithRecipient(ctx, Recipient{UserID: userID, Email: p.Email, Locale: p.Locale})
+	return r.send(ctx, channel, evt, false)
+}
+
+// DecodeEvent decodes the JSON of an event of the given kind.
+func DecodeEvent(kind string, payload []byte) (any, error) {
+	switch kind {
+	case OrderConfirmed:
+		var e models.InventoryReserved
+		err := json.Unmarshal(payload, &e)
+		return e, err
+	case OutOfStock:
+		var e models.InventoryFailed
+		err := json.Unmarshal(payload, &e)
+		return e, err
+	}
+	return nil, fmt.Errorf("unknown notification kind %q", kind)
+}
+
+// RunDeferred delivers held notifications as their quiet hours end, and
+// digests as their rate limit windows end, polling until ctx is
+// cancelled. A failed delivery is retried at the next poll, up to
+// maxAttempts.
+func (r *RoutingSink) RunDeferred(ctx context.Context) error {
+	t := time.NewTicker(r.poll)
+	defer t.Stop()
+	for {
+		r.deliverDue(ctx)
+		r.flushDigests(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+func (r *RoutingSink) deliverDue(ctx context.Context) {
+	due, err := r.prefs.Due(ctx, time.Now(), 100)
+	if err != nil {
+		if ctx.Err() == nil {
+			r.logger.Error("Loading held notifications failed", zap.Error(err))
+		}
+		return
+	}
+	for _, d := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		log := r.logger.With(zap.String("userID", d.UserID), zap.String("channel", d.Channel), zap.String("kind", d.Kind))
+		evt, err := DecodeEvent(d.Kind, d.Payload)
+		if err == nil {
+			// Preferences may have changed while the notification was held
+			err = r.Deliver(ctx, d.UserID, d.Channel, evt)
+		}
+		var unavailable *UnavailableError
+		switch {
+		case err == nil:
+			log.Info("Held notification delivered")
+		case errors.As(err, &unavailable):
+			// Not an attempt: the channel refused it without trying
+			if err := r.prefs.Postpone(ctx, d.ID, later(unavailable.RetryAt, time.Now().Add(r.poll))); err != nil {
+				log.Error("Rescheduling held notification failed", zap.Error(err))
+			}
+			continue
+		case d.Attempts+1 >= r.maxAttempts:
+			log.Error("Held notification dropped after retries", zap.Int("attempts", d.Attempts+1), zap.Error(err))
+		default:
+			log.Warn("Held notification failed, retrying", zap.Error(err))
+			if err := r.prefs.Retry(ctx, d.ID, time.Now().Add(r.poll)); err != nil {
+				log.Error("Rescheduling held notification failed", zap.Error(err))
+			}
+			continue
+		}
+		if err := r.prefs.Done(ctx, d.ID); err != nil {
+			log.Error("Removing held notification failed", zap.Error(err))
+		}
+	}
+}
+
+func (r *RoutingSink) flushDigests(ctx context.Context) {
+	if r.limiter == nil {
+		return
+	}
+	due, err := r.limiter.Due(ctx, time.Now(), 500)
+	if err != nil {
+		if ctx.Err() == nil {
+			r.logger.Error("Loading due digests failed", zap.Error(err))
+		}
+		return
+	}
+	for _, b := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		log := r.logger.With(zap.String("userID", b.UserID), zap.String("channel", b.Channel),
+			zap.Int("notifications", len(b.Entries)))
+		attempts := 0
+		for _, e := range b.Entries {
+			attempts = max(attempts, e.Attempts)
+		}
+		err := r.sendDigest(ctx, b)
+		var unavailable *UnavailableError
+		switch {
+		case errors.As(err, &unavailable):
+			if err := r.limiter.Postpone(ctx, b, later(unavailable.RetryAt, time.Now().Add(r.poll))); err != nil {
+				log.Error("Rescheduling digest failed", zap.Error(err))
+			}
+			continue
+		case err == nil:
+			metrics.NotificationDigests.WithLabelValues(b.Channel, "sent").Inc()
+			log.Info("Digest delivered")
+		case attempts+1 >= r.maxAttempts:
+			metrics.NotificationDigests.WithLabelValues(b.Channel, "failed").Inc()
+			log.Error("Digest dropped after retries", zap.Int("attempts", attempts+1), zap.Error(err))
+		default:
+			log.Warn("Digest failed, retrying", zap.Error(err))
+			if err := r.limiter.Retry(ctx, b, time.Now().Add(r.poll)); err != nil {
+				log.Error("Rescheduling digest failed", zap.Error(err))
+			}
+			continue
+		}
+		if err := r.limiter.Done(ctx, b); err != nil {
+			log.Error("Removing sent digest failed", zap.Error(err))
+		}
+	}
+}
+
+// sendDigest sends one user's queued notifications on their channel.
+func (r *RoutingSink) sendDigest(ctx context.Context, b limits.Batch) error {
+	s, ok := r.channels[b.Channel].(DigestSink)
+	if !ok {
+		return fmt.Errorf("channel %s cannot send digests", b.Channel)
+	}
+	d := Digest{UserID: b.UserID}
+	for _, e := range b.Entries {
+		evt, err := DecodeEvent(e.Kind, e.Payload)
+		if err != nil {
+			return err
+		}
+		d.Entries = append(d.Entries, DigestEntry{Kind: e.Kind, EventID: e.EventID, Event: evt})
+	}
+	p, err := r.preferencesFor(ctx, b.UserID)
+	if err != nil {
+		return err
+	}
+	return s.NotifyDigest(WithRecipient(ctx, Recipient{UserID: b.UserID, Email: p.Email, Locale: p.Locale}), d)
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
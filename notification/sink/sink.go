@@ -1,100 +1,156 @@
 package sink
 
 import (
-	"errors"
+	"context"
+	"strings"
 	"sync"
-	"time"
+	"sync/atomic"
 
+	"e-commerce/common/dedupe"
+	"e-commerce/common/logger"
+	"e-commerce/common/metrics"
 	"e-commerce/common/models"
+	"e-commerce/common/tracing"
+	"e-commerce/notification/templates"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"go.uber.org/zap"
 )
 
 // NotificationSink defines delivery methods.
+// ctx carries the trace of the event being notified.
 type NotificationSink interface {
-	NotifyReserved(models.InventoryReserved) error
-	NotifyFailed(models.InventoryFailed) error
+	NotifyReserved(context.Context, models.InventoryReserved) error
+	NotifyFailed(context.Context, models.InventoryFailed) error
 }
 
-// ConsoleSink logs to stdout.
+var tracer = tracing.Tracer("e-commerce/notification/sink")
+
+// ConsoleSink logs each notification, rendered from its console
+// template in the recipient's locale.
 type ConsoleSink struct {
-	logger *zap.Logger
+	templates *templates.Registry
+	logger    *zap.Logger
 }
 
-func NewConsoleSink(log *zap.Logger) *ConsoleSink {
-	return &ConsoleSink{logger: log}
+// NewConsoleSink checks that reg has console templates for every kind.
+func NewConsoleSink(reg *templates.Registry, log *zap.Logger) (*ConsoleSink, error) {
+	if err := reg.Require([]string{OrderConfirmed, OutOfStock}, []string{"console"}); err != nil {
+		return nil, err
+	}
+	return &ConsoleSink{templates: reg, logger: log}, nil
 }
 
-func (s *ConsoleSink) NotifyReserved(evt models.InventoryReserved) error {
-	s.logger.Info("✔️ Reservation notification",
-		zap.String("orderID", evt.OrderID),
-		zap.Any("items", evt.Items),
-	)
-	return nil
+func (s *ConsoleSink) NotifyReserved(ctx context.Context, evt models.InventoryReserved) error {
+	return s.log(ctx, OrderConfirmed, reservedData(evt))
+}
+
+func (s *ConsoleSink) NotifyFailed(ctx context.Context, evt models.InventoryFailed) error {
+	return s.log(ctx, OutOfStock, failedData(evt))
 }
 
-func (s *ConsoleSink) NotifyFailed(evt models.InventoryFailed) error {
-	s.logger.Info("❌ Failure notification",
-		zap.String("orderID", evt.OrderID),
-		zap.Any("items", evt.Items),
-		zap.String("reason", evt.Reason),
+// NotifyDigest logs one line listing every notification in d.
+func (s *ConsoleSink) NotifyDigest(ctx context.Context, d Digest) error {
+	return s.log(ctx, DigestKind, digestData(d))
+}
+
+func (s *ConsoleSink) log(ctx context.Context, kind string, data templates.Data) error {
+	locale := s.templates.DefaultLocale()
+	if r, ok := RecipientFrom(ctx); ok && r.Locale != "" {
+		locale = r.Locale
+	}
+	m, err := s.templates.Render(kind, "console", locale, data)
+	if err != nil {
+		return err
+	}
+	noteRendered(ctx, m.Text)
+	logger.WithContext(ctx, s.logger).Info(strings.TrimSpace(m.Text),
+		zap.String("kind", kind),
+		zap.String("orderID", orderIDs(data)),
+		zap.String("userID", data.UserID),
+		zap.String("locale", m.Locale),
+		zap.Int("templateVersion", m.Version),
 	)
 	return nil
 }
 
-// RetryDedupeSink wraps another sink to add retry & dedupe.
-type RetryDedupeSink struct {
+func reservedData(evt models.InventoryReserved) templates.Data {
+	return templates.Data{OrderID: evt.OrderID, UserID: evt.UserID, Items: evt.Items, Total: evt.Total}
+}
+
+func failedData(evt models.InventoryFailed) templates.Data {
+	return templates.Data{OrderID: evt.OrderID, UserID: evt.UserID, Items: evt.Items, Total: evt.Total, Reason: evt.Reason}
+}
+
+// DedupeSink wraps another sink to skip events already notified. Each
+// channel retries on its own (see BulkheadSink); nothing here does.
+type DedupeSink struct {
 	inner    NotificationSink
 	logger   *zap.Logger
-	seenKeys sync.Map
+	seenKeys sync.Map // event IDs already notified
+
+	enabled atomic.Bool // features.notifications
 }
 
-func NewRetryDedupeSink(inner NotificationSink, log *zap.Logger) *RetryDedupeSink {
-	return &RetryDedupeSink{inner: inner, logger: log}
+func NewDedupeSink(inner NotificationSink, log *zap.Logger) *DedupeSink {
+	r := &DedupeSink{inner: inner, logger: log}
+	r.SetEnabled(true)
+	return r
 }
 
-// NotifyReserved with retry & idempotency
-func (r *RetryDedupeSink) NotifyReserved(evt models.InventoryReserved) error {
-	if _, loaded := r.seenKeys.LoadOrStore(evt.OrderID, true); loaded {
-		r.logger.Debug("Duplicate notification skipped", zap.String("orderID", evt.OrderID))
-		return nil
+// SetEnabled switches delivery on or off. While off, events are
+// acknowledged and dropped.
+func (r *DedupeSink) SetEnabled(on bool) {
+	r.enabled.Store(on)
+}
+
+// NotifyReserved with idempotency
+func (r *DedupeSink) NotifyReserved(ctx context.Context, evt models.InventoryReserved) error {
+	return r.deliver(ctx, eventKey(ctx, models.TypeInventoryReserved, evt.OrderID), "reserved", evt.OrderID,
+		func(ctx context.Context) error { return r.inner.NotifyReserved(ctx, evt) })
+}
+
+// NotifyFailed with idempotency
+func (r *DedupeSink) NotifyFailed(ctx context.Context, evt models.InventoryFailed) error {
+	return r.deliver(ctx, eventKey(ctx, models.TypeInventoryFailed, evt.OrderID), "failed", evt.OrderID,
+		func(ctx context.Context) error { return r.inner.NotifyFailed(ctx, evt) })
+}
+
+// eventKey identifies the event being notified: the ID its producer set
+// or, for events from before producers set one, the ID a producer would
+// have given it.
+func eventKey(ctx context.Context, typ, orderID string) string {
+	if id, ok := dedupe.EventIDFrom(ctx); ok {
+		return id
 	}
-	return r.retryNotify(func() error {
-		return r.inner.NotifyReserved(evt)
-	}, "reserved", evt.OrderID)
+	return dedupe.EventID(typ, orderID, 1)
 }
 
-// NotifyFailed with retry & idempotency
-func (r *RetryDedupeSink) NotifyFailed(evt models.InventoryFailed) error {
-	if _, loaded := r.seenKeys.LoadOrStore(evt.OrderID, true); loaded {
-		r.logger.Debug("Duplicate notification skipped", zap.String("orderID", evt.OrderID))
+// deliver skips events already notified, unless replayed with the
+// bypass flag, and passes the rest on inside one notify span.
+func (r *DedupeSink) deliver(ctx context.Context, key, typ, orderID string, fn func(context.Context) error) (err error) {
+	if _, loaded := r.seenKeys.LoadOrStore(key, true); loaded && !dedupe.Bypassed(ctx) {
+		logger.WithContext(ctx, r.logger).Debug("Duplicate notification skipped",
+			zap.String("orderID", orderID), zap.String("eventID", key))
+		metrics.DedupeHits.WithLabelValues("notification-sink").Inc()
 		return nil
 	}
-	return r.retryNotify(func() error {
-		return r.inner.NotifyFailed(evt)
-	}, "failed", evt.OrderID)
-}
-
-// retryNotify runs the callback up to 3 times with backoff.
-func (r *RetryDedupeSink) retryNotify(fn func() error, typ, orderID string) error {
-	backoff := 100 * time.Millisecond
-	for i := 1; i <= 3; i++ {
-		if err := fn(); err != nil {
-			r.logger.Warn("Notification failed, retrying",
-				zap.String("type", typ),
-				zap.String("orderID", orderID),
-				zap.Error(err),
-				zap.Int("attempt", i),
-			)
-			time.Sleep(backoff)
-			backoff *= 2
-			continue
-		}
-		r.logger.Info("Notification delivered",
-			zap.String("type", typ),
-			zap.String("orderID", orderID),
-		)
+	ctx, span := tracer.Start(dedupe.WithEventID(ctx, key), "notify "+typ, trace.WithAttributes(
+		attribute.String("notification.type", typ),
+		attribute.String("order.id", orderID),
+	))
+	defer func() { tracing.End(span, err) }()
+	log := logger.WithContext(ctx, r.logger)
+
+	if !r.enabled.Load() {
+		log.Debug("Notifications disabled, skipping", zap.String("type", typ), zap.String("orderID", orderID))
 		return nil
 	}
-	return errors.New("notification failed after retries: " + orderID)
+	if err := fn(ctx); err != nil {
+		return err
+	}
+	log.Debug("Notification routed", zap.String("type", typ), zap.String("orderID", orderID))
+	return nil
 }
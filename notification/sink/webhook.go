@@ -0,0 +1,229 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"e-commerce/common/config"
+	"e-commerce/common/logger"
+	"e-commerce/common/metrics"
+	"e-commerce/common/models"
+	"e-commerce/notification/webhook"
+
+	"go.uber.org/zap"
+)
+
+// WebhookSink POSTs each notification as signed JSON to every enabled
+// subscription that wants it. Each subscriber is retried on its own, on
+// network errors, timeouts, 429 and 5xx; other responses fail the
+// delivery at once. Failed deliveries are recorded and count towards
+// disabling the endpoint, but do not fail the notification: one broken
+// partner must not hold up the others or the customer's email.
+type WebhookSink struct {
+	store  *webhook.Store
+	client *http.Client
+	cfg    config.Webhooks
+	retry  atomic.Pointer[config.Retry] // swapped on config reload
+	logger *zap.Logger
+}
+
+// webhookBody is what subscribers receive.
+type webhookBody struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+func NewWebhookSink(store *webhook.Store, cfg config.Webhooks, log *zap.Logger) *WebhookSink {
+	s := &WebhookSink{
+		store: store,
+		// Redirects are not followed: the subscriber registered this URL.
+		client: &http.Client{
+			Timeout:       cfg.Timeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		cfg:    cfg,
+		logger: log,
+	}
+	s.SetRetry(cfg.Retry)
+	return s
+}
+
+// SetRetry replaces the retry policy for subsequent deliveries.
+func (s *WebhookSink) SetRetry(r config.Retry) {
+	s.retry.Store(&r)
+}
+
+func (s *WebhookSink) NotifyReserved(ctx context.Context, evt models.InventoryReserved) error {
+	return s.publish(ctx, webhook.OrderConfirmed, eventKey(ctx, models.TypeInventoryReserved, evt.OrderID), evt.OrderID, evt)
+}
+
+func (s *WebhookSink) NotifyFailed(ctx context.Context, evt models.InventoryFailed) error {
+	return s.publish(ctx, webhook.OrderOutOfStock, eventKey(ctx, models.TypeInventoryFailed, evt.OrderID), evt.OrderID, evt)
+}
+
+// webhookID is derived from the event's identity (see eventKey), so a
+// redelivered or replayed event reaches subscribers with the ID they
+// have already seen, and every version of an event with a new one.
+func webhookID(eventID string) string {
+	sum := sha256.Sum256([]byte(eventID))
+	return "evt_" + hex.EncodeToString(sum[:12])
+}
+
+func (s *WebhookSink) publish(ctx context.Context, typ, eventID, orderID string, data any) error {
+	subs, err := s.store.Active(ctx, typ)
+	if err != nil {
+		return fmt.Errorf("loading webhook subscriptions: %w", err)
+	}
+	if len(subs) == 0 {
+		return nil
+	}
+	id := webhookID(eventID)
+	body, err := json.Marshal(webhookBody{ID: id, Type: typ, CreatedAt: time.Now().UTC(), Data: data})
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	for _, sub := range subs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.deliver(ctx, sub, id, typ, orderID, body)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// deliver sends body to one subscriber, retrying with jittered
+// exponential backoff, and records every attempt.
+func (s *WebhookSink) deliver(ctx context.Context, sub webhook.Subscription, id, typ, orderID string, body []byte) {
+	log := logger.WithContext(ctx, s.logger).With(
+		zap.String("subscription", sub.ID), zap.String("event", id), zap.String("orderID", orderID))
+	// Bookkeeping must be stored even when ctx is cancelled by shutdown
+	bg := context.WithoutCancel(ctx)
+
+	retry := s.retry.Load()
+	backoff := retry.Backoff
+	var lastErr error
+	for attempt := 1; attempt <= retry.MaxAttempts; attempt++ {
+		start := time.Now()
+		status, err := s.post(ctx, sub, id, typ, body)
+		rec := webhook.Attempt{
+			SubscriptionID: sub.ID, EventID: id, EventType: typ, OrderID: orderID, Attempt: attempt,
+			StatusCode: status, Duration: time.Since(start), Succeeded: err == nil, AttemptedAt: start,
+		}
+		if err != nil {
+			rec.Error = err.Error()
+		}
+		if rerr := s.store.Record(bg, rec); rerr != nil {
+			log.Error("Recording webhook attempt failed", zap.Error(rerr))
+		}
+
+		if err == nil {
+			metrics.WebhookAttempts.WithLabelValues("delivered").Inc()
+			if err := s.store.Delivered(bg, sub.ID); err != nil {
+				log.Error("Resetting webhook failure count failed", zap.Error(err))
+			}
+			log.Debug("Webhook delivered", zap.Int("attempt", attempt), zap.Int("status", status))
+			return
+		}
+		lastErr = err
+		if !retryable(status, err) || attempt == retry.MaxAttempts || ctx.Err() != nil {
+			break
+		}
+		metrics.WebhookAttempts.WithLabelValues("retried").Inc()
+		delay := jitter(backoff)
+		log.Warn("Webhook attempt failed, retrying",
+			zap.Int("attempt", attempt), zap.Int("status", status), zap.Duration("in", delay), zap.Error(err))
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+		backoff = min(backoff*2, s.cfg.MaxBackoff)
+	}
+
+	metrics.WebhookAttempts.WithLabelValues("failed").Inc()
+	log.Warn("Webhook delivery failed", zap.Error(lastErr))
+	disabled, err := s.store.Failed(bg, sub.ID, lastErr.Error(), s.cfg.DisableAfter)
+	if err != nil {
+		log.Error("Recording webhook failure failed", zap.Error(err))
+	}
+	if disabled {
+		metrics.WebhooksDisabled.Inc()
+		log.Error("Webhook endpoint disabled after repeated failures",
+			zap.String("url", sub.URL), zap.Int("after", s.cfg.DisableAfter))
+	}
+}
+
+// statusError is a non-2xx response.
+type statusError struct {
+	code int
+	body string
+}
+
+func (e *statusError) Error() string {
+	if e.body == "" {
+		return fmt.Sprintf("HTTP %d", e.code)
+	}
+	return fmt.Sprintf("HTTP %d: %s", e.code, e.body)
+}
+
+// post makes one signed attempt and returns the status code (0 if no
+// response arrived).
+func (s *WebhookSink) post(ctx context.Context, sub webhook.Subscription, id, typ string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "e-commerce-webhooks/1")
+	req.Header.Set(webhook.IDHeader, id)
+	req.Header.Set(webhook.TypeHeader, typ)
+	req.Header.Set(webhook.TimestampHeader, fmt.Sprint(now.Unix()))
+	req.Header.Set(webhook.SignatureHeader, webhook.Sign(sub.Secret, now, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, &statusError{code: resp.StatusCode, body: string(bytes.TrimSpace(snippet))}
+	}
+	return resp.StatusCode, nil
+}
+
+// retryable reports whether an attempt may succeed if repeated: no
+// response at all (connection errors, timeouts), 429 or a 5xx.
+func retryable(status int, err error) bool {
+	var se *statusError
+	if !errors.As(err, &se) {
+		return true
+	}
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// jitter spreads retries over [d/2, d) so subscribers recovering from
+// an outage are not hit by every sender at once.
+func jitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+	return d/2 + rand.N(d/2)
+}
@@ -0,0 +1,305 @@
+// Package smtpcapture is an in-process SMTP server that accepts every
+// message and keeps it in memory, so local runs and tests can send real
+// mail through the email sink and then look at what was delivered.
+// It speaks just enough SMTP for net/smtp: no TLS, and any credentials
+// are accepted.
+package smtpcapture
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Message is one captured email.
+type Message struct {
+	From     string      `json:"from"` // envelope sender
+	To       []string    `json:"to"`   // envelope recipients
+	Subject  string      `json:"subject"`
+	Header   mail.Header `json:"header"`
+	Text     string      `json:"text,omitempty"`
+	HTML     string      `json:"html,omitempty"`
+	Raw      []byte      `json:"-"`
+	Received time.Time   `json:"received"`
+}
+
+// Server captures mail sent to Addr.
+type Server struct {
+	ln     net.Listener
+	logger *zap.Logger
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	msgs    []Message
+	arrived chan struct{} // closed and replaced on every message
+	conns   map[net.Conn]struct{}
+}
+
+// Start listens on addr ("127.0.0.1:0" picks a free port) and serves
+// until Close.
+func Start(addr string, log *zap.Logger) (*Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{ln: ln, logger: log, arrived: make(chan struct{}), conns: map[net.Conn]struct{}{}}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr is the host:port to send mail to.
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// Messages returns the captured messages, oldest first.
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.msgs...)
+}
+
+// Reset forgets the captured messages.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.msgs = nil
+}
+
+// Wait blocks until at least n messages have been captured and returns
+// them, or returns ctx's error.
+func (s *Server) Wait(ctx context.Context, n int) ([]Message, error) {
+	for {
+		s.mu.Lock()
+		if len(s.msgs) >= n {
+			msgs := append([]Message(nil), s.msgs...)
+			s.mu.Unlock()
+			return msgs, nil
+		}
+		arrived := s.arrived
+		s.mu.Unlock()
+		select {
+		case <-arrived:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Close stops listening, drops open sessions and waits for them to end.
+func (s *Server) Close() error {
+	err := s.ln.Close()
+	s.mu.Lock()
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// Handler serves the captured messages as JSON; DELETE clears them.
+func (s *Server) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(s.Messages())
+		case http.MethodDelete:
+			s.Reset()
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Allow", "GET, DELETE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				s.logger.Warn("SMTP capture accept failed", zap.Error(err))
+			}
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
+				conn.Close()
+			}()
+			if err := s.session(textproto.NewConn(conn)); err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				s.logger.Debug("SMTP capture session ended", zap.Error(err))
+			}
+		}()
+	}
+}
+
+// session runs one SMTP conversation.
+func (s *Server) session(c *textproto.Conn) error {
+	if err := c.PrintfLine("220 smtpcapture ready"); err != nil {
+		return err
+	}
+	var from string
+	var to []string
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return err
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			err = c.PrintfLine("250-smtpcapture\r\n250-8BITMIME\r\n250 AUTH PLAIN LOGIN")
+		case "HELO":
+			err = c.PrintfLine("250 smtpcapture")
+		case "AUTH":
+			err = s.auth(c, arg)
+		case "MAIL":
+			from, to = angleAddr(arg), nil
+			err = c.PrintfLine("250 OK")
+		case "RCPT":
+			to = append(to, angleAddr(arg))
+			err = c.PrintfLine("250 OK")
+		case "DATA":
+			if from == "" || len(to) == 0 {
+				err = c.PrintfLine("503 need MAIL and RCPT first")
+				break
+			}
+			if err = c.PrintfLine("354 end data with <CR><LF>.<CR><LF>"); err != nil {
+				return err
+			}
+			raw, rerr := c.ReadDotBytes()
+			if rerr != nil {
+				return rerr
+			}
+			s.capture(from, to, raw)
+			from, to = "", nil
+			err = c.PrintfLine("250 OK captured")
+		case "RSET":
+			from, to = "", nil
+			err = c.PrintfLine("250 OK")
+		case "NOOP":
+			err = c.PrintfLine("250 OK")
+		case "QUIT":
+			c.PrintfLine("221 bye")
+			return nil
+		default:
+			err = c.PrintfLine("502 command not implemented")
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// auth accepts any credentials for PLAIN and LOGIN.
+func (s *Server) auth(c *textproto.Conn, arg string) error {
+	mech, initial, _ := strings.Cut(arg, " ")
+	switch strings.ToUpper(mech) {
+	case "PLAIN":
+		if initial == "" {
+			if err := c.PrintfLine("334 "); err != nil {
+				return err
+			}
+			if _, err := c.ReadLine(); err != nil {
+				return err
+			}
+		}
+	case "LOGIN":
+		for _, prompt := range []string{"VXNlcm5hbWU6", "UGFzc3dvcmQ6"} { // "Username:", "Password:"
+			if err := c.PrintfLine("334 %s", prompt); err != nil {
+				return err
+			}
+			if _, err := c.ReadLine(); err != nil {
+				return err
+			}
+		}
+	default:
+		return c.PrintfLine("504 unrecognized authentication type")
+	}
+	return c.PrintfLine("235 authenticated")
+}
+
+func angleAddr(arg string) string {
+	if i := strings.IndexByte(arg, '<'); i >= 0 {
+		if j := strings.IndexByte(arg[i:], '>'); j >= 0 {
+			return arg[i+1 : i+j]
+		}
+	}
+	_, addr, _ := strings.Cut(arg, ":")
+	return strings.TrimSpace(addr)
+}
+
+func (s *Server) capture(from string, to []string, raw []byte) {
+	m := Message{From: from, To: to, Raw: raw, Received: time.Now()}
+	if msg, err := mail.ReadMessage(bytes.NewReader(raw)); err == nil {
+		m.Header = msg.Header
+		dec := new(mime.WordDecoder)
+		if subj, err := dec.DecodeHeader(msg.Header.Get("Subject")); err == nil {
+			m.Subject = subj
+		}
+		readBody(&m, msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body)
+	}
+	s.mu.Lock()
+	s.msgs = append(s.msgs, m)
+	close(s.arrived)
+	s.arrived = make(chan struct{})
+	s.mu.Unlock()
+	s.logger.Info("Captured email", zap.String("from", from), zap.Strings("to", to), zap.String("subject", m.Subject))
+}
+
+// readBody fills Text and HTML from a single-part or multipart body.
+func readBody(m *Message, contentType, encoding string, body io.Reader) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := mr.NextRawPart()
+			if err != nil {
+				return
+			}
+			readBody(m, p.Header.Get("Content-Type"), p.Header.Get("Content-Transfer-Encoding"), p)
+		}
+	}
+	if strings.EqualFold(encoding, "quoted-printable") {
+		body = quotedprintable.NewReader(body)
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return
+	}
+	switch mediaType {
+	case "text/plain":
+		m.Text = string(b)
+	case "text/html":
+		m.HTML = string(b)
+	}
+}
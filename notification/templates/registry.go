@@ -0,0 +1,289 @@
+// Package templates loads the notification message templates from disk
+// and renders them per notification kind, channel and locale.
+//
+// Templates are laid out as
+//
+//	<dir>/<kind>/<channel>/<locale>/v<N>/<part>
+//
+// e.g. order_confirmed/email/de/v2/subject.txt. The highest version of
+// each kind, channel and locale is the one sent; older versions stay
+// available for preview until they are deleted. Each channel needs its
+// own parts: email a subject.txt, body.txt and body.html, console a
+// body.txt. Every template is parsed and rendered with sample data when
+// the registry loads, so a broken one fails startup rather than a send.
+package templates
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Parts each channel's templates consist of.
+const (
+	Subject = "subject.txt"
+	Text    = "body.txt"
+	HTML    = "body.html"
+)
+
+// channelParts lists the parts each channel needs.
+var channelParts = map[string][]string{
+	"email":   {Subject, Text, HTML},
+	"console": {Text},
+}
+
+// Data is what templates see.
+type Data struct {
+	Kind    string   `json:"kind,omitempty"` // set on digest entries
+	OrderID string   `json:"order_id"`
+	UserID  string   `json:"user_id"`
+	Items   []string `json:"items"`
+	Total   float64  `json:"total"`            // 0 when the event predates totals
+	Reason  string   `json:"reason"`           // out_of_stock only
+	Digest  []Data   `json:"digest,omitempty"` // digest only: the notifications it collapses
+}
+
+// Sample is the data used to validate templates and, by default, to
+// preview them.
+var Sample = Data{
+	OrderID: "ord_1234",
+	UserID:  "user_42",
+	Items:   []string{"foo", "bar"},
+	Total:   59.90,
+	Reason:  "insufficient stock for bar",
+	Digest: []Data{
+		{Kind: "order_confirmed", OrderID: "ord_1234", UserID: "user_42", Items: []string{"foo"}, Total: 19.90},
+		{Kind: "out_of_stock", OrderID: "ord_1235", UserID: "user_42", Items: []string{"bar"}, Reason: "insufficient stock for bar"},
+	},
+}
+
+// Message is a rendered template. Parts the channel does not use are
+// empty.
+type Message struct {
+	Kind    string `json:"kind"`
+	Channel string `json:"channel"`
+	Locale  string `json:"locale"` // the locale actually used, after fallback
+	Version int    `json:"version"`
+	Subject string `json:"subject,omitempty"`
+	Text    string `json:"text"`
+	HTML    string `json:"html,omitempty"`
+}
+
+// Info describes the versions available for one kind, channel and locale.
+type Info struct {
+	Kind     string `json:"kind"`
+	Channel  string `json:"channel"`
+	Locale   string `json:"locale"`
+	Versions []int  `json:"versions"` // ascending; the last one is sent
+}
+
+// ErrNotFound means no template matches.
+var ErrNotFound = errors.New("no such template")
+
+type key struct {
+	kind, channel, locale string
+}
+
+// set is one version's parsed parts.
+type set struct {
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+}
+
+// Registry holds every template version found on disk.
+type Registry struct {
+	sets          map[key]map[int]set
+	defaultLocale string
+}
+
+// funcs are available to every template.
+var funcs = map[string]any{
+	"money": func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) },
+	"join":  strings.Join,
+}
+
+// Load reads and validates the templates under dir. Every kind must
+// have a template in defaultLocale for each channel it has any
+// template for, so locale fallback always ends somewhere.
+func Load(dir, defaultLocale string) (*Registry, error) {
+	fsys := os.DirFS(dir)
+	r := &Registry{sets: map[key]map[int]set{}, defaultLocale: defaultLocale}
+	versions, err := fs.Glob(fsys, "*/*/*/v*")
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("no templates found in %s", dir)
+	}
+	var errs []error
+	for _, vdir := range versions {
+		parts := strings.Split(vdir, "/")
+		k := key{kind: parts[0], channel: parts[1], locale: parts[2]}
+		v, err := strconv.Atoi(strings.TrimPrefix(parts[3], "v"))
+		if err != nil || v < 1 {
+			errs = append(errs, fmt.Errorf("%s: version directories are named v1, v2, ...", vdir))
+			continue
+		}
+		s, err := parse(fsys, vdir, k.channel)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", vdir, err))
+			continue
+		}
+		if r.sets[k] == nil {
+			r.sets[k] = map[int]set{}
+		}
+		r.sets[k][v] = s
+	}
+	for k := range r.sets {
+		if _, ok := r.sets[key{k.kind, k.channel, defaultLocale}]; !ok {
+			errs = append(errs, fmt.Errorf("%s/%s: no templates in the default locale %q", k.kind, k.channel, defaultLocale))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parse reads one version directory and renders it with Sample.
+func parse(fsys fs.FS, dir, channel string) (set, error) {
+	want, ok := channelParts[channel]
+	if !ok {
+		return set{}, fmt.Errorf("unknown channel %q", channel)
+	}
+	var s set
+	for _, part := range want {
+		src, err := fs.ReadFile(fsys, path.Join(dir, part))
+		if err != nil {
+			return set{}, fmt.Errorf("missing %s", part)
+		}
+		switch part {
+		case Subject:
+			s.subject, err = texttemplate.New(part).Funcs(funcs).Option("missingkey=error").Parse(string(src))
+		case Text:
+			s.text, err = texttemplate.New(part).Funcs(funcs).Option("missingkey=error").Parse(string(src))
+		case HTML:
+			s.html, err = htmltemplate.New(part).Funcs(funcs).Option("missingkey=error").Parse(string(src))
+		}
+		if err != nil {
+			return set{}, err
+		}
+	}
+	if _, err := s.render(Sample); err != nil {
+		return set{}, err
+	}
+	return s, nil
+}
+
+func (s set) render(data Data) (Message, error) {
+	var m Message
+	var b bytes.Buffer
+	if s.subject != nil {
+		if err := s.subject.Execute(&b, data); err != nil {
+			return m, err
+		}
+		m.Subject = strings.TrimSpace(b.String())
+		b.Reset()
+	}
+	if err := s.text.Execute(&b, data); err != nil {
+		return m, err
+	}
+	m.Text = b.String()
+	b.Reset()
+	if s.html != nil {
+		if err := s.html.Execute(&b, data); err != nil {
+			return m, err
+		}
+		m.HTML = b.String()
+	}
+	return m, nil
+}
+
+// DefaultLocale is the locale every lookup falls back to.
+func (r *Registry) DefaultLocale() string {
+	return r.defaultLocale
+}
+
+// Require checks that every kind has templates for every channel.
+func (r *Registry) Require(kinds, channels []string) error {
+	var errs []error
+	for _, kind := range kinds {
+		for _, ch := range channels {
+			if _, ok := r.sets[key{kind, ch, r.defaultLocale}]; !ok {
+				errs = append(errs, fmt.Errorf("no %s templates for %s", ch, kind))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Render renders the latest version for kind and channel in locale,
+// falling back from "de-CH" to "de" and then to the default locale.
+func (r *Registry) Render(kind, channel, locale string, data Data) (Message, error) {
+	return r.RenderVersion(kind, channel, locale, 0, data)
+}
+
+// RenderVersion is Render for a given version; 0 means the latest. A
+// version is not looked up in fallback locales.
+func (r *Registry) RenderVersion(kind, channel, locale string, version int, data Data) (Message, error) {
+	for _, loc := range r.fallbacks(locale) {
+		versions, ok := r.sets[key{kind, channel, loc}]
+		if !ok {
+			continue
+		}
+		v := version
+		if v == 0 {
+			v = slices.Max(slices.Collect(maps.Keys(versions)))
+		}
+		s, ok := versions[v]
+		if !ok {
+			return Message{}, fmt.Errorf("%w: %s/%s/%s/v%d", ErrNotFound, kind, channel, loc, v)
+		}
+		m, err := s.render(data)
+		if err != nil {
+			return Message{}, fmt.Errorf("rendering %s/%s/%s/v%d: %w", kind, channel, loc, v, err)
+		}
+		m.Kind, m.Channel, m.Locale, m.Version = kind, channel, loc, v
+		return m, nil
+	}
+	return Message{}, fmt.Errorf("%w: %s/%s", ErrNotFound, kind, channel)
+}
+
+// fallbacks lists the locales to try for locale, most specific first.
+func (r *Registry) fallbacks(locale string) []string {
+	var locs []string
+	for l := locale; l != ""; {
+		locs = append(locs, l)
+		i := strings.LastIndexByte(l, '-')
+		if i < 0 {
+			break
+		}
+		l = l[:i]
+	}
+	if !slices.Contains(locs, r.defaultLocale) {
+		locs = append(locs, r.defaultLocale)
+	}
+	return locs
+}
+
+// List describes every template, sorted by kind, channel and locale.
+func (r *Registry) List() []Info {
+	out := make([]Info, 0, len(r.sets))
+	for k, versions := range r.sets {
+		out = append(out, Info{Kind: k.kind, Channel: k.channel, Locale: k.locale, Versions: slices.Sorted(maps.Keys(versions))})
+	}
+	slices.SortFunc(out, func(a, b Info) int {
+		return strings.Compare(a.Kind+"/"+a.Channel+"/"+a.Locale, b.Kind+"/"+b.Channel+"/"+b.Locale)
+	})
+	return out
+}
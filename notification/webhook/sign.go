@@ -0,0 +1,48 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers on every delivery. The signature covers the timestamp and
+// the body, so a captured request cannot be replayed later with a new
+// timestamp.
+const (
+	IDHeader        = "X-Webhook-ID"        // event ID, the same on every attempt; use it to dedupe
+	TypeHeader      = "X-Webhook-Event"     // event type
+	TimestampHeader = "X-Webhook-Timestamp" // Unix seconds when the attempt was sent
+	SignatureHeader = "X-Webhook-Signature" // "sha256=" + hex HMAC-SHA256(secret, timestamp + "." + body)
+)
+
+// Sign returns the signature header value for body sent at ts.
+func Sign(secret string, ts time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(ts.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a delivery the way a receiver should: the signature
+// must match and the timestamp must be within tolerance of now.
+func Verify(secret, timestamp, signature string, body []byte, tolerance time.Duration) error {
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("malformed timestamp")
+	}
+	ts := time.Unix(sec, 0)
+	if d := time.Since(ts); d > tolerance || d < -tolerance {
+		return errors.New("timestamp outside tolerance")
+	}
+	if !strings.HasPrefix(signature, "sha256=") ||
+		!hmac.Equal([]byte(signature), []byte(Sign(secret, ts, body))) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
@@ -0,0 +1,376 @@
+// Package webhook keeps partner webhook subscriptions and the record of
+// every delivery attempt, and signs outbound requests.
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"e-commerce/common/sqldb"
+)
+
+// Event types partners can subscribe to.
+const (
+	OrderConfirmed  = "order.confirmed"
+	OrderOutOfStock = "order.out_of_stock"
+)
+
+// EventTypes lists every event type, for validation.
+var EventTypes = []string{OrderConfirmed, OrderOutOfStock}
+
+// ErrNotFound means no subscription has the requested ID.
+var ErrNotFound = errors.New("subscription not found")
+
+var schema = []string{`
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+	id                   TEXT    PRIMARY KEY,
+	url                  TEXT    NOT NULL,
+	secret               TEXT    NOT NULL,
+	events               TEXT    NOT NULL,
+	description          TEXT    NOT NULL,
+	enabled              BOOLEAN NOT NULL,
+	consecutive_failures INTEGER NOT NULL,
+	disabled_reason      TEXT    NOT NULL,
+	created_at_ms        BIGINT  NOT NULL,
+	updated_at_ms        BIGINT  NOT NULL
+)`, `
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+	id              TEXT    PRIMARY KEY,
+	subscription_id TEXT    NOT NULL,
+	event_id        TEXT    NOT NULL,
+	event_type      TEXT    NOT NULL,
+	order_id        TEXT    NOT NULL,
+	attempt         INTEGER NOT NULL,
+	status_code     INTEGER NOT NULL,
+	error           TEXT    NOT NULL,
+	duration_ms     BIGINT  NOT NULL,
+	succeeded       BOOLEAN NOT NULL,
+	attempted_at_ms BIGINT  NOT NULL
+)`,
+	`CREATE INDEX IF NOT EXISTS webhook_deliveries_subscription ON webhook_deliveries (subscription_id, attempted_at_ms)`,
+}
+
+// Subscription is one partner endpoint.
+type Subscription struct {
+	ID                  string    `json:"id"`
+	URL                 string    `json:"url"`
+	Secret              string    `json:"secret,omitempty"` // only returned on create and rotate
+	Events              []string  `json:"events"`           // empty means every event type
+	Description         string    `json:"description"`
+	Enabled             bool      `json:"enabled"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	DisabledReason      string    `json:"disabled_reason,omitempty"`
+	CreatedAt           time.Time `json:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+// Wants reports whether the subscription receives eventType.
+func (s Subscription) Wants(eventType string) bool {
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, e := range s.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Attempt is one HTTP request to a subscriber.
+type Attempt struct {
+	ID             string        `json:"id"`
+	SubscriptionID string        `json:"subscription_id"`
+	EventID        string        `json:"event_id"`
+	EventType      string        `json:"event_type"`
+	OrderID        string        `json:"order_id"`
+	Attempt        int           `json:"attempt"`
+	StatusCode     int           `json:"status_code,omitempty"` // 0 if no response
+	Error          string        `json:"error,omitempty"`
+	Duration       time.Duration `json:"-"`
+	Succeeded      bool          `json:"succeeded"`
+	AttemptedAt    time.Time     `json:"attempted_at"`
+}
+
+// MarshalJSON reports Duration in milliseconds.
+func (a Attempt) MarshalJSON() ([]byte, error) {
+	type plain Attempt
+	return json.Marshal(struct {
+		plain
+		Duration int64 `json:"duration_ms"`
+	}{plain(a), a.Duration.Milliseconds()})
+}
+
+// Store reads and writes subscriptions and attempts.
+type Store struct {
+	db *sqldb.DB
+}
+
+// New creates the tables if needed.
+func New(ctx context.Context, db *sqldb.DB) (*Store, error) {
+	for _, stmt := range schema {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return nil, fmt.Errorf("creating webhook tables: %w", err)
+		}
+	}
+	return &Store{db: db}, nil
+}
+
+// Ping is a readiness check.
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.Ping(ctx)
+}
+
+func randomID(prefix string, n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
+
+// Create stores a new, enabled subscription with a fresh ID and secret.
+func (s *Store) Create(ctx context.Context, sub Subscription) (Subscription, error) {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	sub.ID = randomID("whs_", 8)
+	sub.Secret = randomID("whsec_", 24)
+	sub.Enabled, sub.ConsecutiveFailures, sub.DisabledReason = true, 0, ""
+	sub.CreatedAt, sub.UpdatedAt = now, now
+	if sub.Events == nil {
+		sub.Events = []string{}
+	}
+	events, _ := json.Marshal(sub.Events)
+	_, err := s.db.ExecContext(ctx, s.db.Rebind(`
+		INSERT INTO webhook_subscriptions (id, url, secret, events, description, enabled,
+			consecutive_failures, disabled_reason, created_at_ms, updated_at_ms)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		sub.ID, sub.URL, sub.Secret, string(events), sub.Description, true, 0, "", now.UnixMilli(), now.UnixMilli())
+	if err != nil {
+		return Subscription{}, fmt.Errorf("creating subscription: %w", err)
+	}
+	return sub, nil
+}
+
+const subscriptionColumns = `id, url, secret, events, description, enabled,
+	consecutive_failures, disabled_reason, created_at_ms, updated_at_ms`
+
+func scanSubscription(row interface{ Scan(...any) error }) (Subscription, error) {
+	var (
+		sub              Subscription
+		events           string
+		created, updated int64
+	)
+	if err := row.Scan(&sub.ID, &sub.URL, &sub.Secret, &events, &sub.Description, &sub.Enabled,
+		&sub.ConsecutiveFailures, &sub.DisabledReason, &created, &updated); err != nil {
+		return Subscription{}, err
+	}
+	if err := json.Unmarshal([]byte(events), &sub.Events); err != nil {
+		return Subscription{}, fmt.Errorf("decoding events of %s: %w", sub.ID, err)
+	}
+	sub.CreatedAt = time.UnixMilli(created).UTC()
+	sub.UpdatedAt = time.UnixMilli(updated).UTC()
+	return sub, nil
+}
+
+// Get returns a subscription, secret included.
+func (s *Store) Get(ctx context.Context, id string) (Subscription, error) {
+	sub, err := scanSubscription(s.db.QueryRowContext(ctx, s.db.Rebind(
+		`SELECT `+subscriptionColumns+` FROM webhook_subscriptions WHERE id = ?`), id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Subscription{}, ErrNotFound
+	}
+	return sub, err
+}
+
+// List returns every subscription, oldest first, secrets included.
+func (s *Store) List(ctx context.Context) ([]Subscription, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+subscriptionColumns+` FROM webhook_subscriptions ORDER BY created_at_ms, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	subs := []Subscription{}
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+// Active returns the enabled subscriptions that receive eventType.
+func (s *Store) Active(ctx context.Context, eventType string) ([]Subscription, error) {
+	all, err := s.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out []Subscription
+	for _, sub := range all {
+		if sub.Enabled && sub.Wants(eventType) {
+			out = append(out, sub)
+		}
+	}
+	return out, nil
+}
+
+// Update is a partial change to a subscription; nil fields are kept.
+// Enabling a subscription clears its failure count.
+type Update struct {
+	URL         *string   `json:"url"`
+	Events      *[]string `json:"events"`
+	Description *string   `json:"description"`
+	Enabled     *bool     `json:"enabled"`
+}
+
+// Update applies u and returns the result.
+func (s *Store) Update(ctx context.Context, id string, u Update) (Subscription, error) {
+	sub, err := s.Get(ctx, id)
+	if err != nil {
+		return Subscription{}, err
+	}
+	if u.URL != nil {
+		sub.URL = *u.URL
+	}
+	if u.Events != nil {
+		sub.Events = *u.Events
+	}
+	if u.Description != nil {
+		sub.Description = *u.Description
+	}
+	if u.Enabled != nil {
+		sub.Enabled = *u.Enabled
+		if sub.Enabled {
+			sub.ConsecutiveFailures, sub.DisabledReason = 0, ""
+		} else {
+			sub.DisabledReason = "disabled by operator"
+		}
+	}
+	sub.UpdatedAt = time.Now().UTC().Truncate(time.Millisecond)
+	events, _ := json.Marshal(sub.Events)
+	_, err = s.db.ExecContext(ctx, s.db.Rebind(`
+		UPDATE webhook_subscriptions SET url = ?, events = ?, description = ?, enabled = ?,
+			consecutive_failures = ?, disabled_reason = ?, updated_at_ms = ?
+		WHERE id = ?`),
+		sub.URL, string(events), sub.Description, sub.Enabled,
+		sub.ConsecutiveFailures, sub.DisabledReason, sub.UpdatedAt.UnixMilli(), id)
+	if err != nil {
+		return Subscription{}, fmt.Errorf("updating subscription %s: %w", id, err)
+	}
+	return sub, nil
+}
+
+// RotateSecret replaces the signing secret and returns the
+// subscription with the new one.
+func (s *Store) RotateSecret(ctx context.Context, id string) (Subscription, error) {
+	res, err := s.db.ExecContext(ctx, s.db.Rebind(
+		`UPDATE webhook_subscriptions SET secret = ?, updated_at_ms = ? WHERE id = ?`),
+		randomID("whsec_", 24), time.Now().UnixMilli(), id)
+	if err != nil {
+		return Subscription{}, fmt.Errorf("rotating secret of %s: %w", id, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return Subscription{}, ErrNotFound
+	}
+	return s.Get(ctx, id)
+}
+
+// Delete removes a subscription; its attempts are kept for reference.
+func (s *Store) Delete(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, s.db.Rebind(`DELETE FROM webhook_subscriptions WHERE id = ?`), id)
+	if err != nil {
+		return fmt.Errorf("deleting subscription %s: %w", id, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Delivered resets the failure count after a successful delivery.
+func (s *Store) Delivered(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, s.db.Rebind(
+		`UPDATE webhook_subscriptions SET consecutive_failures = 0 WHERE id = ? AND consecutive_failures <> 0`), id)
+	return err
+}
+
+// Failed counts a failed delivery and disables the subscription once
+// disableAfter deliveries in a row have failed. It reports whether this
+// call disabled it.
+func (s *Store) Failed(ctx context.Context, id, reason string, disableAfter int) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var failures int
+	var enabled bool
+	err = tx.QueryRowContext(ctx, s.db.Rebind(
+		`SELECT consecutive_failures, enabled FROM webhook_subscriptions WHERE id = ?`), id).Scan(&failures, &enabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil // deleted meanwhile
+	} else if err != nil {
+		return false, err
+	}
+	failures++
+	disable := enabled && failures >= disableAfter
+	if disable {
+		enabled = false
+		reason = fmt.Sprintf("disabled after %d failed deliveries; last: %s", failures, reason)
+	} else {
+		reason = ""
+	}
+	if _, err := tx.ExecContext(ctx, s.db.Rebind(`
+		UPDATE webhook_subscriptions SET consecutive_failures = ?, enabled = ?,
+			disabled_reason = CASE WHEN ? THEN ? ELSE disabled_reason END, updated_at_ms = ?
+		WHERE id = ?`),
+		failures, enabled, disable, reason, time.Now().UnixMilli(), id); err != nil {
+		return false, err
+	}
+	return disable, tx.Commit()
+}
+
+// Record stores an attempt.
+func (s *Store) Record(ctx context.Context, a Attempt) error {
+	_, err := s.db.ExecContext(ctx, s.db.Rebind(`
+		INSERT INTO webhook_deliveries (id, subscription_id, event_id, event_type, order_id, attempt,
+			status_code, error, duration_ms, succeeded, attempted_at_ms)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		randomID("whd_", 8), a.SubscriptionID, a.EventID, a.EventType, a.OrderID, a.Attempt,
+		a.StatusCode, a.Error, a.Duration.Milliseconds(), a.Succeeded, a.AttemptedAt.UnixMilli())
+	return err
+}
+
+// Attempts returns the latest attempts for a subscription, newest
+// first.
+func (s *Store) Attempts(ctx context.Context, subscriptionID string, limit int) ([]Attempt, error) {
+	rows, err := s.db.QueryContext(ctx, s.db.Rebind(`
+		SELECT id, subscription_id, event_id, event_type, order_id, attempt,
+			status_code, error, duration_ms, succeeded, attempted_at_ms
+		FROM webhook_deliveries WHERE subscription_id = ?
+		ORDER BY attempted_at_ms DESC, attempt DESC LIMIT ?`), subscriptionID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Attempt{}
+	for rows.Next() {
+		var a Attempt
+		var dur, at int64
+		if err := rows.Scan(&a.ID, &a.SubscriptionID, &a.EventID, &a.EventType, &a.OrderID, &a.Attempt,
+			&a.StatusCode, &a.Error, &dur, &a.Succeeded, &at); err != nil {
+			return nil, err
+		}
+		a.Duration = time.Duration(dur) * time.Millisecond
+		a.AttemptedAt = time.UnixMilli(at).UTC()
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
@@ -3,6 +3,7 @@
 package handler
 
 import (
+	"e-commerce/common/logger"
 	"e-commerce/common/models"
 	"e-commerce/order/producer"
 	"net/http"
@@ -28,27 +29,30 @@ func NewOrderHandler(p *producer.KafkaProducer, log *zap.Logger) *OrderHandler {
 // CreateOrder handles POST /orders.
 func (h *OrderHandler) CreateOrder(c *gin.Context) {
 	var req models.OrderCreated
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx, h.Logger)
+	reqID := logger.RequestIDFromContext(ctx)
 
 	// 1) Bind and validate JSON payload.
 	if err := c.ShouldBindJSON(&req); err != nil {
-		h.Logger.Warn("Invalid JSON payload", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON payload"})
+		log.Warn("Invalid JSON payload", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON payload", "request_id": reqID})
 		return
 	}
 	if req.UserID == "" || len(req.Items) == 0 || req.Total <= 0 {
-		h.Logger.Warn("Validation failed on payload", zap.Any("payload", req))
-		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id, items and total are required"})
+		log.Warn("Validation failed on payload", zap.Any("payload", req))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id, items and total are required", "request_id": reqID})
 		return
 	}
 
 	// 2) Publish to Kafka.
-	if err := h.Producer.Publish(req); err != nil {
-		h.Logger.Error("Failed to publish event", zap.Error(err), zap.String("orderID", req.OrderID))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to publish event"})
+	if err := h.Producer.Publish(ctx, req); err != nil {
+		log.Error("Failed to publish event", zap.Error(err), zap.String("orderID", req.OrderID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to publish event", "request_id": reqID})
 		return
 	}
 
 	// 3) Success.
-	h.Logger.Info("Order received", zap.String("orderID", req.OrderID), zap.String("userID", req.UserID))
-	c.JSON(http.StatusAccepted, gin.H{"status": "order received", "order_id": req.OrderID})
+	log.Info("Order received", zap.String("orderID", req.OrderID), zap.String("userID", req.UserID))
+	c.JSON(http.StatusAccepted, gin.H{"status": "order received", "order_id": req.OrderID, "request_id": reqID})
 }
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"e-commerce/common/config"
+	"e-commerce/common/logger"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// RateLimiter caps the request rate of the routes it wraps with a
+// single token bucket. Its limit can be changed while serving.
+type RateLimiter struct {
+	limiter *rate.Limiter
+	enabled atomic.Bool
+}
+
+// NewRateLimiter creates a limiter; RPS 0 means unlimited.
+func NewRateLimiter(cfg config.RateLimit) *RateLimiter {
+	rl := &RateLimiter{limiter: rate.NewLimiter(rate.Inf, 0)}
+	rl.SetLimit(cfg)
+	return rl
+}
+
+// SetLimit applies a new limit to subsequent requests.
+func (rl *RateLimiter) SetLimit(cfg config.RateLimit) {
+	if cfg.RPS <= 0 {
+		rl.enabled.Store(false)
+		return
+	}
+	rl.limiter.SetLimit(rate.Limit(cfg.RPS))
+	rl.limiter.SetBurst(cfg.Burst)
+	rl.enabled.Store(true)
+}
+
+// Middleware rejects requests over the limit with 429.
+func (rl *RateLimiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if rl.enabled.Load() && !rl.limiter.Allow() {
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error":      "rate limit exceeded",
+				"request_id": logger.RequestIDFromContext(c.Request.Context()),
+			})
+			return
+		}
+		c.Next()
+	}
+}
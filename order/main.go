@@ -3,13 +3,14 @@ package main
 import (
 	"context"
 	"net/http"
-	"os"
-	"os/signal"
-	"syscall"
-	"time"
 
 	"e-commerce/common/config"
+	"e-commerce/common/health"
+	"e-commerce/common/kafkaclient"
+	"e-commerce/common/lifecycle"
 	"e-commerce/common/logger"
+	"e-commerce/common/metrics"
+	"e-commerce/common/tracing"
 	"e-commerce/order/handler"
 	"e-commerce/order/producer"
 
@@ -18,54 +19,77 @@ import (
 )
 
 func main() {
-	// 1. Load config + logger
-	cfg, err := config.Load()
-	if err != nil {
-		panic("failed to load config: " + err.Error())
-	}
-	log, err := logger.NewLogger(cfg.Env, cfg.LogLevel)
+	// 1. Load config (exits on invalid config or --print-config) + logger
+	cfg := config.MustLoad()
+	log, level, err := logger.NewLeveled(cfg.Env, cfg.LogLevel)
 	if err != nil {
 		panic("failed to initialize logger: " + err.Error())
 	}
 	defer log.Sync()
 	log.Info("Starting Order Service", zap.String("env", cfg.Env))
 
-	// 2. Prepare Gin with zap middleware
+	// 1b. Tracing: spans flow HTTP → Kafka headers → consumers
+	shutdownTracing, err := tracing.Setup(context.Background(), "order", cfg.Trace)
+	if err != nil {
+		log.Fatal("tracing init failed", zap.Error(err))
+	}
+
+	// 1c. Kafka connection settings (TLS/SASL) shared by every client
+	kconn, err := kafkaclient.New(cfg.Kafka)
+	if err != nil {
+		log.Fatal("kafka client config failed", zap.Error(err))
+	}
+
+	// 2. Prepare Gin with tracing, request ID and zap middleware
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.New()
-	router.Use(logger.GinZapMiddleware(log), gin.Recovery())
+	router.Use(
+		tracing.GinMiddleware("order"),
+		logger.RequestIDMiddleware(log),
+		logger.GinZapMiddleware(log),
+		gin.Recovery(),
+	)
 
 	// 3. Kafka producer with retry & idempotency
-	kp := producer.NewKafkaProducer(cfg.KafkaBrokers, "orders.created", log)
-	defer kp.Close()
+	kp := producer.NewKafkaProducer(kconn, cfg.Topics.OrdersCreated, cfg.Order.Publish, log)
+	kp.SetDedupe(cfg.Features.OrderDedupe)
 
-	// 4. Register handler
+	// 4. Register handler behind the rate limiter
 	h := handler.NewOrderHandler(kp, log)
-	router.POST("/orders", h.CreateOrder)
+	rl := handler.NewRateLimiter(cfg.Order.RateLimit)
+	router.POST("/orders", rl.Middleware(), h.CreateOrder)
+
+	// 4b. Apply log level, retry, rate limit and feature changes live
+	rt := config.NewRuntime(cfg, log)
+	logger.WatchLevel(rt, log, level)
+	config.OnChange(rt, func(c *config.Config) config.Retry { return c.Order.Publish }, kp.SetRetry)
+	config.OnChange(rt, func(c *config.Config) config.RateLimit { return c.Order.RateLimit }, rl.SetLimit)
+	config.OnChange(rt, func(c *config.Config) bool { return c.Features.OrderDedupe }, kp.SetDedupe)
+	rt.Watch()
 
-	// 5. HTTP server with graceful shutdown
+	// 5. Health probes and metrics
+	hc := health.NewHandler(log)
+	hc.AddReadiness("kafka", health.KafkaBrokers(kconn))
+	router.GET("/healthz", gin.WrapH(hc.Liveness()))
+	router.GET("/readyz", gin.WrapH(hc.Readiness()))
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
+
+	// 6. HTTP server; registered after the producer so in-flight requests
+	//    finish publishing before the producer is flushed.
 	srv := &http.Server{
-		Addr:    ":8090",
+		Addr:    cfg.Order.ListenAddr,
 		Handler: router,
 	}
-	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatal("Server listen failed", zap.Error(err))
-		}
-	}()
-	log.Info("HTTP server started on :8090")
-
-	// 6. Wait for SIGINT/SIGTERM
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-	log.Info("Shutdown signal received, shutting down...")
+	lc := lifecycle.New(log, cfg.ShutdownTimeout)
+	lc.Append(lifecycle.Hook{Name: "tracing", OnStop: shutdownTracing})
+	lc.Closer("producer", kp.Close)
+	lc.HTTPServer("http", srv)
+	lc.Append(lifecycle.Hook{Name: "readiness", OnStop: hc.Drain})
 
-	// 7. Shutdown with 5s timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Error("Server forced to shutdown", zap.Error(err))
+	// 7. Run until SIGINT/SIGTERM, then shut down in order
+	if err := lc.Run(); err != nil {
+		log.Error("Shutdown completed with errors", zap.Error(err))
+		return
 	}
 	log.Info("Order Service exited cleanly")
 }
@@ -5,9 +5,16 @@ import (
 	"encoding/json"
 	"errors"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"e-commerce/common/config"
+	"e-commerce/common/dedupe"
+	"e-commerce/common/kafkaclient"
+	"e-commerce/common/logger"
+	"e-commerce/common/metrics"
 	"e-commerce/common/models"
+	"e-commerce/common/tracing"
 
 	"github.com/segmentio/kafka-go"
 	"go.uber.org/zap"
@@ -18,24 +25,51 @@ type KafkaProducer struct {
 	writer   *kafka.Writer
 	logger   *zap.Logger
 	seenKeys sync.Map // for deduping OrderID
+
+	retry  atomic.Pointer[config.Retry] // swapped on config reload
+	dedupe atomic.Bool                  // features.order_dedupe
 }
 
+var tracer = tracing.Tracer("e-commerce/order/producer")
+
 // NewKafkaProducer constructs a producer with backoff retry.
-func NewKafkaProducer(brokers []string, topic string, log *zap.Logger) *KafkaProducer {
+func NewKafkaProducer(conn *kafkaclient.Conn, topic string, retry config.Retry, log *zap.Logger) *KafkaProducer {
 	w := kafka.NewWriter(kafka.WriterConfig{
-		Brokers:  brokers,
+		Brokers:  conn.Brokers,
 		Topic:    topic,
+		Dialer:   conn.Dialer(""),
 		Balancer: &kafka.Hash{},
 	})
-	return &KafkaProducer{writer: w, logger: log}
+	kp := &KafkaProducer{writer: w, logger: log}
+	kp.SetRetry(retry)
+	kp.SetDedupe(true)
+	return kp
+}
+
+// SetRetry replaces the retry policy for subsequent publishes.
+func (kp *KafkaProducer) SetRetry(r config.Retry) {
+	kp.retry.Store(&r)
+}
+
+// SetDedupe turns OrderID deduplication on or off.
+func (kp *KafkaProducer) SetDedupe(on bool) {
+	kp.dedupe.Store(on)
 }
 
 // Publish sends an OrderCreated event, retrying transient errors.
 // It also dedupes on OrderID: only first publish is allowed.
-func (kp *KafkaProducer) Publish(evt models.OrderCreated) error {
+// The trace context of ctx is propagated in the message headers.
+func (kp *KafkaProducer) Publish(ctx context.Context, evt models.OrderCreated) (err error) {
+	ctx, span := tracing.StartPublish(ctx, tracer, kp.writer.Topic, evt.OrderID)
+	defer func() { tracing.End(span, err) }()
+	log := logger.WithContext(ctx, kp.logger)
+
 	// Idempotency: skip if already seen
-	if _, loaded := kp.seenKeys.LoadOrStore(evt.OrderID, true); loaded {
-		kp.logger.Warn("Duplicate OrderID, skipping publish", zap.String("orderID", evt.OrderID))
+	if !kp.dedupe.Load() {
+		kp.seenKeys.Store(evt.OrderID, true)
+	} else if _, loaded := kp.seenKeys.LoadOrStore(evt.OrderID, true); loaded {
+		log.Warn("Duplicate OrderID, skipping publish", zap.String("orderID", evt.OrderID))
+		metrics.DedupeHits.WithLabelValues("order-producer").Inc()
 		return nil
 	}
 
@@ -43,20 +77,31 @@ func (kp *KafkaProducer) Publish(evt models.OrderCreated) error {
 	if err != nil {
 		return err
 	}
-	msg := kafka.Message{Key: []byte(evt.OrderID), Value: data}
+	msg := kafka.Message{Key: []byte(evt.OrderID), Value: data, Headers: []kafka.Header{
+		{Key: dedupe.EventIDHeader, Value: []byte(dedupe.EventID(models.TypeOrderCreated, evt.OrderID, 1))},
+	}}
+	tracing.InjectKafka(ctx, &msg)
 
 	// Retry with exponential backoff
-	backoff := 100 * time.Millisecond
-	for i := 0; i < 5; i++ {
+	retry := kp.retry.Load()
+	backoff := retry.Backoff
+	for i := 0; i < retry.MaxAttempts; i++ {
+		metrics.PublishAttempts.WithLabelValues(kp.writer.Topic).Inc()
 		err = kp.writer.WriteMessages(context.Background(), msg)
 		if err == nil {
-			kp.logger.Info("Published order event", zap.String("orderID", evt.OrderID))
+			log.Info("Published order event", zap.String("orderID", evt.OrderID))
 			return nil
 		}
-		kp.logger.Warn("Publish failed, retrying", zap.Error(err), zap.Int("attempt", i+1))
+		if i == retry.MaxAttempts-1 {
+			log.Warn("Publish failed", zap.Error(err), zap.Int("attempt", i+1))
+			break
+		}
+		log.Warn("Publish failed, retrying", zap.Error(err), zap.Int("attempt", i+1))
+		metrics.PublishRetries.WithLabelValues(kp.writer.Topic).Inc()
 		time.Sleep(backoff)
 		backoff *= 2
 	}
+	metrics.PublishFailures.WithLabelValues(kp.writer.Topic).Inc()
 	return errors.New("failed to publish after retries: " + err.Error())
 }
 
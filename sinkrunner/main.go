@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"e-commerce/common/codec"
+	"e-commerce/common/config"
+	"e-commerce/common/exactlyonce"
+	"e-commerce/common/health"
+	"e-commerce/common/kafkaclient"
+	"e-commerce/common/lifecycle"
+	"e-commerce/common/logger"
+	"e-commerce/common/metrics"
+	"e-commerce/sinkrunner/sink"
+
+	"go.uber.org/zap"
+)
+
+func main() {
+	// 1. Load config + logger
+	cfg := config.MustLoad()
+	log, level, err := logger.NewLeveled(cfg.Env, cfg.LogLevel)
+	if err != nil {
+		panic("failed to init logger: " + err.Error())
+	}
+	defer log.Sync()
+	log.Info("Starting Sink Runner", zap.String("env", cfg.Env), zap.String("manifest", cfg.SinkRunner.Manifest))
+
+	rt := config.NewRuntime(cfg, log)
+	logger.WatchLevel(rt, log, level)
+	rt.Watch()
+
+	// 1b. Kafka connection settings (TLS/SASL) shared by every client
+	kconn, err := kafkaclient.New(cfg.Kafka)
+	if err != nil {
+		log.Fatal("kafka client config failed", zap.Error(err))
+	}
+	clientID := config.ClientID(cfg.SinkRunner.ClientID)
+
+	// 2. Sinks from the manifest, each connected to its target
+	manifest, err := sink.Load(cfg.SinkRunner.Manifest)
+	if err != nil {
+		log.Fatal("sink manifest invalid", zap.Error(err))
+	}
+	ctx := context.Background()
+	registry := codec.NewRegistry(cfg.SchemaRegistry)
+	sinks := make([]*sink.Sink, 0, len(manifest.Sinks))
+	for _, spec := range manifest.Sinks {
+		s, err := sink.Open(ctx, spec, registry, log)
+		if err != nil {
+			log.Fatal("sink init failed", zap.String("sink", spec.Name), zap.Error(err))
+		}
+		sinks = append(sinks, s)
+		log.Info("Sink ready", zap.String("sink", spec.Name), zap.String("target", spec.Target.Type),
+			zap.Strings("topics", spec.Topics), zap.String("group", spec.GroupID))
+	}
+
+	// 3. One exactly-once consumer per sink, in its own consumer group
+	hc := health.NewHandler(log)
+	hc.AddReadiness("kafka", health.KafkaBrokers(kconn))
+	consumers := make([]*exactlyonce.Consumer, len(sinks))
+	for i, s := range sinks {
+		consumers[i] = exactlyonce.New(kconn, s.Store, s.Spec.GroupID, clientID, s.Spec.Topics,
+			s.Spec.Batch.Size, s.Spec.Batch.FlushInterval, log.With(zap.String("sink", s.Spec.Name)))
+		hc.AddLiveness("sink:"+s.Spec.Name, consumers[i].Watchdog().Check(cfg.SinkRunner.StuckAfter))
+		hc.AddReadiness("sink:"+s.Spec.Name, health.Ping(s))
+	}
+
+	// 4. Health and metrics on the admin port
+	mux := http.NewServeMux()
+	hc.Register(mux)
+	metrics.Register(mux)
+
+	// 5. Register components with the lifecycle manager
+	lc := lifecycle.New(log, cfg.ShutdownTimeout)
+	lc.HTTPServer("admin", &http.Server{Addr: cfg.SinkRunner.AdminAddr, Handler: mux})
+	for i, s := range sinks {
+		lc.Closer("sink:"+s.Spec.Name, s.Close)
+		lc.Go("consumer:"+s.Spec.Name, consumers[i].Run, consumers[i].Close)
+	}
+	lc.Append(lifecycle.Hook{Name: "readiness", OnStop: hc.Drain})
+
+	// 6. Run until SIGINT/SIGTERM; every sink stores its batch in progress first
+	if err := lc.Run(); err != nil {
+		log.Error("Shutdown completed with errors", zap.Error(err))
+		return
+	}
+	log.Info("Sink Runner shut down cleanly")
+}
@@ -0,0 +1,275 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"e-commerce/common/exactlyonce"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const stateFile = "offsets.json"
+
+// jsonlState is what offsets.json holds: the committed length of every
+// data file, and the next offset per group and partition. Bytes past a
+// file's committed length belong to a batch whose state was never
+// saved and are cut off on start.
+type jsonlState struct {
+	Files   map[string]int64            `json:"files"`
+	Offsets map[string]map[string]int64 `json:"offsets"` // group -> "topic/partition" -> next offset
+}
+
+// jsonl is an exactlyonce.Store appending to one <topic>-<partition>.jsonl
+// file per partition under dir. A batch is appended and synced first;
+// saving the state file with rename is the commit. The fence is checked
+// against the state in memory, so a directory must be written by a
+// single sink runner.
+type jsonl struct {
+	dir  string
+	sink *Sink
+
+	mu    sync.Mutex
+	state jsonlState
+}
+
+func newJSONL(dir string, s *Sink) *jsonl {
+	return &jsonl{dir: dir, sink: s}
+}
+
+// envelope is the record written when a sink has no columns.
+type envelope struct {
+	Topic     string            `json:"topic"`
+	Partition int               `json:"partition"`
+	Offset    int64             `json:"offset"`
+	Key       string            `json:"key"`
+	Timestamp time.Time         `json:"timestamp"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Value     any               `json:"value"`
+}
+
+// Init loads the state and truncates every data file to its committed
+// length.
+func (j *jsonl) Init(ctx context.Context) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := os.MkdirAll(j.dir, 0o755); err != nil {
+		return err
+	}
+	j.state = jsonlState{Files: map[string]int64{}, Offsets: map[string]map[string]int64{}}
+	b, err := os.ReadFile(filepath.Join(j.dir, stateFile))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		if err := json.Unmarshal(b, &j.state); err != nil {
+			return fmt.Errorf("reading %s: %w", stateFile, err)
+		}
+		if j.state.Files == nil {
+			j.state.Files = map[string]int64{}
+		}
+		if j.state.Offsets == nil {
+			j.state.Offsets = map[string]map[string]int64{}
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(j.dir, "*.jsonl"))
+	if err != nil {
+		return err
+	}
+	for _, path := range files {
+		size := j.state.Files[filepath.Base(path)]
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if fi.Size() > size {
+			if err := os.Truncate(path, size); err != nil {
+				return fmt.Errorf("recovering %s: %w", path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Offsets returns the committed offsets of topic.
+func (j *jsonl) Offsets(ctx context.Context, group, topic string) (map[int]int64, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	out := map[int]int64{}
+	for key, off := range j.state.Offsets[group] {
+		t, p, ok := splitPartitionKey(key)
+		if ok && t == topic {
+			out[p] = off
+		}
+	}
+	return out, nil
+}
+
+// Write appends batch and commits its offsets.
+func (j *jsonl) Write(ctx context.Context, group string, batch []kafka.Message, ranges []exactlyonce.Range) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	stored := j.state.Offsets[group]
+	for _, r := range ranges {
+		cur, ok := stored[partitionKey(r.Topic, r.Partition)]
+		if (r.From < 0 && ok) || (r.From >= 0 && (!ok || cur != r.From)) {
+			return exactlyonce.Fenced(r.Topic, r.Partition)
+		}
+	}
+
+	bufs := map[string]*bytes.Buffer{}
+	n := 0
+	for _, m := range batch {
+		rec, ok, err := j.record(ctx, m)
+		if err != nil {
+			return err
+		} else if !ok {
+			continue
+		}
+		line, err := json.Marshal(rec)
+		if err != nil {
+			if err := j.sink.bad(m, err); err != nil {
+				return err
+			}
+			continue
+		}
+		name := fmt.Sprintf("%s-%d.jsonl", m.Topic, m.Partition)
+		if bufs[name] == nil {
+			bufs[name] = &bytes.Buffer{}
+		}
+		bufs[name].Write(append(line, '\n'))
+		n++
+	}
+
+	next := jsonlState{Files: maps.Clone(j.state.Files), Offsets: map[string]map[string]int64{}}
+	for g, offs := range j.state.Offsets {
+		next.Offsets[g] = maps.Clone(offs)
+	}
+	if next.Offsets[group] == nil {
+		next.Offsets[group] = map[string]int64{}
+	}
+	for _, r := range ranges {
+		next.Offsets[group][partitionKey(r.Topic, r.Partition)] = r.To
+	}
+
+	var appended []string
+	undo := func() {
+		for _, name := range appended {
+			os.Truncate(filepath.Join(j.dir, name), j.state.Files[name])
+		}
+	}
+	for name, buf := range bufs {
+		appended = append(appended, name)
+		if err := appendSync(filepath.Join(j.dir, name), buf.Bytes()); err != nil {
+			undo()
+			return err
+		}
+		next.Files[name] += int64(buf.Len())
+	}
+	if err := j.save(next); err != nil {
+		undo()
+		return err
+	}
+	j.state = next
+	j.sink.written(n)
+	return nil
+}
+
+func (j *jsonl) record(ctx context.Context, m kafka.Message) (any, bool, error) {
+	payload, ok, err := j.sink.decode(ctx, m)
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+	if len(j.sink.Spec.Columns) == 0 {
+		env := envelope{Topic: m.Topic, Partition: m.Partition, Offset: m.Offset,
+			Key: string(m.Key), Timestamp: m.Time, Value: payload}
+		if len(m.Headers) > 0 {
+			env.Headers = make(map[string]string, len(m.Headers))
+			for _, h := range m.Headers {
+				env.Headers[h.Key] = string(h.Value)
+			}
+		}
+		return env, true, nil
+	}
+	vals, ok, err := j.sink.mapRow(m, payload)
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+	rec := make(map[string]any, len(vals))
+	for i, c := range j.sink.Spec.Columns {
+		rec[c.Name] = vals[i]
+	}
+	return rec, true, nil
+}
+
+// save writes the state to a temporary file and renames it into place.
+func (j *jsonl) save(st jsonlState) error {
+	b, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(j.dir, stateFile+".tmp")
+	if err := writeSync(tmp, b); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(j.dir, stateFile))
+}
+
+func appendSync(path string, b []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeSync(path string, b []byte) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func partitionKey(topic string, partition int) string {
+	return topic + "/" + strconv.Itoa(partition)
+}
+
+func splitPartitionKey(key string) (string, int, bool) {
+	i := strings.LastIndexByte(key, '/')
+	if i < 0 {
+		return "", 0, false
+	}
+	p, err := strconv.Atoi(key[i+1:])
+	return key[:i], p, err == nil
+}
@@ -0,0 +1,147 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"e-commerce/common/exactlyonce"
+
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+// openJSONL opens a jsonl sink on dir, as the sink runner does on start.
+func openJSONL(t *testing.T, dir string) *jsonl {
+	t.Helper()
+	s, err := Open(context.Background(), Spec{
+		Name: "test", Decoder: "json", OnError: "skip",
+		Target: Target{Type: "jsonl", Path: dir},
+	}, nil, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if err := s.Store.Init(context.Background()); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	return s.Store.(*jsonl)
+}
+
+func messages(from int64, values ...string) []kafka.Message {
+	msgs := make([]kafka.Message, len(values))
+	for i, v := range values {
+		msgs[i] = kafka.Message{Topic: "orders", Partition: 0, Offset: from + int64(i), Value: []byte(v)}
+	}
+	return msgs
+}
+
+func span(from, to int64) []exactlyonce.Range {
+	return []exactlyonce.Range{{Topic: "orders", Partition: 0, From: from, To: to}}
+}
+
+func readData(t *testing.T, dir string) []byte {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join(dir, "orders-0.jsonl"))
+	if err != nil {
+		t.Fatalf("reading data file: %v", err)
+	}
+	return b
+}
+
+func wantOffsets(t *testing.T, j *jsonl, want map[int]int64) {
+	t.Helper()
+	got, err := j.Offsets(context.Background(), "g", "orders")
+	if err != nil {
+		t.Fatalf("Offsets: %v", err)
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("offsets = %v, want %v", got, want)
+	}
+}
+
+func TestJSONLInitCutsUncommittedBytes(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	j := openJSONL(t, dir)
+	if err := j.Write(ctx, "g", messages(0, `{"id":1}`, `{"id":2}`), span(-1, 2)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	committed := readData(t, dir)
+	if n := bytes.Count(committed, []byte("\n")); n != 2 {
+		t.Fatalf("data file has %d lines, want 2", n)
+	}
+
+	// A crash after appending a batch but before saving the state
+	f, err := os.OpenFile(filepath.Join(dir, "orders-0.jsonl"), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"topic":"orders","offset":2,"val`)
+	f.Close()
+
+	j = openJSONL(t, dir)
+	if got := readData(t, dir); !bytes.Equal(got, committed) {
+		t.Errorf("after recovery the data file is\n%s\nwant\n%s", got, committed)
+	}
+	wantOffsets(t, j, map[int]int64{0: 2})
+	if err := j.Write(ctx, "g", messages(2, `{"id":3}`), span(2, 3)); err != nil {
+		t.Fatalf("Write after recovery: %v", err)
+	}
+	if n := bytes.Count(readData(t, dir), []byte("\n")); n != 3 {
+		t.Errorf("data file has %d lines, want 3", n)
+	}
+}
+
+func TestJSONLWriteFencesStaleOffsets(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	j := openJSONL(t, dir)
+	if err := j.Write(ctx, "g", messages(0, `{"id":1}`), span(-1, 1)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	committed := readData(t, dir)
+	for _, from := range []int64{-1, 0, 2} {
+		err := j.Write(ctx, "g", messages(1, `{"id":2}`), span(from, 2))
+		if !errors.Is(err, exactlyonce.ErrFenced) {
+			t.Errorf("Write from %d = %v, want ErrFenced", from, err)
+		}
+	}
+	if got := readData(t, dir); !bytes.Equal(got, committed) {
+		t.Errorf("fenced writes changed the data file:\n%s", got)
+	}
+	wantOffsets(t, j, map[int]int64{0: 1})
+}
+
+func TestJSONLWriteUndoesAppendWhenStateIsNotSaved(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	j := openJSONL(t, dir)
+	if err := j.Write(ctx, "g", messages(0, `{"id":1}`), span(-1, 1)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	committed := readData(t, dir)
+
+	// A directory where the state's temporary file goes fails the save
+	blocker := filepath.Join(dir, stateFile+".tmp")
+	if err := os.Mkdir(blocker, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Write(ctx, "g", messages(1, `{"id":2}`), span(1, 2)); err == nil {
+		t.Fatal("Write succeeded without saving its state")
+	}
+	if got := readData(t, dir); !bytes.Equal(got, committed) {
+		t.Errorf("failed write left data behind:\n%s", got)
+	}
+	wantOffsets(t, j, map[int]int64{0: 1})
+
+	// The batch is retried from the same offset once the state can be saved
+	os.Remove(blocker)
+	if err := j.Write(ctx, "g", messages(1, `{"id":2}`), span(1, 2)); err != nil {
+		t.Fatalf("retried Write: %v", err)
+	}
+	wantOffsets(t, j, map[int]int64{0: 2})
+}
@@ -0,0 +1,201 @@
+// Package sink lands Kafka topics in tables or files, as declared in a
+// YAML manifest. Every sink stores its consumed offsets atomically with
+// the data it writes, so restarts and rebalances neither lose nor
+// duplicate rows.
+package sink
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"time"
+
+	"e-commerce/common/codec"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Manifest lists the sinks to run.
+type Manifest struct {
+	Sinks []Spec `yaml:"sinks"`
+}
+
+// Spec declares one sink: where it reads, how it decodes and maps each
+// message, and where it writes.
+type Spec struct {
+	Name    string   `yaml:"name"`
+	Topics  []string `yaml:"topics"`
+	GroupID string   `yaml:"group_id"` // default "sink-<name>"
+	Decoder string   `yaml:"decoder"`  // "json" (default), "avro" or "auto"
+	OnError string   `yaml:"on_error"` // undecodable or unmappable messages: "skip" (default) or "fail"
+	Mode    string   `yaml:"mode"`     // "insert" (default) or "upsert"
+	Key     []string `yaml:"key"`      // upsert conflict columns
+	Batch   Batch    `yaml:"batch"`
+	Target  Target   `yaml:"target"`
+	Columns []Column `yaml:"columns"` // optional for jsonl
+}
+
+// Batch bounds each write; zero values take the defaults.
+type Batch struct {
+	Size          int           `yaml:"size"`           // default 500
+	FlushInterval time.Duration `yaml:"flush_interval"` // default 2s
+}
+
+// Target is where rows go.
+type Target struct {
+	Type   string `yaml:"type"`   // "sqlite", "postgres" or "jsonl"
+	DSN    string `yaml:"dsn"`    // sqlite file or postgres URL; ${VAR} is expanded
+	Table  string `yaml:"table"`  // sqlite and postgres
+	Create bool   `yaml:"create"` // create the table from columns if missing
+	Path   string `yaml:"path"`   // jsonl directory
+}
+
+// Column maps one field of the decoded message to a column. Field is a
+// dot-separated path into the payload, or one of the message fields
+// $topic, $partition, $offset, $key, $timestamp and $header.<name>.
+type Column struct {
+	Name  string `yaml:"name"`
+	Field string `yaml:"field"`
+	Type  string `yaml:"type"` // text, integer, real, boolean, json or timestamp
+}
+
+// Column types.
+var columnTypes = []string{"text", "integer", "real", "boolean", "json", "timestamp"}
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Load reads, defaults and validates a manifest file.
+func Load(path string) (*Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening sink manifest: %w", err)
+	}
+	defer f.Close()
+
+	var m Manifest
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(&m); err != nil {
+		return nil, fmt.Errorf("decoding sink manifest %s: %w", path, err)
+	}
+	for i := range m.Sinks {
+		m.Sinks[i].defaults()
+	}
+	return &m, m.Validate()
+}
+
+func (s *Spec) defaults() {
+	if s.GroupID == "" {
+		s.GroupID = "sink-" + s.Name
+	}
+	if s.Decoder == "" {
+		s.Decoder = codec.FormatJSON
+	}
+	if s.OnError == "" {
+		s.OnError = "skip"
+	}
+	if s.Mode == "" {
+		s.Mode = "insert"
+	}
+	if s.Batch.Size == 0 {
+		s.Batch.Size = 500
+	}
+	if s.Batch.FlushInterval == 0 {
+		s.Batch.FlushInterval = 2 * time.Second
+	}
+	s.Target.DSN = os.ExpandEnv(s.Target.DSN)
+}
+
+// Validate reports every problem in the manifest at once.
+func (m *Manifest) Validate() error {
+	var errs []error
+	add := func(at, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: "+format, append([]any{at}, args...)...))
+	}
+	if len(m.Sinks) == 0 {
+		return errors.New("sink manifest lists no sinks")
+	}
+	seen := map[string]bool{}
+	for i, s := range m.Sinks {
+		at := fmt.Sprintf("sinks[%d]", i)
+		if s.Name != "" {
+			at = s.Name
+		}
+		switch {
+		case s.Name == "":
+			add(at, "name is required")
+		case seen[s.Name]:
+			add(at, "listed more than once")
+		}
+		seen[s.Name] = true
+		if len(s.Topics) == 0 {
+			add(at, "topics must list at least one topic")
+		}
+		if !slices.Contains([]string{codec.FormatJSON, codec.FormatAvro, codec.FormatAuto}, s.Decoder) {
+			add(at, "decoder must be json, avro or auto, got %q", s.Decoder)
+		}
+		if s.OnError != "skip" && s.OnError != "fail" {
+			add(at, "on_error must be skip or fail, got %q", s.OnError)
+		}
+		if s.Batch.Size < 1 || s.Batch.FlushInterval < 0 {
+			add(at, "batch size and flush_interval must be positive")
+		}
+
+		names := map[string]bool{}
+		for j, c := range s.Columns {
+			if !identifier.MatchString(c.Name) {
+				add(at, "columns[%d]: name must be a plain identifier, got %q", j, c.Name)
+			}
+			if names[c.Name] {
+				add(at, "columns[%d]: %s is listed more than once", j, c.Name)
+			}
+			names[c.Name] = true
+			if c.Field == "" {
+				add(at, "columns[%d]: field is required", j)
+			}
+			if !slices.Contains(columnTypes, c.Type) {
+				add(at, "columns[%d]: type must be one of %v, got %q", j, columnTypes, c.Type)
+			}
+		}
+
+		switch s.Target.Type {
+		case "sqlite", "postgres":
+			if s.Target.DSN == "" {
+				add(at, "target.dsn is required for %s", s.Target.Type)
+			}
+			if !identifier.MatchString(s.Target.Table) {
+				add(at, "target.table must be a plain identifier, got %q", s.Target.Table)
+			}
+			if len(s.Columns) == 0 {
+				add(at, "columns are required for a %s target", s.Target.Type)
+			}
+		case "jsonl":
+			if s.Target.Path == "" {
+				add(at, "target.path is required for jsonl")
+			}
+			if s.Mode != "insert" {
+				add(at, "jsonl targets only support mode insert")
+			}
+		default:
+			add(at, "target.type must be sqlite, postgres or jsonl, got %q", s.Target.Type)
+		}
+
+		switch s.Mode {
+		case "insert":
+		case "upsert":
+			if len(s.Key) == 0 {
+				add(at, "key is required for mode upsert")
+			}
+			for _, k := range s.Key {
+				if !names[k] {
+					add(at, "key column %q is not in columns", k)
+				}
+			}
+		default:
+			add(at, "mode must be insert or upsert, got %q", s.Mode)
+		}
+	}
+	return errors.Join(errs...)
+}
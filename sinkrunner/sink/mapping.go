@@ -0,0 +1,148 @@
+package sink
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// field returns the value a column's Field names: a message field, or a
+// path into the decoded payload. A missing path is nil (NULL).
+func field(m kafka.Message, payload any, path string) any {
+	switch path {
+	case "$topic":
+		return m.Topic
+	case "$partition":
+		return int64(m.Partition)
+	case "$offset":
+		return m.Offset
+	case "$key":
+		return string(m.Key)
+	case "$timestamp":
+		return m.Time
+	}
+	if name, ok := strings.CutPrefix(path, "$header."); ok {
+		for _, h := range m.Headers {
+			if h.Key == name {
+				return string(h.Value)
+			}
+		}
+		return nil
+	}
+
+	v := payload
+	for _, part := range strings.Split(path, ".") {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = obj[part]
+	}
+	return v
+}
+
+// convert coerces v, a JSON- or Avro-decoded value, to a column type.
+// Timestamps become time.Time; the SQL target formats them for SQLite.
+func convert(v any, typ string) (any, error) {
+	switch x := v.(type) {
+	case nil:
+		return nil, nil
+	case int:
+		v = int64(x)
+	case int32:
+		v = int64(x)
+	case float32:
+		v = float64(x)
+	}
+	switch typ {
+	case "text":
+		switch x := v.(type) {
+		case string:
+			return x, nil
+		case float64:
+			return strconv.FormatFloat(x, 'f', -1, 64), nil
+		case int64:
+			return strconv.FormatInt(x, 10), nil
+		case bool:
+			return strconv.FormatBool(x), nil
+		case time.Time:
+			return x.UTC().Format(time.RFC3339Nano), nil
+		}
+		return toJSON(v)
+	case "integer":
+		switch x := v.(type) {
+		case int64:
+			return x, nil
+		case float64:
+			if x != math.Trunc(x) {
+				return nil, fmt.Errorf("%v is not an integer", x)
+			}
+			return int64(x), nil
+		case string:
+			return strconv.ParseInt(x, 10, 64)
+		case bool:
+			if x {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		case time.Time:
+			return x.UnixMilli(), nil
+		}
+	case "real":
+		switch x := v.(type) {
+		case float64:
+			return x, nil
+		case int64:
+			return float64(x), nil
+		case string:
+			return strconv.ParseFloat(x, 64)
+		}
+	case "boolean":
+		switch x := v.(type) {
+		case bool:
+			return x, nil
+		case string:
+			return strconv.ParseBool(x)
+		}
+	case "json":
+		return toJSON(v)
+	case "timestamp":
+		switch x := v.(type) {
+		case time.Time:
+			return x.UTC(), nil
+		case string:
+			return time.Parse(time.RFC3339Nano, x)
+		case float64: // Unix milliseconds
+			return time.UnixMilli(int64(x)).UTC(), nil
+		case int64:
+			return time.UnixMilli(x).UTC(), nil
+		}
+	}
+	return nil, fmt.Errorf("cannot store %T as %s", v, typ)
+}
+
+func toJSON(v any) (any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// row maps one message to column values, in column order.
+func row(cols []Column, m kafka.Message, payload any) ([]any, error) {
+	out := make([]any, len(cols))
+	for i, c := range cols {
+		v, err := convert(field(m, payload, c.Field), c.Type)
+		if err != nil {
+			return nil, fmt.Errorf("column %s (%s): %w", c.Name, c.Field, err)
+		}
+		out[i] = v
+	}
+	return out, nil
+}
@@ -0,0 +1,111 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"e-commerce/common/codec"
+	"e-commerce/common/exactlyonce"
+	"e-commerce/common/metrics"
+	"e-commerce/common/sqldb"
+
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+// Sink is one manifest entry ready to run: its decoder, mapping and
+// the store it writes through.
+type Sink struct {
+	Spec   Spec
+	Store  exactlyonce.Store
+	dec    *codec.Decoder
+	db     *sqldb.DB // nil for jsonl
+	logger *zap.Logger
+}
+
+// Open connects a sink to its target. registry may be nil when no sink
+// decodes Avro.
+func Open(ctx context.Context, spec Spec, registry *codec.Registry, log *zap.Logger) (*Sink, error) {
+	dec, err := codec.NewDecoder(spec.Decoder, registry)
+	if err != nil {
+		return nil, err
+	}
+	s := &Sink{Spec: spec, dec: dec, logger: log.With(zap.String("sink", spec.Name))}
+
+	switch spec.Target.Type {
+	case "jsonl":
+		s.Store = newJSONL(spec.Target.Path, s)
+	default:
+		if spec.Target.Type == sqldb.SQLite && !strings.HasPrefix(spec.Target.DSN, ":") {
+			// SQLite creates the file but not its directory
+			if err := os.MkdirAll(filepath.Dir(spec.Target.DSN), 0o755); err != nil {
+				return nil, fmt.Errorf("sink %s: %w", spec.Name, err)
+			}
+		}
+		s.db, err = sqldb.Open(ctx, spec.Target.Type, spec.Target.DSN)
+		if err != nil {
+			return nil, fmt.Errorf("sink %s: %w", spec.Name, err)
+		}
+		t := newTable(s.db, spec, s)
+		if err := t.init(ctx); err != nil {
+			s.db.Close()
+			return nil, fmt.Errorf("sink %s: %w", spec.Name, err)
+		}
+		s.Store = sqldb.NewStore(s.db, t.write)
+	}
+	return s, nil
+}
+
+// Ping checks the target database; jsonl targets are always ready.
+func (s *Sink) Ping(ctx context.Context) error {
+	if s.db == nil {
+		return nil
+	}
+	return s.db.Ping(ctx)
+}
+
+// Close releases the target.
+func (s *Sink) Close() error {
+	if s.db == nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+// decode decodes a message value. With on_error skip a bad message is
+// logged and reported as not ok; with fail it is an error, which stops
+// the batch (and the sink) until the message is fixed or skipped.
+func (s *Sink) decode(ctx context.Context, m kafka.Message) (any, bool, error) {
+	d, err := s.dec.Decode(ctx, m.Value)
+	if err != nil {
+		return nil, false, s.bad(m, err)
+	}
+	return d.Value, true, nil
+}
+
+// mapRow maps a message to column values, with the same error policy
+// as decode.
+func (s *Sink) mapRow(m kafka.Message, payload any) ([]any, bool, error) {
+	vals, err := row(s.Spec.Columns, m, payload)
+	if err != nil {
+		return nil, false, s.bad(m, err)
+	}
+	return vals, true, nil
+}
+
+func (s *Sink) bad(m kafka.Message, err error) error {
+	if s.Spec.OnError == "fail" {
+		return fmt.Errorf("%s/%d@%d: %w", m.Topic, m.Partition, m.Offset, err)
+	}
+	s.logger.Warn("Skipping message",
+		zap.String("topic", m.Topic), zap.Int("partition", m.Partition),
+		zap.Int64("offset", m.Offset), zap.Error(err))
+	return nil
+}
+
+func (s *Sink) written(n int) {
+	metrics.SinkRows.WithLabelValues(s.Spec.Name).Add(float64(n))
+}
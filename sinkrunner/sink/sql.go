@@ -0,0 +1,133 @@
+package sink
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"e-commerce/common/sqldb"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Column types per dialect. SQLite has no native timestamp or JSON
+// type, so those are stored as RFC 3339 and JSON text.
+var sqlTypes = map[string]map[string]string{
+	sqldb.SQLite: {
+		"text": "TEXT", "integer": "INTEGER", "real": "REAL",
+		"boolean": "BOOLEAN", "json": "TEXT", "timestamp": "TEXT",
+	},
+	sqldb.Postgres: {
+		"text": "TEXT", "integer": "BIGINT", "real": "DOUBLE PRECISION",
+		"boolean": "BOOLEAN", "json": "JSONB", "timestamp": "TIMESTAMPTZ",
+	},
+}
+
+// table writes mapped rows to a SQL table.
+type table struct {
+	db     *sqldb.DB
+	spec   Spec
+	sink   *Sink
+	insert string
+}
+
+func newTable(db *sqldb.DB, spec Spec, s *Sink) *table {
+	return &table{db: db, spec: spec, sink: s, insert: db.Rebind(insertSQL(spec))}
+}
+
+func quote(ident string) string { return `"` + ident + `"` }
+
+func quoteAll(idents []string) string {
+	q := make([]string, len(idents))
+	for i, id := range idents {
+		q[i] = quote(id)
+	}
+	return strings.Join(q, ", ")
+}
+
+// insertSQL is the per-row statement. Upserts replace every non-key
+// column with the incoming value, so the latest message for a key wins.
+func insertSQL(spec Spec) string {
+	names := make([]string, len(spec.Columns))
+	for i, c := range spec.Columns {
+		names[i] = c.Name
+	}
+	q := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", quote(spec.Target.Table), quoteAll(names),
+		strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", "))
+	if spec.Mode != "upsert" {
+		return q
+	}
+	var set []string
+	for _, n := range names {
+		if !slices.Contains(spec.Key, n) {
+			set = append(set, fmt.Sprintf("%s = excluded.%s", quote(n), quote(n)))
+		}
+	}
+	if len(set) == 0 {
+		return q + fmt.Sprintf(" ON CONFLICT (%s) DO NOTHING", quoteAll(spec.Key))
+	}
+	return q + fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s", quoteAll(spec.Key), strings.Join(set, ", "))
+}
+
+// init creates the table if the spec asks for it. Upsert tables get
+// the key as their primary key, which ON CONFLICT needs; existing
+// tables must already have a unique constraint on it.
+func (t *table) init(ctx context.Context) error {
+	if !t.spec.Target.Create {
+		return nil
+	}
+	types := sqlTypes[t.db.Driver]
+	cols := make([]string, 0, len(t.spec.Columns)+1)
+	for _, c := range t.spec.Columns {
+		cols = append(cols, quote(c.Name)+" "+types[c.Type])
+	}
+	if t.spec.Mode == "upsert" {
+		cols = append(cols, "PRIMARY KEY ("+quoteAll(t.spec.Key)+")")
+	}
+	ddl := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n\t%s\n)", quote(t.spec.Target.Table), strings.Join(cols, ",\n\t"))
+	if _, err := t.db.ExecContext(ctx, ddl); err != nil {
+		return fmt.Errorf("creating table %s: %w", t.spec.Target.Table, err)
+	}
+	return nil
+}
+
+// write is the sqldb.Handler for the table.
+func (t *table) write(ctx context.Context, tx *sql.Tx, msgs []kafka.Message) error {
+	stmt, err := tx.PrepareContext(ctx, t.insert)
+	if err != nil {
+		return fmt.Errorf("preparing insert into %s: %w", t.spec.Target.Table, err)
+	}
+	defer stmt.Close()
+
+	n := 0
+	for _, m := range msgs {
+		payload, ok, err := t.sink.decode(ctx, m)
+		if err != nil {
+			return err
+		} else if !ok {
+			continue
+		}
+		vals, ok, err := t.sink.mapRow(m, payload)
+		if err != nil {
+			return err
+		} else if !ok {
+			continue
+		}
+		if t.db.Driver == sqldb.SQLite {
+			for i, v := range vals {
+				if ts, ok := v.(time.Time); ok {
+					vals[i] = ts.Format(time.RFC3339Nano)
+				}
+			}
+		}
+		if _, err := stmt.ExecContext(ctx, vals...); err != nil {
+			return fmt.Errorf("writing %s/%d@%d to %s: %w", m.Topic, m.Partition, m.Offset, t.spec.Target.Table, err)
+		}
+		n++
+	}
+	t.sink.written(n)
+	return nil
+}